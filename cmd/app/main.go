@@ -3,17 +3,22 @@ package main
 import (
 	"context"
 	"encoding/base64"
+	"flag"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/antonkarounis/stoic/internal/adapters/db"
 	"github.com/antonkarounis/stoic/internal/adapters/db/gen"
+	"github.com/antonkarounis/stoic/internal/adapters/storage"
 	views "github.com/antonkarounis/stoic/internal/adapters/web"
+	"github.com/antonkarounis/stoic/internal/adapters/web/framework"
 	"github.com/antonkarounis/stoic/internal/domain/models"
 	"github.com/antonkarounis/stoic/internal/domain/ports"
 	"github.com/antonkarounis/stoic/internal/domain/services"
@@ -35,28 +40,90 @@ func main() {
 	ConfigureLogging(cfg.Environment == "dev")
 
 	// Run migrations (using embedded SQL files, with advisory lock for safe multi-instance startup)
-	if err := db.Migrate(ctx, db.PlatformMigrations, "migrations", cfg.DatabaseURL); err != nil {
-		slog.Error("failed to run migrations", "error", err)
-		os.Exit(1)
+	migrateOpts := db.MigrateOptions{
+		LockRetries:       cfg.MigrationLockRetries,
+		LockRetryInterval: cfg.MigrationLockRetryInterval,
+		LockTimeout:       cfg.MigrationLockTimeout,
+		Schema:            cfg.DBSchema,
+		Table:             cfg.MigrationTable,
+	}
+	// "migrate [--dry-run]" runs (or lists) the migrations and exits without serving
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrateCommand(ctx, cfg, migrateOpts, os.Args[2:]))
+	}
+
+	// with MIGRATE_ON_START=false, migrations are applied separately (e.g. "migrate" run
+	// with a privileged user) and the startup check below only verifies the version
+	if cfg.MigrateOnStart {
+		if err := db.Migrate(ctx, db.PlatformMigrations, "migrations", cfg.DatabaseURL, migrateOpts); err != nil {
+			slog.Error("failed to run migrations", "error", err)
+			os.Exit(1)
+		}
 	}
 
 	// Create connection pool
-	pool, err := db.NewPool(ctx, cfg.DatabaseURL)
+	// the statement timeout applies to the pool only; migrations above use their own connection
+	pool, err := db.NewPoolWithOptions(ctx, cfg.DatabaseURL, db.PoolOptions{
+		StatementTimeout: cfg.DBStatementTimeout,
+		Schema:           cfg.DBSchema,
+	})
 	if err != nil {
 		slog.Error("failed to create database pool", "error", err)
 		os.Exit(1)
 	}
 	defer pool.Close()
 
+	// Refuse to serve traffic against an unreachable or out-of-date database
+	if err := db.CheckDatabase(ctx, pool, db.PlatformMigrations, "migrations", db.StartupCheckOptions{
+		Migrate:          migrateOpts,
+		DenySchemaCreate: cfg.DBDenySchemaCreate,
+	}); err != nil {
+		slog.Error("database startup check failed", "error", err)
+		os.Exit(1)
+	}
+
 	// Initialize SQLC queries
 	queries := gen.New(pool)
 
-	sessionRepository := db.NewSessionRepository(ctx, queries)
+	sessionRepository := db.NewSessionRepository(queries)
+	services.StartSessionCleanup(ctx, sessionRepository, cfg.SessionCleanupBatchSize)
 	identityRepository := db.NewIdentityRepository(queries)
 
+	var rateLimits ports.RateLimitRepository // nil keeps rate limits in memory, per instance
+	if cfg.RateLimitStore == "postgres" {
+		rateLimitRepository := db.NewRateLimitRepository(queries)
+		services.StartRateLimitCleanup(ctx, rateLimitRepository)
+		rateLimits = rateLimitRepository
+	}
+
 	userRepository := db.NewUserRepository(queries)
 
-	userService := services.NewUserService(userRepository)
+	preferencesRepository := db.NewPreferencesRepository(queries)
+
+	userService := services.NewUserService(userRepository, preferencesRepository)
+
+	flagService := services.NewFlagService(db.NewFlagRepository(queries), parseFeatureFlags(cfg.FeatureFlags), cfg.FeatureFlagsCacheTTL)
+
+	cookies, err := framework.NewCookies(cfg.Cookies, cfg.AppURL)
+	if err != nil {
+		slog.Error("invalid cookie config", "error", err)
+		os.Exit(1)
+	}
+	for _, warning := range cookies.SchemeWarnings(cfg.Environment == "dev") {
+		slog.Warn(warning)
+	}
+
+	keys, err := framework.DeriveKeys(cfg.SecretKey)
+	if err != nil {
+		slog.Error("failed to derive keys", "error", err)
+		os.Exit(1)
+	}
+
+	publicOrigin, err := framework.NewPublicOrigin(cfg.AppURL, cfg.TrustedHosts)
+	if err != nil {
+		slog.Error("invalid public URL config", "error", err)
+		os.Exit(1)
+	}
 
 	// Create auth config from infrastructure config
 	authCfg := &views.AuthConfig{
@@ -65,8 +132,39 @@ func main() {
 		OIDCClientSecret: cfg.OIDCClientSecret,
 		OIDCLogoutURL:    cfg.OIDCLogoutURL,
 		AppURL:           cfg.AppURL,
+		PublicOrigin:     publicOrigin,
 		SecretKey:        cfg.SecretKey,
 		IsDev:            cfg.Environment == "dev",
+
+		Scopes:                 cfg.OIDCScopes,
+		RequestRefreshToken:    cfg.OIDCRequestRefreshToken,
+		BearerAuth:             cfg.OIDCBearerAuth,
+		SessionClaims:          cfg.OIDCSessionClaims,
+		UserAttributeClaims:    cfg.OIDCUserAttributeClaims,
+		TenantClaim:            cfg.OIDCTenantClaim,
+		GroupsClaim:            cfg.OIDCGroupsClaim,
+		RoleAllowlist:          cfg.OIDCRoleAllowlist,
+		MaxRoles:               cfg.OIDCMaxRoles,
+		RoleRefreshInterval:    cfg.OIDCRoleRefreshInterval,
+		AllowedEmailDomains:    cfg.AllowedEmailDomains,
+		DeniedEmailDomains:     cfg.DeniedEmailDomains,
+		LoginMaxFailures:       cfg.LoginMaxFailures,
+		LoginFailureWindow:     cfg.LoginFailureWindow,
+		LoginLockout:           cfg.LoginLockout,
+		RateLimits:             rateLimits,
+		SessionTTL:             cfg.SessionTTL,
+		SessionSliding:         cfg.SessionSliding,
+		SessionSlidingInterval: cfg.SessionSlidingInterval,
+		Cookies:                cookies,
+	}
+
+	if cfg.OIDCDiscoveryFile != "" {
+		document, err := os.ReadFile(cfg.OIDCDiscoveryFile)
+		if err != nil {
+			slog.Error("failed to read OIDC discovery file", "error", err)
+			os.Exit(1)
+		}
+		authCfg.DiscoveryDocument = document
 	}
 
 	// Initialize auth service (OIDC provider + DB access)
@@ -76,24 +174,62 @@ func main() {
 		os.Exit(1)
 	}
 
-	authService.SetFirstLoginHook(func(ctx context.Context, email, name string) (models.UserID, error) {
-		user, err := userService.Register(ctx, ports.RegisterInput{Email: email, Name: name})
+	authService.SetAuditLog(db.NewAuditRepository(queries))
+
+	authService.SetFirstLoginHook(func(ctx context.Context, info views.LoginInfo) (models.UserID, error) {
+		user, err := userService.Register(ctx, ports.RegisterInput{Email: info.Email, Name: info.Name, TenantID: info.TenantID, Attributes: info.Attributes})
 		if err != nil {
 			return "", err
 		}
 		return user.ID, nil
 	})
 
-	// Stub: sync email/name changes from OIDC provider on each subsequent login
-	authService.SetOnLoginHook(func(ctx context.Context, userID models.UserID, email, name string) error {
-		return nil
+	// Sync email/name/attribute changes from the OIDC provider on each subsequent login; a name the
+	// user customized in settings is kept
+	authService.SetOnLoginHook(func(ctx context.Context, userID models.UserID, info views.LoginInfo) error {
+		return userService.SyncProfile(ctx, ports.SyncProfileInput{UserID: userID, Name: info.Name, Email: info.Email, Attributes: info.Attributes})
+	})
+
+	blobs, err := storage.New(storage.Config{
+		Driver:   cfg.BlobDriver,
+		LocalDir: cfg.BlobLocalDir,
+		BaseURL:  cfg.BlobBaseURL,
 	})
+	if err != nil {
+		slog.Error("failed to configure blob storage", "error", err)
+		os.Exit(1)
+	}
 
 	// Set up router and middleware
 	r := mux.NewRouter()
+	hub := &framework.Hub{}
 
-	isDev := cfg.Environment == "dev"
-	views.RegisterRoutes(r, *authService, userRepository, pool, isDev)
+	err = views.RegisterRoutes(r, authService, userRepository, userService, pool, views.RouteOptions{
+		IsDev: cfg.Environment == "dev",
+		Pagination: framework.PaginationOptions{
+			DefaultPerPage: cfg.PaginationDefaultPerPage,
+			MaxPerPage:     cfg.PaginationMaxPerPage,
+		},
+		PublicPaths:   cfg.PublicPaths,
+		Blobs:         blobs,
+		CSRFKey:       keys.CSRF,
+		RetryAfter:    cfg.RetryAfter,
+		Flags:         flagService,
+		OpenAPI:       cfg.OpenAPI,
+		WarmTemplates: cfg.WarmTemplates,
+		Cookies:       cookies,
+		Shutdown:      ctx.Done(), // cancelled on SIGTERM, before server.Shutdown
+		Hub:           hub,
+		Paths: views.RoutePaths{
+			AppPrefix:  cfg.AppPrefix,
+			Login:      cfg.LoginPath,
+			AfterLogin: cfg.AfterLoginPath,
+		},
+	})
+	if err != nil {
+		slog.Error("failed to register routes", "error", err)
+		os.Exit(1)
+	}
 
 	// Start HTTP server with timeouts
 	server := &http.Server{
@@ -123,6 +259,12 @@ func main() {
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer shutdownCancel()
 
+	// tell hub clients to reconnect, which lands them on a new instance, before the server
+	// waits for their streams to end
+	if err := hub.Shutdown(shutdownCtx, 2*time.Second); err != nil {
+		slog.Warn("SSE clients still connected at shutdown", "clients", hub.Clients(), "error", err)
+	}
+
 	if err := server.Shutdown(shutdownCtx); err != nil {
 		slog.Error("server forced to shutdown", "error", err)
 		os.Exit(1)
@@ -130,6 +272,43 @@ func main() {
 	slog.Info("server exited gracefully")
 }
 
+// runMigrateCommand applies pending migrations, or with --dry-run prints each pending
+// version and its SQL without applying anything. Returns the process exit code.
+func runMigrateCommand(ctx context.Context, cfg *ports.Config, opts db.MigrateOptions, args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "print pending migrations and their SQL without applying them")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if !*dryRun {
+		if err := db.Migrate(ctx, db.PlatformMigrations, "migrations", cfg.DatabaseURL, opts); err != nil {
+			slog.Error("failed to run migrations", "error", err)
+			return 1
+		}
+		return 0
+	}
+
+	pending, err := db.MigratePending(ctx, db.PlatformMigrations, "migrations", cfg.DatabaseURL, opts)
+	if err != nil {
+		slog.Error("failed to check pending migrations", "error", err)
+		return 1
+	}
+	if len(pending) == 0 {
+		fmt.Println("no pending migrations")
+		return 0
+	}
+	for _, version := range pending {
+		sql, err := db.PendingMigrationSQL(db.PlatformMigrations, "migrations", version)
+		if err != nil {
+			slog.Error("failed to read migration", "version", version, "error", err)
+			return 1
+		}
+		fmt.Printf("-- migration %d\n%s\n", version, sql)
+	}
+	return 0
+}
+
 func ConfigureLogging(isDev bool) {
 	logLevel := slog.LevelInfo
 	var logHandler slog.Handler
@@ -152,17 +331,98 @@ func LoadConfig() *ports.Config {
 		panic(fmt.Sprintf("SECRET_KEY must decode to exactly 32 bytes, got %d", len(secretKey)))
 	}
 
-	return &ports.Config{
-		Environment:      getEnv("ENVIRONMENT", "prod"),
-		AppURL:           requireEnv("APP_URL"),
-		Addr:             getEnv("ADDR", ":8080"),
-		DatabaseURL:      requireEnv("DATABASE_URL"),
+	cfg := &ports.Config{
+		Environment:  getEnv("ENVIRONMENT", "prod"),
+		AppURL:       requireEnv("APP_URL"),
+		TrustedHosts: getEnvList("TRUSTED_HOSTS", nil),
+		Addr:         getEnv("ADDR", ":8080"),
+		DatabaseURL:  requireEnv("DATABASE_URL"),
+
+		DBStatementTimeout: getEnvDuration("DB_STATEMENT_TIMEOUT", 0),
+		DBSchema:           getEnv("DB_SCHEMA", ""),
+		DBDenySchemaCreate: getEnvBool("DB_DENY_SCHEMA_CREATE", false),
+
+		MigrationLockRetries:       getEnvInt("MIGRATION_LOCK_RETRIES", 0),
+		MigrationLockRetryInterval: getEnvDuration("MIGRATION_LOCK_RETRY_INTERVAL", 2*time.Second),
+		MigrationLockTimeout:       getEnvDuration("MIGRATION_LOCK_TIMEOUT", 5*time.Minute),
+		MigrationTable:             getEnv("MIGRATION_TABLE", ""),
+		MigrateOnStart:             getEnvBool("MIGRATE_ON_START", true),
+
 		OIDCIssuerURL:    requireEnv("OIDC_ISSUER_URL"),
 		OIDCClientID:     requireEnv("OIDC_CLIENT_ID"),
 		OIDCClientSecret: requireEnv("OIDC_CLIENT_SECRET"),
 		OIDCLogoutURL:    getEnv("OIDC_LOGOUT_URL", ""),
-		SecretKey:        secretKey,
+
+		OIDCDiscoveryFile: getEnv("OIDC_DISCOVERY_FILE", ""),
+
+		OIDCScopes:              getEnvList("OIDC_SCOPES", []string{"openid", "profile", "email"}),
+		OIDCRequestRefreshToken: getEnvBool("OIDC_REQUEST_REFRESH_TOKEN", false),
+		OIDCBearerAuth:          getEnvBool("OIDC_BEARER_AUTH", false),
+		OIDCSessionClaims:       getEnvList("OIDC_SESSION_CLAIMS", nil),
+		OIDCUserAttributeClaims: getEnvList("OIDC_USER_ATTRIBUTE_CLAIMS", nil),
+		OIDCTenantClaim:         getEnv("OIDC_TENANT_CLAIM", ""),
+		OIDCGroupsClaim:         getEnv("OIDC_GROUPS_CLAIM", ""),
+		OIDCRoleAllowlist:       getEnvList("OIDC_ROLE_ALLOWLIST", nil),
+		OIDCMaxRoles:            getEnvInt("OIDC_MAX_ROLES", 0),
+		OIDCRoleRefreshInterval: getEnvDuration("OIDC_ROLE_REFRESH_INTERVAL", time.Hour),
+
+		AllowedEmailDomains: getEnvList("ALLOWED_EMAIL_DOMAINS", nil),
+		DeniedEmailDomains:  getEnvList("DENIED_EMAIL_DOMAINS", nil),
+
+		LoginMaxFailures:   getEnvInt("LOGIN_MAX_FAILURES", 0),
+		LoginFailureWindow: getEnvDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		LoginLockout:       getEnvDuration("LOGIN_LOCKOUT", 15*time.Minute),
+		RateLimitStore:     getEnv("RATE_LIMIT_STORE", "memory"),
+
+		SessionTTL:              getEnvDuration("SESSION_TTL", 24*time.Hour),
+		SessionCleanupBatchSize: getEnvInt("SESSION_CLEANUP_BATCH_SIZE", 1000),
+		SessionSliding:          getEnvBool("SESSION_SLIDING", false),
+		SessionSlidingInterval:  getEnvDuration("SESSION_SLIDING_INTERVAL", 5*time.Minute),
+
+		PaginationDefaultPerPage: getEnvInt("PAGINATION_DEFAULT_PER_PAGE", 20),
+		PaginationMaxPerPage:     getEnvInt("PAGINATION_MAX_PER_PAGE", 100),
+		PublicPaths:              getEnvList("PUBLIC_PATHS", nil),
+		RetryAfter:               getEnvDuration("RETRY_AFTER", 5*time.Second),
+		OpenAPI:                  getEnvBool("OPENAPI", false),
+		WarmTemplates:            getEnvBool("WARM_TEMPLATES", false),
+
+		AppPrefix:      getEnv("APP_PREFIX", "/app"),
+		LoginPath:      getEnv("LOGIN_PATH", "/login"),
+		AfterLoginPath: getEnv("AFTER_LOGIN_PATH", ""),
+
+		FeatureFlags:         getEnvList("FEATURE_FLAGS", nil),
+		FeatureFlagsCacheTTL: getEnvDuration("FEATURE_FLAGS_CACHE_TTL", 30*time.Second),
+
+		BlobDriver:   getEnv("BLOB_DRIVER", "local"),
+		BlobLocalDir: getEnv("BLOB_LOCAL_DIR", "data/blobs"),
+		BlobBaseURL:  getEnv("BLOB_BASE_URL", ""),
+
+		SecretKey: secretKey,
+
+		Cookies: ports.CookieConfig{
+			Prefix:         getEnv("COOKIE_PREFIX", ""),
+			Domain:         getEnv("COOKIE_DOMAIN", ""),
+			SameSite:       getEnv("COOKIE_SAMESITE", "lax"),
+			Secure:         getEnv("COOKIE_SECURE", "auto"),
+			SameSiteCompat: getEnvBool("COOKIE_SAMESITE_COMPAT", false),
+		},
+	}
+
+	// caught here rather than by NewAuthService, which would treat 0 as "use the default"
+	if cfg.LoginMaxFailures < 0 {
+		panic(fmt.Sprintf("LOGIN_MAX_FAILURES must not be negative, got %d", cfg.LoginMaxFailures))
+	}
+	if cfg.LoginMaxFailures > 0 && (cfg.LoginFailureWindow <= 0 || cfg.LoginLockout <= 0) {
+		panic(fmt.Sprintf("LOGIN_FAILURE_WINDOW and LOGIN_LOCKOUT must be positive, got %s and %s", cfg.LoginFailureWindow, cfg.LoginLockout))
+	}
+	if cfg.RateLimitStore != "memory" && cfg.RateLimitStore != "postgres" {
+		panic(fmt.Sprintf("RATE_LIMIT_STORE must be memory or postgres, got %q", cfg.RateLimitStore))
 	}
+	if cfg.SessionTTL <= 0 {
+		panic(fmt.Sprintf("SESSION_TTL must be positive, got %s", cfg.SessionTTL))
+	}
+
+	return cfg
 }
 
 func getEnv(key, fallback string) string {
@@ -172,6 +432,67 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+// parseFeatureFlags turns FEATURE_FLAGS entries into enabled flags: "name" or "name=value".
+func parseFeatureFlags(entries []string) []models.Flag {
+	flags := make([]models.Flag, 0, len(entries))
+	for _, entry := range entries {
+		name, value, _ := strings.Cut(entry, "=")
+		flags = append(flags, models.Flag{Name: strings.TrimSpace(name), Enabled: true, Value: strings.TrimSpace(value)})
+	}
+	return flags
+}
+
+// getEnvList parses a comma-separated list, trimming whitespace and dropping empty entries.
+func getEnvList(key string, fallback []string) []string {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		panic(fmt.Sprintf("%s is not a valid boolean: %v", key, err))
+	}
+	return b
+}
+
+func getEnvInt(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		panic(fmt.Sprintf("%s is not a valid integer: %v", key, err))
+	}
+	return n
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		panic(fmt.Sprintf("%s is not a valid duration: %v", key, err))
+	}
+	return d
+}
+
 func requireEnv(key string) string {
 	v := os.Getenv(key)
 	if v == "" {
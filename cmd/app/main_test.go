@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/base64"
+	"slices"
+	"testing"
+)
+
+// setRequiredEnv sets the variables LoadConfig panics without.
+func setRequiredEnv(t *testing.T) {
+	t.Setenv("SECRET_KEY", base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef")))
+	t.Setenv("APP_URL", "http://localhost:8080")
+	t.Setenv("DATABASE_URL", "postgres://localhost/stoic")
+	t.Setenv("OIDC_ISSUER_URL", "http://localhost:8180/realms/stoic")
+	t.Setenv("OIDC_CLIENT_ID", "stoic")
+	t.Setenv("OIDC_CLIENT_SECRET", "secret")
+}
+
+func TestLoadConfigOIDCScopes(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string // OIDC_SCOPES; "" leaves it unset
+		want []string
+	}{
+		{"default", "", []string{"openid", "profile", "email"}},
+		{"custom list", "openid,groups,offline_access", []string{"openid", "groups", "offline_access"}},
+		{"whitespace and empty entries", " openid , api:read,, ", []string{"openid", "api:read"}},
+		{"openid left out", "profile,email", []string{"profile", "email"}}, // added by the auth service
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setRequiredEnv(t)
+			t.Setenv("OIDC_SCOPES", tt.env)
+
+			if got := LoadConfig().OIDCScopes; !slices.Equal(got, tt.want) {
+				t.Errorf("OIDCScopes = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/antonkarounis/stoic/internal/adapters/db/gen"
+	"github.com/antonkarounis/stoic/internal/domain/models"
+	"github.com/antonkarounis/stoic/internal/domain/ports"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type AuditRepository struct {
+	queries *gen.Queries
+}
+
+var _ ports.AuditRepository = (*AuditRepository)(nil)
+
+func NewAuditRepository(q *gen.Queries) *AuditRepository {
+	return &AuditRepository{queries: q}
+}
+
+// Record implements [ports.AuditRepository].
+func (r *AuditRepository) Record(ctx context.Context, event models.AuditEvent) error {
+	details := []byte("{}")
+	if len(event.Details) > 0 {
+		var err error
+		if details, err = json.Marshal(event.Details); err != nil {
+			return fmt.Errorf("marshaling audit details: %w", err)
+		}
+	}
+
+	actor := pgtype.Text{}
+	if event.ActorUserID != nil {
+		actor = pgtype.Text{String: string(*event.ActorUserID), Valid: true}
+	}
+
+	return r.queries.InsertAuditEvent(ctx, gen.InsertAuditEventParams{
+		ActorUserID: actor,
+		Action:      event.Action,
+		Target:      event.Target,
+		Ip:          event.IP,
+		Details:     details,
+	})
+}
+
+// ListRecent implements [ports.AuditRepository].
+func (r *AuditRepository) ListRecent(ctx context.Context, limit int) ([]models.AuditEvent, error) {
+	rows, err := r.queries.ListRecentAuditEvents(ctx, int32(limit))
+	if err != nil {
+		return nil, mapErr(err)
+	}
+
+	events := make([]models.AuditEvent, 0, len(rows))
+	for _, row := range rows {
+		event := models.AuditEvent{
+			ID:          row.ID,
+			ActorUserID: identityUserID(row.ActorUserID),
+			Action:      row.Action,
+			Target:      row.Target,
+			IP:          row.Ip,
+			CreatedAt:   row.CreatedAt.Time,
+		}
+		if err := json.Unmarshal(row.Details, &event.Details); err != nil {
+			return nil, fmt.Errorf("unmarshaling audit details: %w", err)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
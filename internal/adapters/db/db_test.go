@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/antonkarounis/stoic/internal/adapters/db/gen"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testDatabaseURL returns the Postgres URL repository tests run against, skipping the test
+// when STOIC_TEST_DATABASE_URL is unset.
+func testDatabaseURL(t *testing.T) string {
+	t.Helper()
+	dbURL := os.Getenv("STOIC_TEST_DATABASE_URL")
+	if dbURL == "" {
+		t.Skip("STOIC_TEST_DATABASE_URL not set")
+	}
+	return dbURL
+}
+
+// newTestPool migrates a fresh schema, dropped when the test ends, and returns a pool
+// using it.
+func newTestPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	dbURL := testDatabaseURL(t)
+	ctx := context.Background()
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+
+	if err := Migrate(ctx, PlatformMigrations, "migrations", dbURL, MigrateOptions{Schema: schema}); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	pool, err := NewPoolWithOptions(ctx, dbURL, PoolOptions{Schema: schema})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := pool.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE"); err != nil {
+			t.Errorf("dropping schema %s: %v", schema, err)
+		}
+		pool.Close()
+	})
+	return pool
+}
+
+// newTestQueries returns queries on a freshly migrated schema; see newTestPool.
+func newTestQueries(t *testing.T) *gen.Queries {
+	t.Helper()
+	return gen.New(newTestPool(t))
+}
@@ -2,14 +2,27 @@ package db
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/antonkarounis/stoic/internal/domain/ports"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 func mapErr(err error) error {
 	if errors.Is(err, pgx.ErrNoRows) {
 		return ports.ErrNotFound
 	}
+	if isUnavailable(err) {
+		return fmt.Errorf("%w: %w", ports.ErrUnavailable, err)
+	}
 	return err
 }
+
+// isUnavailable reports whether err means the database could not be reached, as opposed
+// to a query failing: connecting failed, a network operation timed out, or the query was
+// never sent.
+func isUnavailable(err error) bool {
+	var connectErr *pgconn.ConnectError
+	return errors.As(err, &connectErr) || pgconn.Timeout(err) || pgconn.SafeToRetry(err)
+}
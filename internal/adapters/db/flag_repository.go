@@ -0,0 +1,50 @@
+package db
+
+import (
+	"context"
+
+	"github.com/antonkarounis/stoic/internal/adapters/db/gen"
+	"github.com/antonkarounis/stoic/internal/domain/models"
+	"github.com/antonkarounis/stoic/internal/domain/ports"
+)
+
+type FlagRepository struct {
+	queries *gen.Queries
+}
+
+var _ ports.FlagRepository = (*FlagRepository)(nil)
+
+func NewFlagRepository(q *gen.Queries) *FlagRepository {
+	return &FlagRepository{queries: q}
+}
+
+// ListFlags implements [ports.FlagRepository].
+func (r *FlagRepository) ListFlags(ctx context.Context) ([]models.Flag, error) {
+	rows, err := r.queries.ListFeatureFlags(ctx)
+	if err != nil {
+		return nil, mapErr(err)
+	}
+	flags := make([]models.Flag, len(rows))
+	for i, row := range rows {
+		flags[i] = models.Flag{Name: row.Name, Enabled: row.Enabled, Value: row.Value}
+	}
+	return flags, nil
+}
+
+// ListFlagOverrides implements [ports.FlagRepository].
+func (r *FlagRepository) ListFlagOverrides(ctx context.Context) ([]models.FlagOverride, error) {
+	rows, err := r.queries.ListFeatureFlagOverrides(ctx)
+	if err != nil {
+		return nil, mapErr(err)
+	}
+	overrides := make([]models.FlagOverride, len(rows))
+	for i, row := range rows {
+		overrides[i] = models.FlagOverride{
+			Name:    row.FlagName,
+			UserID:  models.UserID(row.UserID),
+			Enabled: row.Enabled,
+			Value:   row.Value,
+		}
+	}
+	return overrides, nil
+}
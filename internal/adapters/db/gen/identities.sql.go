@@ -41,6 +41,36 @@ func (q *Queries) GetIdentityByID(ctx context.Context, id int64) (GetIdentityByI
 	return i, err
 }
 
+const getIdentityBySub = `-- name: GetIdentityBySub :one
+SELECT id, auth_sub, last_login_at, user_id, created_at, updated_at
+FROM identities
+WHERE auth_sub = $1
+LIMIT 1
+`
+
+type GetIdentityBySubRow struct {
+	ID          int64
+	AuthSub     string
+	LastLoginAt pgtype.Timestamptz
+	UserID      pgtype.Text
+	CreatedAt   pgtype.Timestamptz
+	UpdatedAt   pgtype.Timestamptz
+}
+
+func (q *Queries) GetIdentityBySub(ctx context.Context, authSub string) (GetIdentityBySubRow, error) {
+	row := q.db.QueryRow(ctx, getIdentityBySub, authSub)
+	var i GetIdentityBySubRow
+	err := row.Scan(
+		&i.ID,
+		&i.AuthSub,
+		&i.LastLoginAt,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
 const linkIdentityToUser = `-- name: LinkIdentityToUser :exec
 UPDATE identities SET user_id = $2, updated_at = NOW() WHERE id = $1
 `
@@ -8,6 +8,31 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type AuditLog struct {
+	ID          int64
+	ActorUserID pgtype.Text
+	Action      string
+	Target      string
+	Ip          string
+	Details     []byte
+	CreatedAt   pgtype.Timestamptz
+}
+
+type FeatureFlag struct {
+	Name      string
+	Enabled   bool
+	Value     string
+	UpdatedAt pgtype.Timestamptz
+}
+
+type FeatureFlagOverride struct {
+	FlagName  string
+	UserID    string
+	Enabled   bool
+	Value     string
+	UpdatedAt pgtype.Timestamptz
+}
+
 type Identity struct {
 	ID          int64
 	AuthSub     string
@@ -17,6 +42,18 @@ type Identity struct {
 	UserID      pgtype.Text
 }
 
+type RateLimitHit struct {
+	ID        int64
+	Key       string
+	HitAt     pgtype.Timestamptz
+	ExpiresAt pgtype.Timestamptz
+}
+
+type RateLimitLockout struct {
+	Key         string
+	LockedUntil pgtype.Timestamptz
+}
+
 type Session struct {
 	SessionID  string
 	IdentityID int64
@@ -28,10 +65,22 @@ type Session struct {
 }
 
 type User struct {
-	ID        string
-	Name      string
-	Email     string
-	Role      string
-	CreatedAt pgtype.Timestamptz
+	ID             string
+	Name           string
+	Email          string
+	Role           string
+	CreatedAt      pgtype.Timestamptz
+	UpdatedAt      pgtype.Timestamptz
+	TenantID       pgtype.Text
+	NameCustomized bool
+	Attributes     []byte
+}
+
+type UserPreference struct {
+	UserID    string
+	Theme     string
+	Locale    string
+	Timezone  string
+	Extra     []byte
 	UpdatedAt pgtype.Timestamptz
 }
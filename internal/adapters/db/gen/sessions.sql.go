@@ -35,14 +35,23 @@ func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) er
 	return err
 }
 
-const deleteExpiredSessions = `-- name: DeleteExpiredSessions :exec
+const deleteExpiredSessions = `-- name: DeleteExpiredSessions :execrows
 DELETE FROM sessions
-WHERE expires_at < NOW()
+WHERE session_id IN (
+    SELECT session_id
+    FROM sessions
+    WHERE expires_at < NOW()
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+)
 `
 
-func (q *Queries) DeleteExpiredSessions(ctx context.Context) error {
-	_, err := q.db.Exec(ctx, deleteExpiredSessions)
-	return err
+func (q *Queries) DeleteExpiredSessions(ctx context.Context, limit int32) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredSessions, limit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
 }
 
 const deleteSession = `-- name: DeleteSession :exec
@@ -55,6 +64,23 @@ func (q *Queries) DeleteSession(ctx context.Context, sessionID string) error {
 	return err
 }
 
+const deleteSessionsByUser = `-- name: DeleteSessionsByUser :execrows
+DELETE FROM sessions
+WHERE identity_id IN (
+    SELECT id
+    FROM identities
+    WHERE user_id = $1
+)
+`
+
+func (q *Queries) DeleteSessionsByUser(ctx context.Context, userID pgtype.Text) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteSessionsByUser, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const getSession = `-- name: GetSession :one
 SELECT session_id, identity_id, token_data, id_token, expires_at, created_at, updated_at
 FROM sessions
@@ -77,6 +103,23 @@ func (q *Queries) GetSession(ctx context.Context, sessionID string) (Session, er
 	return i, err
 }
 
+const updateSessionExpiry = `-- name: UpdateSessionExpiry :exec
+UPDATE sessions
+SET expires_at = $2,
+    updated_at = NOW()
+WHERE session_id = $1
+`
+
+type UpdateSessionExpiryParams struct {
+	SessionID string
+	ExpiresAt pgtype.Timestamptz
+}
+
+func (q *Queries) UpdateSessionExpiry(ctx context.Context, arg UpdateSessionExpiryParams) error {
+	_, err := q.db.Exec(ctx, updateSessionExpiry, arg.SessionID, arg.ExpiresAt)
+	return err
+}
+
 const updateSessionToken = `-- name: UpdateSessionToken :exec
 UPDATE sessions
 SET token_data = $2,
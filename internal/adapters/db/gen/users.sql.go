@@ -12,7 +12,7 @@ import (
 )
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, name, email,  role, created_at, updated_at
+SELECT id, name, email,  role, created_at, updated_at, tenant_id, name_customized, attributes
 FROM users
 WHERE email = $1
 LIMIT 1
@@ -28,12 +28,15 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Role,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.TenantID,
+		&i.NameCustomized,
+		&i.Attributes,
 	)
 	return i, err
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, name, email,  role, created_at, updated_at
+SELECT id, name, email,  role, created_at, updated_at, tenant_id, name_customized, attributes
 FROM users
 WHERE id = $1
 LIMIT 1
@@ -49,27 +52,96 @@ func (q *Queries) GetUserByID(ctx context.Context, id string) (User, error) {
 		&i.Role,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.TenantID,
+		&i.NameCustomized,
+		&i.Attributes,
 	)
 	return i, err
 }
 
+const listUsersByAttributes = `-- name: ListUsersByAttributes :many
+SELECT id, name, email,  role, created_at, updated_at, tenant_id, name_customized, attributes
+FROM users
+WHERE attributes @> $1
+ORDER BY created_at, id
+LIMIT $2 OFFSET $3
+`
+
+type ListUsersByAttributesParams struct {
+	Attributes []byte
+	Limit      int32
+	Offset     int32
+}
+
+func (q *Queries) ListUsersByAttributes(ctx context.Context, arg ListUsersByAttributesParams) ([]User, error) {
+	rows, err := q.db.Query(ctx, listUsersByAttributes, arg.Attributes, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Email,
+			&i.Role,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.TenantID,
+			&i.NameCustomized,
+			&i.Attributes,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateUserDisplayName = `-- name: UpdateUserDisplayName :exec
+UPDATE users
+SET name            = $2,
+    name_customized = TRUE,
+    updated_at      = NOW()
+WHERE id = $1
+`
+
+type UpdateUserDisplayNameParams struct {
+	ID   string
+	Name string
+}
+
+func (q *Queries) UpdateUserDisplayName(ctx context.Context, arg UpdateUserDisplayNameParams) error {
+	_, err := q.db.Exec(ctx, updateUserDisplayName, arg.ID, arg.Name)
+	return err
+}
+
 const upsertUser = `-- name: UpsertUser :exec
-INSERT INTO users (id, name, email, role, created_at, updated_at)
-VALUES ($1, $2, $3, $4, $5,  $5)
+INSERT INTO users (id, name, email, role, tenant_id, attributes, created_at, updated_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7,  $7)
 ON CONFLICT (id)
 DO UPDATE SET
-    name         = EXCLUDED.name,
+    name         = CASE WHEN users.name_customized THEN users.name ELSE EXCLUDED.name END,
     email        = EXCLUDED.email,
     role         = EXCLUDED.role,
+    tenant_id    = EXCLUDED.tenant_id,
+    attributes   = EXCLUDED.attributes,
     updated_at   = NOW()
 `
 
 type UpsertUserParams struct {
-	ID        string
-	Name      string
-	Email     string
-	Role      string
-	CreatedAt pgtype.Timestamptz
+	ID         string
+	Name       string
+	Email      string
+	Role       string
+	TenantID   pgtype.Text
+	Attributes []byte
+	CreatedAt  pgtype.Timestamptz
 }
 
 func (q *Queries) UpsertUser(ctx context.Context, arg UpsertUserParams) error {
@@ -78,6 +150,8 @@ func (q *Queries) UpsertUser(ctx context.Context, arg UpsertUserParams) error {
 		arg.Name,
 		arg.Email,
 		arg.Role,
+		arg.TenantID,
+		arg.Attributes,
 		arg.CreatedAt,
 	)
 	return err
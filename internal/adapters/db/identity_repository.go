@@ -40,6 +40,18 @@ func (r *IdentityRepository) GetIdentityByID(ctx context.Context, identityID int
 	}, nil
 }
 
+func (r *IdentityRepository) GetIdentityBySub(ctx context.Context, authSub string) (models.Identity, error) {
+	row, err := r.queries.GetIdentityBySub(ctx, authSub)
+	if err != nil {
+		return models.Identity{}, mapErr(err)
+	}
+	return models.Identity{
+		ID:      row.ID,
+		AuthSub: row.AuthSub,
+		UserID:  identityUserID(row.UserID),
+	}, nil
+}
+
 func (r *IdentityRepository) UpsertIdentity(ctx context.Context, authSub string) (models.Identity, error) {
 	row, err := r.queries.UpsertIdentity(ctx, authSub)
 	if err != nil {
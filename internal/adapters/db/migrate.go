@@ -5,13 +5,17 @@ import (
 	"embed"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"log/slog"
+	"net/url"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 //go:embed migrations/*.sql
@@ -28,9 +32,33 @@ func (l *slogMigrateLogger) Verbose() bool {
 	return true
 }
 
+const (
+	defaultLockRetryInterval = 2 * time.Second
+	defaultLockTimeout       = 5 * time.Minute
+
+	// Postgres error codes for a version table or schema that doesn't exist yet
+	pgUndefinedTable    = "42P01"
+	pgInvalidSchemaName = "3F000"
+)
+
+// MigrateOptions controls how Migrate waits for the migration advisory lock.
+type MigrateOptions struct {
+	LockRetries       int           // max lock attempts; 0 means retry until LockTimeout
+	LockRetryInterval time.Duration // delay between lock attempts; defaults to 2s
+	LockTimeout       time.Duration // total time to wait for the lock; defaults to 5m
+
+	// Schema, if set, is created if missing and used as the search_path for migrations, so
+	// tables and the schema_migrations version table are placed in it rather than in
+	// public. Each schema therefore tracks its own migration version.
+	Schema string
+	// Table names the table recording the applied migration version; defaults to
+	// golang-migrate's "schema_migrations". Give each app sharing a schema its own.
+	Table string
+}
+
 // Migrate runs database migrations from the provided fs.FS.
 // Uses a PostgreSQL advisory lock to prevent races when multiple instances start concurrently.
-func Migrate(ctx context.Context, migrations fs.FS, subdir string, dbUrl string) error {
+func Migrate(ctx context.Context, migrations fs.FS, subdir string, dbUrl string, opts MigrateOptions) error {
 	// A3: Acquire advisory lock to prevent migration races across instances
 	conn, err := pgx.Connect(ctx, dbUrl)
 	if err != nil {
@@ -39,8 +67,8 @@ func Migrate(ctx context.Context, migrations fs.FS, subdir string, dbUrl string)
 	defer conn.Close(ctx)
 
 	const migrationLockID = 1
-	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
-		return fmt.Errorf("acquiring migration lock: %w", err)
+	if err := acquireMigrationLock(ctx, conn, migrationLockID, opts); err != nil {
+		return err
 	}
 	defer func() {
 		if _, err := conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID); err != nil {
@@ -48,6 +76,19 @@ func Migrate(ctx context.Context, migrations fs.FS, subdir string, dbUrl string)
 		}
 	}()
 
+	if opts.Schema != "" {
+		if err := validateSchemaName(opts.Schema); err != nil {
+			return err
+		}
+		// the name is validated as a plain identifier, so it is safe to interpolate
+		if _, err := conn.Exec(ctx, "CREATE SCHEMA IF NOT EXISTS "+opts.Schema); err != nil {
+			return fmt.Errorf("creating schema %s: %w", opts.Schema, err)
+		}
+	}
+	if dbUrl, err = migrationURL(dbUrl, opts); err != nil {
+		return err
+	}
+
 	source, err := iofs.New(migrations, subdir)
 	if err != nil {
 		return fmt.Errorf("creating migration source: %w", err)
@@ -82,3 +123,175 @@ func Migrate(ctx context.Context, migrations fs.FS, subdir string, dbUrl string)
 	slog.Info("completed migrations")
 	return nil
 }
+
+// MigratePending reports, in order, the versions Migrate would apply, without applying
+// anything or creating the version table. Use it for a dry run before a deploy, and
+// PendingMigrationSQL to show what each version runs.
+func MigratePending(ctx context.Context, migrations fs.FS, subdir string, dbUrl string, opts MigrateOptions) ([]uint, error) {
+	conn, err := pgx.Connect(ctx, dbUrl)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to read migration version: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	current, err := currentMigrationVersion(ctx, conn, opts)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := sourceVersions(migrations, subdir)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []uint
+	for _, version := range versions {
+		if int64(version) > current {
+			pending = append(pending, version)
+		}
+	}
+	return pending, nil
+}
+
+// sourceVersions lists the migration versions in subdir in ascending order.
+func sourceVersions(migrations fs.FS, subdir string) ([]uint, error) {
+	source, err := iofs.New(migrations, subdir)
+	if err != nil {
+		return nil, fmt.Errorf("creating migration source: %w", err)
+	}
+	defer source.Close()
+
+	var versions []uint
+	version, err := source.First()
+	for err == nil {
+		versions = append(versions, version)
+		version, err = source.Next(version)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("reading migration source: %w", err)
+	}
+	return versions, nil
+}
+
+// PendingMigrationSQL returns the up migration SQL for version.
+func PendingMigrationSQL(migrations fs.FS, subdir string, version uint) (string, error) {
+	source, err := iofs.New(migrations, subdir)
+	if err != nil {
+		return "", fmt.Errorf("creating migration source: %w", err)
+	}
+	defer source.Close()
+
+	r, identifier, err := source.ReadUp(version)
+	if err != nil {
+		return "", fmt.Errorf("reading migration %d: %w", version, err)
+	}
+	defer r.Close()
+	sql, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("reading migration %d_%s: %w", version, identifier, err)
+	}
+	return string(sql), nil
+}
+
+// queryRower is satisfied by *pgx.Conn and *pgxpool.Pool.
+type queryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// currentMigrationVersion reads the applied version from the version table, returning -1
+// when nothing has been applied yet. A dirty version is an error, since Migrate would
+// roll it back rather than apply anything.
+func currentMigrationVersion(ctx context.Context, q queryRower, opts MigrateOptions) (int64, error) {
+	table := "schema_migrations"
+	if opts.Table != "" {
+		table = opts.Table
+	}
+	if err := validateSchemaName(table); err != nil {
+		return 0, fmt.Errorf("migrations table: %w", err)
+	}
+	if opts.Schema != "" {
+		if err := validateSchemaName(opts.Schema); err != nil {
+			return 0, err
+		}
+		table = opts.Schema + "." + table
+	}
+
+	var version int64
+	var dirty bool
+	// both names are validated as plain identifiers, so they are safe to interpolate
+	err := q.QueryRow(ctx, "SELECT version, dirty FROM "+table+" LIMIT 1").Scan(&version, &dirty)
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, pgx.ErrNoRows), errors.As(err, &pgErr) && (pgErr.Code == pgUndefinedTable || pgErr.Code == pgInvalidSchemaName):
+		return -1, nil
+	case err != nil:
+		return 0, fmt.Errorf("reading migration version: %w", err)
+	case dirty:
+		return 0, fmt.Errorf("migration version %d is dirty", version)
+	}
+	return version, nil
+}
+
+// migrationURL adds the schema (as search_path, which the migrate driver passes on as a
+// connection parameter) and the version table (as x-migrations-table) to dbUrl. dbUrl is
+// returned unchanged when neither is set.
+func migrationURL(dbUrl string, opts MigrateOptions) (string, error) {
+	if opts.Schema == "" && opts.Table == "" {
+		return dbUrl, nil
+	}
+	if opts.Table != "" {
+		if err := validateSchemaName(opts.Table); err != nil {
+			return "", fmt.Errorf("migrations table: %w", err)
+		}
+	}
+
+	u, err := url.Parse(dbUrl)
+	if err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+		return "", errors.New("a migrations schema or table requires DATABASE_URL in postgres:// URL form")
+	}
+	q := u.Query()
+	if opts.Schema != "" {
+		q.Set("search_path", opts.Schema)
+	}
+	if opts.Table != "" {
+		q.Set("x-migrations-table", opts.Table)
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// acquireMigrationLock polls pg_try_advisory_lock until it succeeds, the retry budget is
+// spent, or LockTimeout elapses. Unlike pg_advisory_lock it never blocks indefinitely, so a
+// stuck instance holding the lock produces a clear startup failure instead of a silent hang.
+func acquireMigrationLock(ctx context.Context, conn *pgx.Conn, lockID int64, opts MigrateOptions) error {
+	if opts.LockRetryInterval <= 0 {
+		opts.LockRetryInterval = defaultLockRetryInterval
+	}
+	if opts.LockTimeout <= 0 {
+		opts.LockTimeout = defaultLockTimeout
+	}
+
+	deadline := time.Now().Add(opts.LockTimeout)
+	for attempt := 1; ; attempt++ {
+		var acquired bool
+		if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", lockID).Scan(&acquired); err != nil {
+			return fmt.Errorf("acquiring migration lock: %w", err)
+		}
+		if acquired {
+			return nil
+		}
+
+		if opts.LockRetries > 0 && attempt >= opts.LockRetries {
+			return fmt.Errorf("migration lock held by another instance: gave up after %d attempts", attempt)
+		}
+		if time.Now().Add(opts.LockRetryInterval).After(deadline) {
+			return fmt.Errorf("migration lock held by another instance: gave up after %s", opts.LockTimeout)
+		}
+
+		slog.Info("waiting for migration lock held by another instance", "attempt", attempt, "retry_in", opts.LockRetryInterval)
+		select {
+		case <-time.After(opts.LockRetryInterval):
+		case <-ctx.Done():
+			return fmt.Errorf("context cancelled waiting for migration lock: %w", ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestMigrationURL(t *testing.T) {
+	tests := []struct {
+		name      string
+		dbURL     string
+		opts      MigrateOptions
+		wantQuery url.Values // nil expects dbURL unchanged
+		wantErr   bool
+	}{
+		{"defaults leave the URL alone", "postgres://db/app?sslmode=disable", MigrateOptions{}, nil, false},
+		{"custom table", "postgres://db/app?sslmode=disable", MigrateOptions{Table: "billing_migrations"},
+			url.Values{"sslmode": {"disable"}, "x-migrations-table": {"billing_migrations"}}, false},
+		{"schema and table", "postgresql://db/app", MigrateOptions{Schema: "billing", Table: "billing_migrations"},
+			url.Values{"search_path": {"billing"}, "x-migrations-table": {"billing_migrations"}}, false},
+		{"invalid table name", "postgres://db/app", MigrateOptions{Table: "bad-name"}, nil, true},
+		{"key-value DSN", "host=db dbname=app", MigrateOptions{Table: "billing_migrations"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := migrationURL(tt.dbURL, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.wantQuery == nil {
+				if got != tt.dbURL {
+					t.Errorf("got %q, want %q unchanged", got, tt.dbURL)
+				}
+				return
+			}
+			u, err := url.Parse(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q := u.Query(); q.Encode() != tt.wantQuery.Encode() {
+				t.Errorf("query = %q, want %q", q.Encode(), tt.wantQuery.Encode())
+			}
+		})
+	}
+}
+
+func TestMigrateIntoCustomTable(t *testing.T) {
+	dbURL := testDatabaseURL(t)
+	ctx := context.Background()
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	opts := MigrateOptions{Schema: schema, Table: "app_migrations"}
+
+	if err := Migrate(ctx, PlatformMigrations, "migrations", dbURL, opts); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	conn, err := pgx.Connect(ctx, dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+	defer conn.Exec(ctx, "DROP SCHEMA "+schema+" CASCADE")
+
+	versions, err := sourceVersions(PlatformMigrations, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := currentMigrationVersion(ctx, conn, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(versions[len(versions)-1]); version != want {
+		t.Errorf("version in %s.app_migrations = %d, want %d", schema, version, want)
+	}
+
+	// the default table was never created, so to it nothing has been applied
+	if version, err := currentMigrationVersion(ctx, conn, MigrateOptions{Schema: schema}); err != nil || version != -1 {
+		t.Errorf("version in %s.schema_migrations = %d (%v), want none", schema, version, err)
+	}
+}
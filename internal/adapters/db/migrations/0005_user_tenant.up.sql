@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN tenant_id TEXT NULL;
+
+CREATE INDEX idx_users_tenant_id ON users(tenant_id);
@@ -0,0 +1,12 @@
+CREATE TABLE audit_log (
+    id             BIGSERIAL    PRIMARY KEY,
+    actor_user_id  TEXT         NULL REFERENCES users(id) ON DELETE SET NULL,
+    action         TEXT         NOT NULL,
+    target         TEXT         NOT NULL DEFAULT '',
+    ip             TEXT         NOT NULL DEFAULT '',
+    details        JSONB        NOT NULL DEFAULT '{}',
+    created_at     TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_audit_log_created_at ON audit_log(created_at);
+CREATE INDEX idx_audit_log_actor_user_id ON audit_log(actor_user_id);
@@ -0,0 +1,3 @@
+ALTER TABLE identities DROP CONSTRAINT identities_user_id_fkey;
+ALTER TABLE identities ADD CONSTRAINT identities_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users(id);
@@ -0,0 +1,5 @@
+-- Deleting a user removes its linked identities, which in turn cascades to their sessions,
+-- so no session can outlive the user it belongs to.
+ALTER TABLE identities DROP CONSTRAINT identities_user_id_fkey;
+ALTER TABLE identities ADD CONSTRAINT identities_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
@@ -0,0 +1,2 @@
+-- Set once a user edits their display name, so logins stop syncing it from the provider.
+ALTER TABLE users ADD COLUMN name_customized BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,8 @@
+CREATE TABLE user_preferences (
+    user_id     TEXT         PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    theme       TEXT         NOT NULL DEFAULT '',
+    locale      TEXT         NOT NULL DEFAULT '',
+    timezone    TEXT         NOT NULL DEFAULT '',
+    extra       JSONB        NOT NULL DEFAULT '{}',
+    updated_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
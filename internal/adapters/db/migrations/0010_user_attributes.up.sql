@@ -0,0 +1,5 @@
+-- Custom attributes copied from ID token claims (see OIDC_USER_ATTRIBUTE_CLAIMS), kept out
+-- of the core columns so org-specific fields need no schema change.
+ALTER TABLE users ADD COLUMN attributes JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+CREATE INDEX idx_users_attributes ON users USING GIN (attributes jsonb_path_ops);
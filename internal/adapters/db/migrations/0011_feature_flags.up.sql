@@ -0,0 +1,18 @@
+-- Feature flags. A row here takes precedence over a FEATURE_FLAGS default of the same name;
+-- overrides take precedence over both for a single user, e.g. during a gradual rollout.
+CREATE TABLE feature_flags (
+    name        TEXT         PRIMARY KEY,
+    enabled     BOOLEAN      NOT NULL DEFAULT FALSE,
+    value       TEXT         NOT NULL DEFAULT '',
+    updated_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+-- flag_name is not a foreign key so flags defined only in FEATURE_FLAGS can be overridden too.
+CREATE TABLE feature_flag_overrides (
+    flag_name   TEXT         NOT NULL,
+    user_id     TEXT         NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    enabled     BOOLEAN      NOT NULL,
+    value       TEXT         NOT NULL DEFAULT '',
+    updated_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (flag_name, user_id)
+);
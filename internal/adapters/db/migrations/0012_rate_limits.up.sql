@@ -0,0 +1,19 @@
+-- Rate limit state shared by every app instance, used when RATE_LIMIT_STORE=postgres.
+-- rate_limit_hits logs each hit on a key (e.g. "sub:<subject>" for failed logins), so
+-- limits count the hits within a sliding window; rate_limit_lockouts holds the keys locked
+-- out for exceeding their limit. Rows past expires_at or locked_until are only kept until
+-- the next cleanup.
+CREATE TABLE rate_limit_hits (
+    id          BIGSERIAL    PRIMARY KEY,
+    key         TEXT         NOT NULL,
+    hit_at      TIMESTAMPTZ  NOT NULL,
+    expires_at  TIMESTAMPTZ  NOT NULL
+);
+
+CREATE INDEX idx_rate_limit_hits_key_hit_at ON rate_limit_hits(key, hit_at);
+CREATE INDEX idx_rate_limit_hits_expires_at ON rate_limit_hits(expires_at);
+
+CREATE TABLE rate_limit_lockouts (
+    key           TEXT         PRIMARY KEY,
+    locked_until  TIMESTAMPTZ  NOT NULL
+);
@@ -3,17 +3,46 @@ package db
 import (
 	"context"
 	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// PoolOptions configures NewPoolWithOptions.
+type PoolOptions struct {
+	// StatementTimeout, if positive, is set as statement_timeout on every pooled connection,
+	// so Postgres cancels runaway queries even when a caller's context has no deadline.
+	// Migrations open their own connection (see Migrate) and are never subject to it.
+	StatementTimeout time.Duration
+	// Schema, if set, becomes the search_path of every pooled connection, so unqualified
+	// table names resolve to it instead of public. Pass the same value to MigrateOptions.
+	Schema string
+}
+
 func NewPool(ctx context.Context, databaseURL string) (*pgxpool.Pool, error) {
+	return NewPoolWithOptions(ctx, databaseURL, PoolOptions{})
+}
+
+func NewPoolWithOptions(ctx context.Context, databaseURL string, opts PoolOptions) (*pgxpool.Pool, error) {
 	config, err := pgxpool.ParseConfig(databaseURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse database URL: %w", err)
 	}
 
+	if opts.StatementTimeout > 0 {
+		// sent as a startup parameter, so it costs no extra round trip per connection
+		config.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(opts.StatementTimeout.Milliseconds(), 10)
+	}
+	if opts.Schema != "" {
+		if err := validateSchemaName(opts.Schema); err != nil {
+			return nil, err
+		}
+		config.ConnConfig.RuntimeParams["search_path"] = opts.Schema
+	}
+
 	config.MinConns = 2
 	config.MaxConns = 10
 	config.MaxConnLifetime = 1 * time.Hour
@@ -32,3 +61,14 @@ func NewPool(ctx context.Context, databaseURL string) (*pgxpool.Pool, error) {
 
 	return pool, nil
 }
+
+var schemaNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,62}$`)
+
+// validateSchemaName accepts only lowercase unquoted Postgres identifiers, so a schema or
+// table name can be interpolated into SQL and connection parameters without quoting.
+func validateSchemaName(schema string) error {
+	if !schemaNamePattern.MatchString(schema) || strings.HasPrefix(schema, "pg_") {
+		return fmt.Errorf("invalid name %q: use lowercase letters, digits and underscores, not starting with a digit or pg_", schema)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/antonkarounis/stoic/internal/adapters/db/gen"
+	"github.com/antonkarounis/stoic/internal/domain/models"
+	"github.com/antonkarounis/stoic/internal/domain/ports"
+	"github.com/jackc/pgx/v5"
+)
+
+type PreferencesRepository struct {
+	queries *gen.Queries
+}
+
+var _ ports.PreferencesRepository = (*PreferencesRepository)(nil)
+
+func NewPreferencesRepository(q *gen.Queries) *PreferencesRepository {
+	return &PreferencesRepository{queries: q}
+}
+
+// Get implements [ports.PreferencesRepository].
+func (r *PreferencesRepository) Get(ctx context.Context, userID models.UserID) (models.Preferences, error) {
+	row, err := r.queries.GetUserPreferences(ctx, string(userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Preferences{}, nil // nothing stored yet; callers apply the defaults
+	}
+	if err != nil {
+		return models.Preferences{}, mapErr(err)
+	}
+
+	prefs := models.Preferences{
+		Theme:    row.Theme,
+		Locale:   row.Locale,
+		Timezone: row.Timezone,
+	}
+	if len(row.Extra) > 0 {
+		if err := json.Unmarshal(row.Extra, &prefs.Extra); err != nil {
+			return models.Preferences{}, fmt.Errorf("unmarshaling preferences: %w", err)
+		}
+	}
+	return prefs, nil
+}
+
+// Save implements [ports.PreferencesRepository].
+func (r *PreferencesRepository) Save(ctx context.Context, userID models.UserID, prefs models.Preferences) error {
+	extra := []byte("{}")
+	if len(prefs.Extra) > 0 {
+		var err error
+		if extra, err = json.Marshal(prefs.Extra); err != nil {
+			return fmt.Errorf("marshaling preferences: %w", err)
+		}
+	}
+
+	return r.queries.UpsertUserPreferences(ctx, gen.UpsertUserPreferencesParams{
+		UserID:   string(userID),
+		Theme:    prefs.Theme,
+		Locale:   prefs.Locale,
+		Timezone: prefs.Timezone,
+		Extra:    extra,
+	})
+}
@@ -0,0 +1,9 @@
+-- name: InsertAuditEvent :exec
+INSERT INTO audit_log (actor_user_id, action, target, ip, details)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: ListRecentAuditEvents :many
+SELECT id, actor_user_id, action, target, ip, details, created_at
+FROM audit_log
+ORDER BY created_at DESC, id DESC
+LIMIT $1;
@@ -0,0 +1,9 @@
+-- name: ListFeatureFlags :many
+SELECT name, enabled, value, updated_at
+FROM feature_flags
+ORDER BY name;
+
+-- name: ListFeatureFlagOverrides :many
+SELECT flag_name, user_id, enabled, value, updated_at
+FROM feature_flag_overrides
+ORDER BY flag_name, user_id;
@@ -13,5 +13,11 @@ FROM identities
 WHERE id = $1
 LIMIT 1;
 
+-- name: GetIdentityBySub :one
+SELECT id, auth_sub, last_login_at, user_id, created_at, updated_at
+FROM identities
+WHERE auth_sub = $1
+LIMIT 1;
+
 -- name: LinkIdentityToUser :exec
 UPDATE identities SET user_id = $2, updated_at = NOW() WHERE id = $1;
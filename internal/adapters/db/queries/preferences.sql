@@ -0,0 +1,16 @@
+-- name: GetUserPreferences :one
+SELECT user_id, theme, locale, timezone, extra, updated_at
+FROM user_preferences
+WHERE user_id = $1
+LIMIT 1;
+
+-- name: UpsertUserPreferences :exec
+INSERT INTO user_preferences (user_id, theme, locale, timezone, extra, updated_at)
+VALUES ($1, $2, $3, $4, $5, NOW())
+ON CONFLICT (user_id)
+DO UPDATE SET
+    theme      = EXCLUDED.theme,
+    locale     = EXCLUDED.locale,
+    timezone   = EXCLUDED.timezone,
+    extra      = EXCLUDED.extra,
+    updated_at = NOW();
@@ -0,0 +1,37 @@
+-- name: HitRateLimit :one
+-- The SELECT does not see the row its own CTE inserts, hence the + 1.
+WITH hit AS (
+    INSERT INTO rate_limit_hits (key, hit_at, expires_at)
+    VALUES (@key, @hit_at, @expires_at)
+)
+SELECT (COUNT(*) + 1)::int AS hits
+FROM rate_limit_hits
+WHERE key = @key
+  AND hit_at > @window_start;
+
+-- name: LockRateLimit :exec
+INSERT INTO rate_limit_lockouts (key, locked_until)
+VALUES ($1, $2)
+ON CONFLICT (key) DO UPDATE SET locked_until = GREATEST(rate_limit_lockouts.locked_until, EXCLUDED.locked_until);
+
+-- name: GetRateLimitLockout :one
+SELECT MAX(locked_until)::timestamptz AS locked_until
+FROM rate_limit_lockouts
+WHERE key = ANY(@keys::text[])
+  AND locked_until > NOW();
+
+-- name: DeleteRateLimits :exec
+DELETE FROM rate_limit_hits
+WHERE key = ANY(@keys::text[]);
+
+-- name: DeleteRateLimitLockouts :exec
+DELETE FROM rate_limit_lockouts
+WHERE key = ANY(@keys::text[]);
+
+-- name: DeleteExpiredRateLimits :execrows
+DELETE FROM rate_limit_hits
+WHERE expires_at < NOW();
+
+-- name: DeleteExpiredRateLimitLockouts :execrows
+DELETE FROM rate_limit_lockouts
+WHERE locked_until < NOW();
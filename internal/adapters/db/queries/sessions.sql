@@ -14,10 +14,30 @@ SET token_data = $2,
     updated_at = NOW()
 WHERE session_id = $1;
 
+-- name: UpdateSessionExpiry :exec
+UPDATE sessions
+SET expires_at = $2,
+    updated_at = NOW()
+WHERE session_id = $1;
+
 -- name: DeleteSession :exec
 DELETE FROM sessions
 WHERE session_id = $1;
 
--- name: DeleteExpiredSessions :exec
+-- name: DeleteSessionsByUser :execrows
+DELETE FROM sessions
+WHERE identity_id IN (
+    SELECT id
+    FROM identities
+    WHERE user_id = $1
+);
+
+-- name: DeleteExpiredSessions :execrows
 DELETE FROM sessions
-WHERE expires_at < NOW();
+WHERE session_id IN (
+    SELECT session_id
+    FROM sessions
+    WHERE expires_at < NOW()
+    LIMIT $1
+    FOR UPDATE SKIP LOCKED
+);
@@ -1,21 +1,37 @@
 -- name: UpsertUser :exec
-INSERT INTO users (id, name, email, role, created_at, updated_at)
-VALUES ($1, $2, $3, $4, $5,  $5)
+INSERT INTO users (id, name, email, role, tenant_id, attributes, created_at, updated_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7,  $7)
 ON CONFLICT (id)
 DO UPDATE SET
-    name         = EXCLUDED.name,
+    name         = CASE WHEN users.name_customized THEN users.name ELSE EXCLUDED.name END,
     email        = EXCLUDED.email,
     role         = EXCLUDED.role,
+    tenant_id    = EXCLUDED.tenant_id,
+    attributes   = EXCLUDED.attributes,
     updated_at   = NOW();
 
+-- name: UpdateUserDisplayName :exec
+UPDATE users
+SET name            = $2,
+    name_customized = TRUE,
+    updated_at      = NOW()
+WHERE id = $1;
+
 -- name: GetUserByID :one
-SELECT id, name, email,  role, created_at, updated_at
+SELECT id, name, email,  role, created_at, updated_at, tenant_id, name_customized, attributes
 FROM users
 WHERE id = $1
 LIMIT 1;
 
 -- name: GetUserByEmail :one
-SELECT id, name, email,  role, created_at, updated_at
+SELECT id, name, email,  role, created_at, updated_at, tenant_id, name_customized, attributes
 FROM users
 WHERE email = $1
 LIMIT 1;
+
+-- name: ListUsersByAttributes :many
+SELECT id, name, email,  role, created_at, updated_at, tenant_id, name_customized, attributes
+FROM users
+WHERE attributes @> $1
+ORDER BY created_at, id
+LIMIT $2 OFFSET $3;
@@ -2,7 +2,6 @@ package db
 
 import (
 	"context"
-	"log/slog"
 	"time"
 
 	"github.com/antonkarounis/stoic/internal/adapters/db/gen"
@@ -17,29 +16,10 @@ type SessionRepository struct {
 
 var _ ports.SessionRepository = (*SessionRepository)(nil)
 
-func NewSessionRepository(ctx context.Context, q *gen.Queries) *SessionRepository {
-	startCleanupRoutine(ctx, q)
+func NewSessionRepository(q *gen.Queries) *SessionRepository {
 	return &SessionRepository{queries: q}
 }
 
-func startCleanupRoutine(ctx context.Context, queries *gen.Queries) {
-	// Periodically clean up expired sessions
-	go func() {
-		ticker := time.NewTicker(5 * time.Minute)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ticker.C:
-				if err := queries.DeleteExpiredSessions(ctx); err != nil {
-					slog.Warn("failed to clean up expired sessions", "error", err)
-				}
-			case <-ctx.Done():
-				return
-			}
-		}
-	}()
-}
-
 // CreateSession implements [auth.SessionRepository].
 func (s *SessionRepository) CreateSession(ctx context.Context, sessionID string, session models.SessionData) error {
 	return s.queries.CreateSession(ctx, gen.CreateSessionParams{
@@ -56,6 +36,11 @@ func (s *SessionRepository) DeleteSession(ctx context.Context, sessionID string)
 	return s.queries.DeleteSession(ctx, sessionID)
 }
 
+// DeleteSessionsByUser implements [ports.SessionRepository].
+func (s *SessionRepository) DeleteSessionsByUser(ctx context.Context, userID models.UserID) (int64, error) {
+	return s.queries.DeleteSessionsByUser(ctx, pgtype.Text{String: string(userID), Valid: true})
+}
+
 // GetSession implements [auth.SessionRepository].
 func (s *SessionRepository) GetSession(ctx context.Context, sessionID string) (*models.SessionData, error) {
 	session, err := s.queries.GetSession(ctx, sessionID)
@@ -71,6 +56,20 @@ func (s *SessionRepository) GetSession(ctx context.Context, sessionID string) (*
 	}, nil
 }
 
+// UpdateSessionExpiry implements [ports.SessionRepository].
+func (s *SessionRepository) UpdateSessionExpiry(ctx context.Context, sessionID string, expires time.Time) error {
+	return s.queries.UpdateSessionExpiry(ctx, gen.UpdateSessionExpiryParams{
+		SessionID: sessionID,
+		ExpiresAt: pgtype.Timestamptz{Time: expires, Valid: true},
+	})
+}
+
+// DeleteExpiredSessions implements [ports.SessionRepository]. Rows locked by a concurrent
+// cleanup are skipped rather than waited on.
+func (s *SessionRepository) DeleteExpiredSessions(ctx context.Context, limit int) (int64, error) {
+	return s.queries.DeleteExpiredSessions(ctx, int32(limit))
+}
+
 // UpdateSessionToken implements [auth.SessionRepository].
 func (s *SessionRepository) UpdateSessionToken(ctx context.Context, sessionID string, session models.SessionData) error {
 	return s.queries.UpdateSessionToken(ctx, gen.UpdateSessionTokenParams{
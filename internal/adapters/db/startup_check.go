@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// StartupCheckOptions configures CheckDatabase.
+type StartupCheckOptions struct {
+	Migrate MigrateOptions // schema and version table the migrations were applied with
+
+	// DenySchemaCreate fails the check if the pool's user may create objects in its
+	// schema. Enable it when migrations run separately with a privileged user (see the
+	// migrate subcommand), so a deploy with the migration credentials is refused.
+	DenySchemaCreate bool
+}
+
+// CheckDatabase verifies, before serving traffic, that the pool reaches the database, that
+// the applied migration version is exactly the latest in migrations, and optionally that
+// the runtime user lacks DDL privileges. It fails fast on misconfigured credentials or a
+// skipped migration instead of letting requests hit errors later.
+func CheckDatabase(ctx context.Context, pool *pgxpool.Pool, migrations fs.FS, subdir string, opts StartupCheckOptions) error {
+	if err := pool.Ping(ctx); err != nil {
+		return fmt.Errorf("database unreachable: %w", err)
+	}
+
+	versions, err := sourceVersions(migrations, subdir)
+	if err != nil {
+		return err
+	}
+	current, err := currentMigrationVersion(ctx, pool, opts.Migrate)
+	if err != nil {
+		return err
+	}
+	var expected int64 = -1
+	if len(versions) > 0 {
+		expected = int64(versions[len(versions)-1])
+	}
+	switch {
+	case current < expected:
+		return fmt.Errorf("database schema is at version %d, expected %d: run migrations first", current, expected)
+	case current > expected:
+		return fmt.Errorf("database schema is at version %d, newer than this build's %d", current, expected)
+	}
+
+	if opts.DenySchemaCreate {
+		var canCreate bool
+		if err := pool.QueryRow(ctx, "SELECT has_schema_privilege(current_schema(), 'CREATE')").Scan(&canCreate); err != nil {
+			return fmt.Errorf("checking schema privileges: %w", err)
+		}
+		if canCreate {
+			return fmt.Errorf("database user may create objects in the schema; expected a runtime user without DDL privileges")
+		}
+	}
+	return nil
+}
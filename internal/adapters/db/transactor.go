@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/antonkarounis/stoic/internal/adapters/db/gen"
 	"github.com/antonkarounis/stoic/internal/domain/ports"
@@ -13,12 +14,24 @@ import (
 type pgxTransactor struct {
 	pool    *pgxpool.Pool
 	queries *gen.Queries
+	opts    TransactorOptions
 }
 
 var _ ports.Transactor = (*pgxTransactor)(nil)
 
+// TransactorOptions configures NewTransactorWithOptions.
+type TransactorOptions struct {
+	// StatementTimeout, if positive, is applied with SET LOCAL at the start of every
+	// transaction, overriding the pool-wide PoolOptions.StatementTimeout for its duration.
+	StatementTimeout time.Duration
+}
+
 func NewTransactor(pool *pgxpool.Pool, queries *gen.Queries) ports.Transactor {
-	return &pgxTransactor{pool: pool, queries: queries}
+	return NewTransactorWithOptions(pool, queries, TransactorOptions{})
+}
+
+func NewTransactorWithOptions(pool *pgxpool.Pool, queries *gen.Queries, opts TransactorOptions) ports.Transactor {
+	return &pgxTransactor{pool: pool, queries: queries, opts: opts}
 }
 
 // InTx implements [ports.Transactor].
@@ -29,9 +42,16 @@ func (t *pgxTransactor) InTx(ctx context.Context, fn func(ctx context.Context, r
 	}
 	defer tx.Rollback(ctx) //nolint:errcheck
 
+	if t.opts.StatementTimeout > 0 {
+		// SET cannot take bind parameters; the value is an integer so formatting it is safe
+		if _, err := tx.Exec(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", t.opts.StatementTimeout.Milliseconds())); err != nil {
+			return fmt.Errorf("set statement timeout: %w", err)
+		}
+	}
+
 	q := t.queries.WithTx(tx)
 	repos := ports.TxRepositories{
-		Users:      NewUserRepository(q),
+		Users: NewUserRepository(q),
 	}
 
 	if err := fn(ctx, repos); err != nil {
@@ -2,6 +2,8 @@ package db
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 
 	"github.com/antonkarounis/stoic/internal/adapters/db/gen"
 	"github.com/antonkarounis/stoic/internal/domain/models"
@@ -21,12 +23,30 @@ func NewUserRepository(q *gen.Queries) *UserRepository {
 
 // Save implements [ports.UserRepository].
 func (r *UserRepository) Save(ctx context.Context, user models.User) error {
+	attributes := []byte("{}")
+	if len(user.Attributes) > 0 {
+		var err error
+		if attributes, err = json.Marshal(user.Attributes); err != nil {
+			return fmt.Errorf("marshaling user attributes: %w", err)
+		}
+	}
+
 	return r.queries.UpsertUser(ctx, gen.UpsertUserParams{
-		ID:          string(user.ID),
-		Name:        user.Name,
-		Email:       user.Email,
-		Role:        string(user.Role),
-		CreatedAt:   pgtype.Timestamptz{Time: user.CreatedAt, Valid: true},
+		ID:         string(user.ID),
+		Name:       user.Name,
+		Email:      user.Email,
+		Role:       string(user.Role),
+		TenantID:   pgtype.Text{String: user.TenantID, Valid: user.TenantID != ""},
+		Attributes: attributes,
+		CreatedAt:  pgtype.Timestamptz{Time: user.CreatedAt, Valid: true},
+	})
+}
+
+// UpdateDisplayName implements [ports.UserRepository].
+func (r *UserRepository) UpdateDisplayName(ctx context.Context, id models.UserID, name string) error {
+	return r.queries.UpdateUserDisplayName(ctx, gen.UpdateUserDisplayNameParams{
+		ID:   string(id),
+		Name: name,
 	})
 }
 
@@ -36,13 +56,7 @@ func (r *UserRepository) FindByID(ctx context.Context, id models.UserID) (models
 	if err != nil {
 		return models.User{}, mapErr(err)
 	}
-	return models.User{
-		ID:        models.UserID(row.ID),
-		Name:      row.Name,
-		Email:     row.Email,
-		Role:      models.Role(row.Role),
-		CreatedAt: row.CreatedAt.Time,
-	}, nil
+	return userFromRow(row)
 }
 
 // FindByEmail implements [ports.UserRepository].
@@ -51,11 +65,49 @@ func (r *UserRepository) FindByEmail(ctx context.Context, email string) (models.
 	if err != nil {
 		return models.User{}, mapErr(err)
 	}
-	return models.User{
-		ID:        models.UserID(row.ID),
-		Name:      row.Name,
-		Email:     row.Email,
-		Role:      models.Role(row.Role),
-		CreatedAt: row.CreatedAt.Time,
-	}, nil
+	return userFromRow(row)
+}
+
+// FindByAttributes implements [ports.UserRepository].
+func (r *UserRepository) FindByAttributes(ctx context.Context, attrs map[string]any, limit, offset int) ([]models.User, error) {
+	filter, err := json.Marshal(attrs)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling attribute filter: %w", err)
+	}
+	rows, err := r.queries.ListUsersByAttributes(ctx, gen.ListUsersByAttributesParams{
+		Attributes: filter,
+		Limit:      int32(limit),
+		Offset:     int32(offset),
+	})
+	if err != nil {
+		return nil, mapErr(err)
+	}
+
+	users := make([]models.User, 0, len(rows))
+	for _, row := range rows {
+		user, err := userFromRow(row)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func userFromRow(row gen.User) (models.User, error) {
+	user := models.User{
+		ID:             models.UserID(row.ID),
+		Name:           row.Name,
+		Email:          row.Email,
+		Role:           models.Role(row.Role),
+		TenantID:       row.TenantID.String,
+		NameCustomized: row.NameCustomized,
+		CreatedAt:      row.CreatedAt.Time,
+	}
+	if len(row.Attributes) > 0 {
+		if err := json.Unmarshal(row.Attributes, &user.Attributes); err != nil {
+			return models.User{}, fmt.Errorf("unmarshaling user attributes: %w", err)
+		}
+	}
+	return user, nil
 }
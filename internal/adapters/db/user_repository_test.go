@@ -0,0 +1,55 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/antonkarounis/stoic/internal/domain/models"
+)
+
+func TestSaveKeepsCustomizedDisplayName(t *testing.T) {
+	tests := []struct {
+		name       string
+		customize  bool
+		wantName   string
+		wantCustom bool
+	}{
+		{"provider name is refreshed", false, "Alice Provider", false},
+		{"customized name is kept", true, "Ally", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := NewUserRepository(newTestQueries(t))
+
+			user := models.User{ID: "u1", Name: "Alice", Email: "alice@example.com", Role: models.RoleMember, CreatedAt: time.Now()}
+			if err := repo.Save(ctx, user); err != nil {
+				t.Fatal(err)
+			}
+			if tt.customize {
+				if err := repo.UpdateDisplayName(ctx, user.ID, "Ally"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// the next login syncs the profile from the provider's claims
+			user.Name = "Alice Provider"
+			user.Email = "alice@corp.example.com"
+			if err := repo.Save(ctx, user); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := repo.FindByID(ctx, user.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Name != tt.wantName || got.NameCustomized != tt.wantCustom {
+				t.Errorf("name = %q (customized %v), want %q (customized %v)", got.Name, got.NameCustomized, tt.wantName, tt.wantCustom)
+			}
+			if got.Email != "alice@corp.example.com" {
+				t.Errorf("email = %q, want it refreshed from the provider", got.Email)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+// Package memory implements ports repositories in process memory. Nothing survives a
+// restart and nothing is shared between instances, so these suit tests and single-process
+// development rather than production.
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/antonkarounis/stoic/internal/domain/models"
+	"github.com/antonkarounis/stoic/internal/domain/ports"
+)
+
+// SessionRepository is a [ports.SessionRepository] backed by a map, for running the app or
+// its tests without Postgres. Like the Postgres repository it stores only the encrypted
+// token data, ID token, identity and expiry; the remaining session fields are derived by
+// the caller. Expired sessions are never returned, but stay in memory until removed by
+// DeleteExpiredSessions or the sweep started with StartSweep.
+type SessionRepository struct {
+	identities ports.IdentityRepository
+
+	mu        sync.Mutex
+	sessions  map[string]models.SessionData
+	stopSweep func() // stops the sweep and waits for it; nil if none is running
+}
+
+// defaultSweepInterval matches how often services.StartSessionCleanup runs.
+const defaultSweepInterval = 5 * time.Minute
+
+var _ ports.SessionRepository = (*SessionRepository)(nil)
+
+// NewSessionRepository returns an empty SessionRepository. identities resolves the user
+// behind each session's identity for DeleteSessionsByUser.
+func NewSessionRepository(identities ports.IdentityRepository) *SessionRepository {
+	return &SessionRepository{
+		identities: identities,
+		sessions:   make(map[string]models.SessionData),
+	}
+}
+
+// StartSweep removes expired sessions every interval, as services.StartSessionCleanup does
+// for Postgres, until ctx is done or Close is called. An interval of zero or less uses 5
+// minutes. Starting a sweep stops any previous one.
+func (s *SessionRepository) StartSweep(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultSweepInterval
+	}
+	s.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.sweep(time.Now())
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	s.mu.Lock()
+	s.stopSweep = func() {
+		cancel()
+		<-done
+	}
+	s.mu.Unlock()
+}
+
+// Close stops the sweep started with StartSweep and waits for it to return. The sessions
+// stay readable. Close always returns nil.
+func (s *SessionRepository) Close() error {
+	s.mu.Lock()
+	stop := s.stopSweep
+	s.stopSweep = nil
+	s.mu.Unlock()
+	if stop != nil {
+		stop()
+	}
+	return nil
+}
+
+// sweep removes every session expired at now and returns how many it removed.
+func (s *SessionRepository) sweep(now time.Time) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var deleted int64
+	for sessionID, session := range s.sessions {
+		if !session.Expires.After(now) {
+			delete(s.sessions, sessionID)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// CreateSession implements [ports.SessionRepository].
+func (s *SessionRepository) CreateSession(ctx context.Context, sessionID string, session models.SessionData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[sessionID] = models.SessionData{
+		IDToken:    session.IDToken,
+		IdentityID: session.IdentityID,
+		Expires:    session.Expires,
+		TokenData:  slices.Clone(session.TokenData),
+	}
+	return nil
+}
+
+// DeleteSession implements [ports.SessionRepository].
+func (s *SessionRepository) DeleteSession(ctx context.Context, sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, sessionID)
+	return nil
+}
+
+// DeleteSessionsByUser implements [ports.SessionRepository].
+func (s *SessionRepository) DeleteSessionsByUser(ctx context.Context, userID models.UserID) (int64, error) {
+	s.mu.Lock()
+	identityIDs := make(map[int64]bool)
+	for _, session := range s.sessions {
+		identityIDs[session.IdentityID] = false
+	}
+	s.mu.Unlock()
+
+	// resolve identities without holding the lock, since the lookup may block
+	for id := range identityIDs {
+		identity, err := s.identities.GetIdentityByID(ctx, id)
+		if errors.Is(err, ports.ErrNotFound) {
+			continue // a deleted identity's sessions belong to no user
+		}
+		if err != nil {
+			return 0, fmt.Errorf("resolving identity %d: %w", id, err)
+		}
+		identityIDs[id] = identity.UserID != nil && *identity.UserID == userID
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var deleted int64
+	for sessionID, session := range s.sessions {
+		if identityIDs[session.IdentityID] {
+			delete(s.sessions, sessionID)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// GetSession implements [ports.SessionRepository]. Expired sessions are reported as
+// [ports.ErrNotFound], even before the cleanup has removed them.
+func (s *SessionRepository) GetSession(ctx context.Context, sessionID string) (*models.SessionData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[sessionID]
+	if !ok || !session.Expires.After(time.Now()) {
+		return nil, ports.ErrNotFound
+	}
+	session.TokenData = slices.Clone(session.TokenData)
+	return &session, nil
+}
+
+// UpdateSessionToken implements [ports.SessionRepository].
+func (s *SessionRepository) UpdateSessionToken(ctx context.Context, sessionID string, session models.SessionData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.sessions[sessionID]
+	if !ok {
+		return nil
+	}
+	stored.TokenData = slices.Clone(session.TokenData)
+	s.sessions[sessionID] = stored
+	return nil
+}
+
+// UpdateSessionExpiry implements [ports.SessionRepository].
+func (s *SessionRepository) UpdateSessionExpiry(ctx context.Context, sessionID string, expires time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.sessions[sessionID]
+	if !ok {
+		return nil
+	}
+	stored.Expires = expires
+	s.sessions[sessionID] = stored
+	return nil
+}
+
+// DeleteExpiredSessions implements [ports.SessionRepository].
+func (s *SessionRepository) DeleteExpiredSessions(ctx context.Context, limit int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var deleted int64
+	for sessionID, session := range s.sessions {
+		if deleted >= int64(limit) {
+			break
+		}
+		if session.Expires.Before(now) {
+			delete(s.sessions, sessionID)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
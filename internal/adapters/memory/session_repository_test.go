@@ -0,0 +1,226 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/antonkarounis/stoic/internal/domain/models"
+	"github.com/antonkarounis/stoic/internal/domain/ports"
+)
+
+// identities is a fixed ports.IdentityRepository mapping identity IDs to users.
+type identities map[int64]models.UserID
+
+func (ids identities) GetIdentityByID(ctx context.Context, identityID int64) (models.Identity, error) {
+	userID, ok := ids[identityID]
+	if !ok {
+		return models.Identity{}, ports.ErrNotFound
+	}
+	return models.Identity{ID: identityID, UserID: &userID}, nil
+}
+
+func (ids identities) GetIdentityBySub(ctx context.Context, authSub string) (models.Identity, error) {
+	return models.Identity{}, ports.ErrNotFound
+}
+
+func (ids identities) UpsertIdentity(ctx context.Context, authSub string) (models.Identity, error) {
+	return models.Identity{}, errors.New("not supported")
+}
+
+func (ids identities) LinkUser(ctx context.Context, identityID int64, userID models.UserID) error {
+	return errors.New("not supported")
+}
+
+func TestGetSessionHidesExpired(t *testing.T) {
+	ctx := context.Background()
+	repo := NewSessionRepository(identities{})
+
+	if err := repo.CreateSession(ctx, "live", models.SessionData{IdentityID: 1, Expires: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CreateSession(ctx, "expired", models.SessionData{IdentityID: 1, Expires: time.Now().Add(-time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repo.GetSession(ctx, "live"); err != nil {
+		t.Errorf("GetSession(live) = %v", err)
+	}
+	if _, err := repo.GetSession(ctx, "expired"); !errors.Is(err, ports.ErrNotFound) {
+		t.Errorf("GetSession(expired) = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSweepRemovesExpiredSessions(t *testing.T) {
+	ctx := context.Background()
+	repo := NewSessionRepository(identities{})
+	defer repo.Close()
+
+	if err := repo.CreateSession(ctx, "live", models.SessionData{Expires: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CreateSession(ctx, "expired", models.SessionData{Expires: time.Now().Add(-time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+
+	repo.StartSweep(ctx, time.Millisecond)
+	deadline := time.Now().Add(5 * time.Second)
+	for sessionCount(repo) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("sweep left %d sessions, want 1", sessionCount(repo))
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := repo.GetSession(ctx, "live"); err != nil {
+		t.Errorf("sweep removed a live session: %v", err)
+	}
+}
+
+func TestCloseStopsSweep(t *testing.T) {
+	ctx := context.Background()
+	repo := NewSessionRepository(identities{})
+
+	repo.StartSweep(ctx, time.Millisecond)
+	if err := repo.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.CreateSession(ctx, "expired", models.SessionData{Expires: time.Now().Add(-time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := sessionCount(repo); n != 1 {
+		t.Errorf("sweep ran after Close: %d sessions left, want 1", n)
+	}
+}
+
+func TestSweepStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	repo := NewSessionRepository(identities{})
+
+	repo.StartSweep(ctx, time.Millisecond)
+	cancel()
+	// Close waits for the sweep goroutine, so this hangs if it ignored ctx
+	done := make(chan struct{})
+	go func() {
+		repo.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sweep did not stop when ctx was cancelled")
+	}
+}
+
+func TestDeleteSessionsByUser(t *testing.T) {
+	ctx := context.Background()
+	repo := NewSessionRepository(identities{1: "alice", 2: "alice", 3: "bob"})
+	for i, identityID := range []int64{1, 2, 3} {
+		if err := repo.CreateSession(ctx, fmt.Sprint("session-", i), models.SessionData{IdentityID: identityID, Expires: time.Now().Add(time.Hour)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deleted, err := repo.DeleteSessionsByUser(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 2 {
+		t.Errorf("deleted %d sessions, want 2", deleted)
+	}
+	if _, err := repo.GetSession(ctx, "session-2"); err != nil {
+		t.Errorf("bob's session was removed: %v", err)
+	}
+}
+
+// unavailableIdentities is identities whose lookups fail, as in a database outage.
+type unavailableIdentities struct{ identities }
+
+func (unavailableIdentities) GetIdentityByID(ctx context.Context, identityID int64) (models.Identity, error) {
+	return models.Identity{}, ports.ErrUnavailable
+}
+
+func TestDeleteSessionsByUserSkipsDeletedIdentities(t *testing.T) {
+	ctx := context.Background()
+	repo := NewSessionRepository(identities{1: "alice"})
+	for i, identityID := range []int64{1, 99} { // identity 99 no longer exists
+		if err := repo.CreateSession(ctx, fmt.Sprint("session-", i), models.SessionData{IdentityID: identityID, Expires: time.Now().Add(time.Hour)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if deleted, err := repo.DeleteSessionsByUser(ctx, "alice"); err != nil || deleted != 1 {
+		t.Errorf("deleted %d sessions (%v), want 1", deleted, err)
+	}
+}
+
+func TestDeleteSessionsByUserFailsWhenIdentitiesAreUnavailable(t *testing.T) {
+	ctx := context.Background()
+	repo := NewSessionRepository(unavailableIdentities{identities{1: "alice"}})
+	if err := repo.CreateSession(ctx, "session-0", models.SessionData{IdentityID: 1, Expires: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := repo.DeleteSessionsByUser(ctx, "alice")
+	if !errors.Is(err, ports.ErrUnavailable) {
+		t.Errorf("err = %v, want %v", err, ports.ErrUnavailable)
+	}
+	if deleted != 0 {
+		t.Errorf("deleted %d sessions, want none", deleted)
+	}
+	if _, err := repo.GetSession(ctx, "session-0"); err != nil {
+		t.Errorf("session removed despite the failure: %v", err)
+	}
+}
+
+// TestConcurrentAccess hammers the repository from many goroutines; run it with -race.
+func TestConcurrentAccess(t *testing.T) {
+	ctx := context.Background()
+	repo := NewSessionRepository(identities{1: "alice"})
+	repo.StartSweep(ctx, time.Millisecond)
+	defer repo.Close()
+
+	const workers, iterations = 16, 200
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range iterations {
+				id := fmt.Sprintf("session-%d", (w*iterations+i)%50)
+				expires := time.Now().Add(time.Duration(i%3-1) * time.Second) // some already expired
+				session := models.SessionData{IdentityID: 1, Expires: expires, TokenData: []byte(id)}
+
+				if err := repo.CreateSession(ctx, id, session); err != nil {
+					t.Error(err)
+					return
+				}
+				before := time.Now()
+				if got, err := repo.GetSession(ctx, id); err == nil && !got.Expires.After(before) {
+					t.Errorf("GetSession returned expired session %s", id)
+				}
+				_ = repo.UpdateSessionToken(ctx, id, session)
+				_ = repo.UpdateSessionExpiry(ctx, id, time.Now().Add(time.Minute))
+				switch i % 10 {
+				case 0:
+					_ = repo.DeleteSession(ctx, id)
+				case 1:
+					_, _ = repo.DeleteExpiredSessions(ctx, 10)
+				case 2:
+					_, _ = repo.DeleteSessionsByUser(ctx, "alice")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func sessionCount(repo *SessionRepository) int {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	return len(repo.sessions)
+}
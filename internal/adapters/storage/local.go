@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/antonkarounis/stoic/internal/domain/ports"
+)
+
+// LocalStore is a [ports.BlobStore] that keeps each blob as a file below a root directory.
+// All access goes through os.Root, so no key, symlink included, can reach outside it.
+type LocalStore struct {
+	dir     string
+	baseURL string
+}
+
+var _ ports.BlobStore = (*LocalStore)(nil)
+
+// NewLocalStore returns a LocalStore rooted at dir, creating it if needed. baseURL is the
+// prefix URL returns keys under; the app must serve dir there itself.
+func NewLocalStore(dir, baseURL string) (*LocalStore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("local blob storage needs a directory")
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("creating blob directory: %w", err)
+	}
+	return &LocalStore{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+// Put implements [ports.BlobStore]. The content is written to a temporary file and renamed
+// into place, so readers never see a partial blob. contentType is not stored; serve local
+// blobs with a type derived from the key's extension.
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	root, err := os.OpenRoot(s.dir)
+	if err != nil {
+		return fmt.Errorf("opening blob directory: %w", err)
+	}
+	defer root.Close()
+
+	if dir := path.Dir(key); dir != "." {
+		if err := root.MkdirAll(dir, 0o750); err != nil {
+			return fmt.Errorf("creating %s: %w", dir, err)
+		}
+	}
+
+	if err := root.MkdirAll(tmpDir, 0o750); err != nil {
+		return fmt.Errorf("creating %s: %w", tmpDir, err)
+	}
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Errorf("generating temporary name: %w", err)
+	}
+	tmp := tmpDir + "/" + hex.EncodeToString(suffix)
+	f, err := root.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o640)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", key, err)
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		root.Remove(tmp) //nolint:errcheck
+		return fmt.Errorf("writing %s: %w", key, err)
+	}
+	if err := f.Close(); err != nil {
+		root.Remove(tmp) //nolint:errcheck
+		return fmt.Errorf("writing %s: %w", key, err)
+	}
+	if err := root.Rename(tmp, key); err != nil {
+		root.Remove(tmp) //nolint:errcheck
+		return fmt.Errorf("storing %s: %w", key, err)
+	}
+	return nil
+}
+
+// Get implements [ports.BlobStore].
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+	root, err := os.OpenRoot(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("opening blob directory: %w", err)
+	}
+	defer root.Close()
+
+	f, err := root.Open(key)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ports.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", key, err)
+	}
+	return f, nil
+}
+
+// Delete implements [ports.BlobStore].
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	root, err := os.OpenRoot(s.dir)
+	if err != nil {
+		return fmt.Errorf("opening blob directory: %w", err)
+	}
+	defer root.Close()
+
+	if err := root.Remove(key); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("deleting %s: %w", key, err)
+	}
+	return nil
+}
+
+// URL implements [ports.BlobStore].
+func (s *LocalStore) URL(ctx context.Context, key string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	if s.baseURL == "" {
+		return "", fmt.Errorf("local blob storage has no base URL")
+	}
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return s.baseURL + "/" + strings.Join(segments, "/"), nil
+}
+
+// tmpDir holds Put's in-progress writes, on the same filesystem so the final rename is atomic.
+const tmpDir = ".tmp"
+
+// validateKey accepts unrooted slash-separated keys without "." or ".." elements, outside
+// tmpDir, and without backslashes that Windows would treat as separators.
+func validateKey(key string) error {
+	if !fs.ValidPath(key) || key == "." || strings.Contains(key, `\`) || key == tmpDir || strings.HasPrefix(key, tmpDir+"/") {
+		return fmt.Errorf("invalid blob key %q: %w", key, ports.ErrInvalidInput)
+	}
+	return nil
+}
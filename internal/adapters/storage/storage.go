@@ -0,0 +1,36 @@
+// Package storage implements [ports.BlobStore] backends.
+//
+// The local backend keeps blobs on the server's filesystem. It needs no extra service and
+// is the right choice for development and single-instance deploys, but its files exist on
+// one machine only: running several instances, or on ephemeral disks, needs a shared
+// volume or a remote backend. Blobs are served by the app itself, so large downloads
+// occupy app connections.
+//
+// Remote, S3-compatible backends share blobs across instances and survive redeploys, and
+// can hand out URLs that clients fetch from the object store directly, at the cost of a
+// network round trip per operation and another service to run. Add one by implementing
+// [ports.BlobStore] and a case in New.
+package storage
+
+import (
+	"fmt"
+
+	"github.com/antonkarounis/stoic/internal/domain/ports"
+)
+
+// Config selects and configures a backend.
+type Config struct {
+	Driver   string // "local" (the default); remote backends are added here
+	LocalDir string // root directory of the local backend
+	BaseURL  string // URL prefix blobs are served under; empty disables URL
+}
+
+// New returns the backend selected by cfg.Driver.
+func New(cfg Config) (ports.BlobStore, error) {
+	switch cfg.Driver {
+	case "", "local":
+		return NewLocalStore(cfg.LocalDir, cfg.BaseURL)
+	default:
+		return nil, fmt.Errorf("unknown blob storage driver %q", cfg.Driver)
+	}
+}
@@ -5,21 +5,29 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/antonkarounis/stoic/internal/adapters/web/framework"
 	"github.com/antonkarounis/stoic/internal/domain/models"
 	"github.com/antonkarounis/stoic/internal/domain/ports"
 	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-jose/go-jose/v4"
 	"golang.org/x/oauth2"
+	"golang.org/x/sync/singleflight"
 )
 
 // AuthConfig contains only auth-specific configuration, decoupling core/auth from infrastructure concerns
@@ -31,75 +39,355 @@ type AuthConfig struct {
 	AppURL           string
 	SecretKey        []byte
 	IsDev            bool
+
+	// Scopes overrides the requested OAuth2 scopes (default: openid, profile, email).
+	// openid is added when missing, since without it the provider issues no ID token.
+	Scopes []string
+	// AuthParams are extra raw query parameters added to the authorization URL.
+	AuthParams map[string]string
+	// RequestRefreshToken asks the provider for a refresh token so RefreshToken keeps
+	// working after the access token expires. Most providers need the offline_access
+	// scope; Google instead ignores that scope and requires access_type=offline (plus
+	// prompt=consent, since Google only issues a refresh token on the first consent).
+	RequestRefreshToken bool
+
+	// BearerAuth lets non-browser clients authenticate with "Authorization: Bearer <token>"
+	// instead of a session cookie. The token is checked by the same verifier as ID tokens
+	// at login, so it must be a JWT from the issuer with OIDCClientID as audience, and its
+	// subject must have logged in through the browser once so the identity exists. Nothing
+	// is stored: the session lives for the request only.
+	BearerAuth bool
+
+	// SessionClaims limits which top-level ID token claims are kept on the session
+	// (see SessionData.Claim). Empty keeps every verified claim.
+	SessionClaims []string
+
+	// UserAttributeClaims names top-level ID token claims (e.g. "employee_id",
+	// "department") copied into the user's attributes on every login; see
+	// LoginInfo.Attributes. Missing claims are left out.
+	UserAttributeClaims []string
+
+	// TenantClaim names the ID token claim (e.g. "org_id") holding the tenant for
+	// multi-tenant apps. Empty disables tenant extraction.
+	TenantClaim string
+
+	// GroupsClaim names the ID token claim (e.g. "groups") listing the user's group
+	// memberships, as issued by Okta and Azure AD. Empty disables group extraction.
+	// Groups are stored alongside roles and never replace them: RequireGroup checks only
+	// groups, role checks only roles, and a route guarded by both requires both.
+	GroupsClaim string
+
+	// RoleAllowlist keeps only the listed roles on the session, so enterprise realms with
+	// hundreds of roles don't bloat the encrypted session blob. Empty keeps every role.
+	RoleAllowlist []string
+	// MaxRoles caps how many roles are stored after allowlist filtering; 0 means no cap.
+	MaxRoles int
+	// RoleRefreshInterval is how often a token refresh also re-reads roles, groups and
+	// session claims, from the refreshed ID token or else the userinfo endpoint, so a
+	// long-lived session picks up entitlement changes made at the provider. Checks only
+	// happen on refresh, so the effective interval is at least the access token lifetime.
+	// Zero re-reads them on every refresh; a negative value keeps the login-time values.
+	RoleRefreshInterval time.Duration
+
+	// PublicOrigin builds the redirect_uri sent to the provider; nil bases it on AppURL
+	// alone. With trusted hosts, register the callback URL of each host with the provider.
+	PublicOrigin *framework.PublicOrigin
+
+	// Cookies names the auth cookies and sets their attributes; nil uses the defaults of
+	// framework.NewCookies. With SameSite "strict" the oauth_state, oauth_nonce and
+	// login_return_to cookies stay Lax, since the provider's redirect to /callback is
+	// cross-site. Its SameSiteCompat option omits SameSite on the auth cookies for browsers
+	// known to mishandle it (iOS 12, Safari on macOS 10.14, Chrome 51-66, old UC Browser),
+	// which otherwise drop the cookies or loop on login. Those browsers are detected by
+	// User-Agent from a fixed list, so leave it off unless such clients are in use.
+	Cookies *framework.Cookies
+
+	// AllowedEmailDomains admits only users whose email domain matches one of the entries;
+	// empty admits every domain. DeniedEmailDomains rejects matching domains and takes
+	// precedence. Matching is case-insensitive, and "*.example.com" matches any subdomain
+	// of example.com (list "example.com" as well to admit the apex).
+	AllowedEmailDomains []string
+	DeniedEmailDomains  []string
+
+	// SessionTTL is the lifetime of a login session. Both the session row's expiry and the
+	// session cookie's MaxAge are derived from it so the two cannot drift apart.
+	// Zero uses defaultSessionTTL.
+	SessionTTL time.Duration
+	// SessionSliding extends an active session back to the full SessionTTL, so users are
+	// only logged out after SessionTTL of inactivity. To bound the writes, a session is
+	// extended at most once per SessionSlidingInterval: when its remaining lifetime drops
+	// below SessionTTL minus the interval. Zero uses defaultSessionSlidingInterval.
+	SessionSliding         bool
+	SessionSlidingInterval time.Duration
+
+	// LoginMaxFailures locks an account out of login for LoginLockout once that many
+	// callbacks for it fail within LoginFailureWindow; 0 disables the limit. Accounts are
+	// keyed by subject and by email, and a successful login clears their count.
+	//
+	// The provider already throttles password guessing, so this targets what reaches the
+	// app after it: a failure counts only once the ID token is verified and names an
+	// account, e.g. a replayed or injected callback failing the nonce check, or logins
+	// denied by the email domain or provisioning rules. Failures of the app itself, such as
+	// a database error, do not count. Use it for providers whose own lockout policy cannot
+	// be configured.
+	LoginMaxFailures   int
+	LoginFailureWindow time.Duration // zero uses defaultLoginFailureWindow
+	LoginLockout       time.Duration // zero uses defaultLoginLockout
+	// RateLimits stores the failure counts and lockouts. Nil keeps them in memory, so each
+	// instance of a multi-instance deployment counts only the callbacks it handles; pass
+	// db.RateLimitRepository to enforce the limit across all of them. If the store fails,
+	// logins go ahead unlimited rather than being blocked.
+	RateLimits ports.RateLimitRepository
+
+	// DiscoveryDocument, if set, is the provider's OpenID discovery document
+	// (/.well-known/openid-configuration) and replaces the network fetch at startup, for
+	// air-gapped or flaky networks and faster boots. It may carry the provider's key set
+	// inline as a "jwks" member; without it keys are fetched lazily from jwks_uri on the
+	// first login. Its issuer must equal OIDCIssuerURL.
+	//
+	// The tradeoff: the document is not refreshed. When the provider changes endpoints or
+	// rotates its signing keys, the local copy must be updated or logins will fail.
+	DiscoveryDocument []byte
 }
 
+const googleIssuerURL = "https://accounts.google.com"
+
+const defaultSessionTTL = 24 * time.Hour
+
+const defaultSessionSlidingInterval = 5 * time.Minute
+
+const (
+	defaultLoginFailureWindow = 15 * time.Minute
+	defaultLoginLockout       = 15 * time.Minute
+)
+
 // Claims are the provider-independent OIDC claims (sub, email, name).
 type oidcClaims struct {
-	Sub   string `json:"sub"`
-	Email string `json:"email"`
-	Name  string `json:"name"`
+	Sub           string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified *bool  `json:"email_verified"`
+	Name          string `json:"name"`
+	Nonce         string `json:"nonce"`
 }
 
 // AuthService encapsulates all authentication state and operations.
 type AuthService struct {
 	provider             *oidc.Provider
 	oauth2Config         oauth2.Config
+	authCodeOptions      []oauth2.AuthCodeOption
 	verifier             *oidc.IDTokenVerifier
 	sessionManager       ports.SessionRepository
 	identityManager      ports.IdentityRepository
+	audit                ports.AuditRepository
 	cfg                  *AuthConfig
+	keys                 framework.Keys // derived from cfg.SecretKey
 	roleExtractor        RoleExtractor
+	tenantExtractor      TenantExtractor
+	tokenSource          TokenSourceFactory
+	groupExtractor       GroupExtractor
 	loginRedirect        string
 	loginFailureRedirect string
-	onFirstLogin         func(ctx context.Context, email, name string) (models.UserID, error)
-	onLogin              func(ctx context.Context, userID models.UserID, email, name string) error
+	accessDeniedRedirect string
+	forbiddenHandler     http.HandlerFunc
+	unavailableHandler   http.HandlerFunc
+	onFirstLogin         func(ctx context.Context, info LoginInfo) (models.UserID, error)
+	onLogin              func(ctx context.Context, userID models.UserID, info LoginInfo) error
+	loginLimiter         *loginLimiter // nil unless cfg.LoginMaxFailures is set
+
+	refreshes         singleflight.Group
+	recentRefreshesMu sync.Mutex
+	recentRefreshes   map[string]refreshedToken
+
+	decryptFailuresMu      sync.Mutex
+	decryptFailures        int // since decryptFailureLoggedAt
+	decryptFailureLoggedAt time.Time
+}
+
+// LoginInfo is the provider-derived profile passed to the login hooks.
+type LoginInfo struct {
+	Email      string
+	Name       string
+	TenantID   string         // empty unless a TenantExtractor is configured
+	Attributes map[string]any // the UserAttributeClaims present in the ID token
 }
 
+// TokenSourceFactory returns the source RefreshToken obtains a new token from, given the
+// session's current token. The default is the OAuth2 config's TokenSource, which calls the
+// provider's token endpoint; replace it with SetTokenSourceFactory to simulate refreshes.
+type TokenSourceFactory func(ctx context.Context, token *oauth2.Token) oauth2.TokenSource
+
 // RoleExtractor extracts roles from raw OIDC claims.
 // The default implementation handles Keycloak realm_access and resource_access claims.
-// Replace with a custom function for other OIDC providers (Auth0, Okta, etc.).
+// Replace it with SetRoleExtractor for other OIDC providers (Auth0, Okta, etc.).
 type RoleExtractor func(rawClaims json.RawMessage, clientID string) ([]string, error)
 
+// TenantExtractor extracts the tenant identifier from raw OIDC claims.
+// Like RoleExtractor, replace it to match how your provider conveys organizations.
+type TenantExtractor func(rawClaims json.RawMessage) (string, error)
+
+// GroupExtractor extracts group memberships from raw OIDC claims.
+// Like RoleExtractor, replace it to match how your provider conveys groups.
+type GroupExtractor func(rawClaims json.RawMessage) ([]string, error)
+
 // tokenData is the JSON-serializable representation stored in sessions.token_data
 type tokenData struct {
-	AccessToken  string    `json:"access_token"`
-	TokenType    string    `json:"token_type"`
-	RefreshToken string    `json:"refresh_token"`
-	Expiry       time.Time `json:"expiry"`
-	Roles        []string  `json:"roles"`
+	AccessToken  string          `json:"access_token"`
+	TokenType    string          `json:"token_type"`
+	RefreshToken string          `json:"refresh_token"`
+	Expiry       time.Time       `json:"expiry"`
+	Roles        []string        `json:"roles"`
+	Groups       []string        `json:"groups,omitempty"`
+	TenantID     string          `json:"tenant_id,omitempty"`
+	Claims       json.RawMessage `json:"claims,omitempty"`
+	Scopes       []string        `json:"scopes,omitempty"`
+	VerifiedAt   time.Time       `json:"verified_at,omitzero"`
 }
 
 func NewAuthService(ctx context.Context, cfg *AuthConfig, sessionManager ports.SessionRepository, identityManager ports.IdentityRepository) (*AuthService, error) {
-	provider, err := connectOIDCProvider(ctx, cfg.OIDCIssuerURL)
+	verifierConfig := &oidc.Config{
+		ClientID: cfg.OIDCClientID,
+	}
+
+	var provider *oidc.Provider
+	var verifier *oidc.IDTokenVerifier
+	var err error
+	if len(cfg.DiscoveryDocument) > 0 {
+		provider, verifier, err = staticOIDCProvider(ctx, cfg.OIDCIssuerURL, cfg.DiscoveryDocument, verifierConfig)
+	} else {
+		provider, err = connectOIDCProvider(ctx, cfg.OIDCIssuerURL)
+		if err == nil {
+			verifier = provider.Verifier(verifierConfig)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.SessionTTL == 0 {
+		cfg.SessionTTL = defaultSessionTTL
+	}
+	if err := validateSessionTTL(cfg.SessionTTL); err != nil {
+		return nil, err
+	}
+	if cfg.SessionSlidingInterval == 0 {
+		cfg.SessionSlidingInterval = defaultSessionSlidingInterval
+	}
+	if cfg.SessionSliding && (cfg.SessionSlidingInterval < 0 || cfg.SessionSlidingInterval >= cfg.SessionTTL) {
+		return nil, fmt.Errorf("session sliding interval must be positive and shorter than the session TTL, got %s", cfg.SessionSlidingInterval)
+	}
+
+	if cfg.LoginFailureWindow == 0 {
+		cfg.LoginFailureWindow = defaultLoginFailureWindow
+	}
+	if cfg.LoginLockout == 0 {
+		cfg.LoginLockout = defaultLoginLockout
+	}
+	if cfg.LoginMaxFailures < 0 || cfg.LoginFailureWindow < 0 || cfg.LoginLockout < 0 {
+		return nil, errors.New("login max failures, failure window and lockout must not be negative")
+	}
+
+	keys, err := framework.DeriveKeys(cfg.SecretKey)
 	if err != nil {
 		return nil, err
 	}
 
+	if cfg.Cookies == nil {
+		cookies, err := framework.NewCookies(ports.CookieConfig{}, cfg.AppURL)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Cookies = cookies
+	}
+
+	if cfg.PublicOrigin == nil {
+		origin, err := framework.NewPublicOrigin(cfg.AppURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		cfg.PublicOrigin = origin
+	}
+
+	scopes, authCodeOptions := authRequestOptions(cfg)
+
 	oauth2Config := oauth2.Config{
 		ClientID:     cfg.OIDCClientID,
 		ClientSecret: cfg.OIDCClientSecret,
 		RedirectURL:  cfg.AppURL + "/callback",
 		Endpoint:     provider.Endpoint(),
-		Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+		Scopes:       scopes,
 	}
 
-	verifier := provider.Verifier(&oidc.Config{
-		ClientID: cfg.OIDCClientID,
-	})
+	var tenantExtractor TenantExtractor
+	if cfg.TenantClaim != "" {
+		tenantExtractor = ClaimTenantExtractor(cfg.TenantClaim)
+	}
+
+	var groupExtractor GroupExtractor
+	if cfg.GroupsClaim != "" {
+		groupExtractor = ClaimGroupExtractor(cfg.GroupsClaim)
+	}
 
-	return &AuthService{
+	s := &AuthService{
 		provider:        provider,
 		oauth2Config:    oauth2Config,
+		authCodeOptions: authCodeOptions,
 		verifier:        verifier,
 		sessionManager:  sessionManager,
 		identityManager: identityManager,
 		cfg:             cfg,
 		roleExtractor:   KeycloakRoleExtractor,
-	}, nil
+		tenantExtractor: tenantExtractor,
+		groupExtractor:  groupExtractor,
+		recentRefreshes: map[string]refreshedToken{},
+		keys:            keys,
+		loginLimiter:    newLoginLimiter(cfg.RateLimits, cfg.LoginMaxFailures, cfg.LoginFailureWindow, cfg.LoginLockout),
+	}
+	s.tokenSource = s.oauth2Config.TokenSource
+	return s, nil
+}
+
+// validateSessionTTL checks that ttl maps exactly onto a cookie MaxAge, which has whole-second
+// resolution; anything else would let the cookie and the session row expire at different times.
+func validateSessionTTL(ttl time.Duration) error {
+	if ttl < time.Second {
+		return fmt.Errorf("session TTL must be at least 1s, got %s", ttl)
+	}
+	if ttl%time.Second != 0 {
+		return fmt.Errorf("session TTL must be a whole number of seconds, got %s", ttl)
+	}
+	return nil
+}
+
+// authRequestOptions resolves the scopes and extra authorization URL parameters from the config,
+// applying the provider-specific way of requesting a refresh token when RequestRefreshToken is set.
+func authRequestOptions(cfg *AuthConfig) ([]string, []oauth2.AuthCodeOption) {
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "profile", "email"}
+	}
+	scopes = append([]string(nil), scopes...)
+	if !slices.Contains(scopes, oidc.ScopeOpenID) {
+		scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+	}
+
+	var opts []oauth2.AuthCodeOption
+	for key, value := range cfg.AuthParams {
+		opts = append(opts, oauth2.SetAuthURLParam(key, value))
+	}
+
+	if cfg.RequestRefreshToken {
+		if strings.TrimSuffix(cfg.OIDCIssuerURL, "/") == googleIssuerURL {
+			opts = append(opts, oauth2.AccessTypeOffline, oauth2.SetAuthURLParam("prompt", "consent"))
+		} else if !slices.Contains(scopes, oidc.ScopeOfflineAccess) {
+			scopes = append(scopes, oidc.ScopeOfflineAccess)
+		}
+	}
+
+	return scopes, opts
 }
 
 // KeycloakRoleExtractor extracts roles from Keycloak-specific claims (realm_access, resource_access).
-// For other OIDC providers, replace AuthService.roleExtractor with a custom function.
+// For other OIDC providers, replace it with AuthService.SetRoleExtractor.
 func KeycloakRoleExtractor(rawClaims json.RawMessage, clientID string) ([]string, error) {
 	var claims struct {
 		RealmAccess struct {
@@ -129,6 +417,74 @@ func KeycloakRoleExtractor(rawClaims json.RawMessage, clientID string) ([]string
 	return roles, nil
 }
 
+// NewAuth0RoleExtractor returns a RoleExtractor for Auth0, which only passes roles into
+// tokens through a namespaced custom claim set by an Action, e.g.
+// api.idToken.setCustomClaim("https://example.com/roles", event.authorization.roles).
+// namespace is the claim prefix ("https://example.com"); the roles are read from
+// "<namespace>/roles". A missing claim yields no roles.
+func NewAuth0RoleExtractor(namespace string) RoleExtractor {
+	claim := strings.TrimSuffix(namespace, "/") + "/roles"
+	return func(rawClaims json.RawMessage, clientID string) ([]string, error) {
+		return stringListClaim(rawClaims, claim)
+	}
+}
+
+// OktaRoleExtractor reads roles from Okta's "groups" claim, which the authorization server
+// includes once a groups claim is configured for the app. A missing claim yields no roles.
+func OktaRoleExtractor(rawClaims json.RawMessage, clientID string) ([]string, error) {
+	return stringListClaim(rawClaims, "groups")
+}
+
+// ClaimTenantExtractor returns a TenantExtractor that reads a top-level string claim.
+// A missing claim yields an empty tenant rather than an error.
+func ClaimTenantExtractor(claim string) TenantExtractor {
+	return func(rawClaims json.RawMessage) (string, error) {
+		var claims map[string]json.RawMessage
+		if err := json.Unmarshal(rawClaims, &claims); err != nil {
+			return "", fmt.Errorf("parsing tenant claim: %w", err)
+		}
+		raw, ok := claims[claim]
+		if !ok {
+			return "", nil
+		}
+		var tenant string
+		if err := json.Unmarshal(raw, &tenant); err != nil {
+			return "", fmt.Errorf("tenant claim %q is not a string: %w", claim, err)
+		}
+		return tenant, nil
+	}
+}
+
+// ClaimGroupExtractor returns a GroupExtractor that reads a top-level claim holding either
+// an array of strings or a single string. A missing claim yields no groups.
+func ClaimGroupExtractor(claim string) GroupExtractor {
+	return func(rawClaims json.RawMessage) ([]string, error) {
+		return stringListClaim(rawClaims, claim)
+	}
+}
+
+// stringListClaim reads a top-level claim holding either an array of strings or a single
+// string. A missing claim yields nil.
+func stringListClaim(rawClaims json.RawMessage, claim string) ([]string, error) {
+	var claims map[string]json.RawMessage
+	if err := json.Unmarshal(rawClaims, &claims); err != nil {
+		return nil, fmt.Errorf("parsing claims: %w", err)
+	}
+	raw, ok := claims[claim]
+	if !ok {
+		return nil, nil
+	}
+	var values []string
+	if err := json.Unmarshal(raw, &values); err == nil {
+		return values, nil
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, fmt.Errorf("claim %q is not a string or string array: %w", claim, err)
+	}
+	return []string{value}, nil
+}
+
 func isDefaultKeycloakRole(role string) bool {
 	if strings.HasPrefix(role, "default-roles-") {
 		return true
@@ -140,61 +496,141 @@ func isDefaultKeycloakRole(role string) bool {
 	return false
 }
 
-func tokenToJSON(token *oauth2.Token, roles []string) ([]byte, error) {
+// newTokenData captures the parts of a session that are persisted in the encrypted token blob.
+func newTokenData(session models.SessionData) tokenData {
 	td := tokenData{
-		AccessToken:  token.AccessToken,
-		TokenType:    token.TokenType,
-		RefreshToken: token.RefreshToken,
-		Expiry:       token.Expiry,
-		Roles:        roles,
+		Roles:      session.Roles,
+		Groups:     session.Groups,
+		TenantID:   session.TenantID,
+		Claims:     session.Claims,
+		Scopes:     session.GrantedScopes,
+		VerifiedAt: session.VerifiedAt,
 	}
-	return json.Marshal(td)
+	if session.Token != nil {
+		td.AccessToken = session.Token.AccessToken
+		td.TokenType = session.Token.TokenType
+		td.RefreshToken = session.Token.RefreshToken
+		td.Expiry = session.Token.Expiry
+	}
+	return td
 }
 
-func tokenFromJSON(data []byte) (*oauth2.Token, []string, error) {
-	var td tokenData
-	if err := json.Unmarshal(data, &td); err != nil {
-		return nil, nil, err
-	}
-	token := &oauth2.Token{
+// applyTo copies the decrypted token blob back onto a session loaded from storage.
+func (td tokenData) applyTo(session *models.SessionData) {
+	session.Token = &oauth2.Token{
 		AccessToken:  td.AccessToken,
 		TokenType:    td.TokenType,
 		RefreshToken: td.RefreshToken,
 		Expiry:       td.Expiry,
 	}
-	return token, td.Roles, nil
+	session.Roles = td.Roles
+	session.Groups = td.Groups
+	session.TenantID = td.TenantID
+	session.Claims = td.Claims
+	session.GrantedScopes = td.Scopes
+	session.VerifiedAt = td.VerifiedAt
+}
+
+// grantedScopes returns the scopes the provider granted for token. Per RFC 6749 §5.1 the
+// scope parameter may be omitted when it equals the requested scope, so requested is the fallback.
+func grantedScopes(token *oauth2.Token, requested []string) []string {
+	if scope, ok := token.Extra("scope").(string); ok && scope != "" {
+		return strings.Fields(scope)
+	}
+	return requested
 }
 
+// SetLoginRedirect sets where Callback sends users after login when there is no page to
+// return to. Like the other redirects it is a route name, or a path if it starts with "/".
 func (s *AuthService) SetLoginRedirect(url string) {
 	s.loginRedirect = url
 }
 
+// SetLoginFailureRedirect sets where RequireAuth sends anonymous visitors and where failed
+// logins end up, normally the login route.
 func (s *AuthService) SetLoginFailureRedirect(url string) {
 	s.loginFailureRedirect = url
 }
 
+// redirectURL resolves a redirect set with SetLoginRedirect and friends.
+func redirectURL(r *http.Request, target string) string {
+	if strings.HasPrefix(target, "/") {
+		return target
+	}
+	return framework.UrlFor(r, target)
+}
+
+// SetAccessDeniedRedirect sets the route users are sent to when their email domain is not
+// permitted. Defaults to the login failure redirect.
+func (s *AuthService) SetAccessDeniedRedirect(url string) {
+	s.accessDeniedRedirect = url
+}
+
+// SetForbiddenHandler sets the handler that writes the 403 response for the Require*
+// authorization middleware, typically rendering the error page. Defaults to a plain-text
+// "Forbidden".
+func (s *AuthService) SetForbiddenHandler(fn http.HandlerFunc) {
+	s.forbiddenHandler = fn
+}
+
+// SetUnavailableHandler sets the handler that writes the 503 response RequireAuth sends
+// when the session store cannot be reached, typically rendering a "temporarily unavailable"
+// page. Defaults to a plain-text "Service Unavailable".
+func (s *AuthService) SetUnavailableHandler(fn http.HandlerFunc) {
+	s.unavailableHandler = fn
+}
+
 // SetFirstLoginHook registers a function called on the first successful OIDC login
 // for an identity that has no linked domain user yet. It should provision a User
 // and return the new UserID so the identity can be linked.
-func (s *AuthService) SetFirstLoginHook(fn func(ctx context.Context, email, name string) (models.UserID, error)) {
+func (s *AuthService) SetFirstLoginHook(fn func(ctx context.Context, info LoginInfo) (models.UserID, error)) {
 	s.onFirstLogin = fn
 }
 
 // SetOnLoginHook registers a function called on every successful login for an identity
 // that already has a linked domain user. Use this to sync updated email/name from the
 // OIDC provider to the domain user record.
-func (s *AuthService) SetOnLoginHook(fn func(ctx context.Context, userID models.UserID, email, name string) error) {
+func (s *AuthService) SetOnLoginHook(fn func(ctx context.Context, userID models.UserID, info LoginInfo) error) {
 	s.onLogin = fn
 }
 
+// SetAuditLog registers a repository that receives login, logout and session revocation
+// events. Auditing is skipped when no repository is set.
+func (s *AuthService) SetAuditLog(audit ports.AuditRepository) {
+	s.audit = audit
+}
+
+// SetRoleExtractor replaces the default KeycloakRoleExtractor. RoleAllowlist and MaxRoles
+// still apply to the roles it returns.
+func (s *AuthService) SetRoleExtractor(fn RoleExtractor) {
+	s.roleExtractor = fn
+}
+
+// SetGroupExtractor replaces the group extractor configured from GroupsClaim.
+func (s *AuthService) SetGroupExtractor(fn GroupExtractor) {
+	s.groupExtractor = fn
+}
+
+// SetTenantExtractor replaces the tenant extractor. Pass nil to disable tenant extraction.
+func (s *AuthService) SetTenantExtractor(fn TenantExtractor) {
+	s.tenantExtractor = fn
+}
+
+// SetTokenSourceFactory replaces how refreshed tokens are obtained, e.g. with a fake that
+// returns rotated tokens or invalid_grant errors so refresh handling can be tested without
+// a provider. An *oauth2.RetrieveError with ErrorCode "invalid_grant" ends the session.
+func (s *AuthService) SetTokenSourceFactory(fn TokenSourceFactory) {
+	s.tokenSource = fn
+}
+
 // encryptToken serializes and encrypts token data for storage.
 // Returns a JSON-safe base64-encoded string (compatible with JSONB columns).
-func (s *AuthService) encryptToken(token *oauth2.Token, roles []string) ([]byte, error) {
-	plaintext, err := tokenToJSON(token, roles)
+func (s *AuthService) encryptToken(td tokenData) ([]byte, error) {
+	plaintext, err := json.Marshal(td)
 	if err != nil {
 		return nil, fmt.Errorf("marshaling token data: %w", err)
 	}
-	ciphertext, err := encrypt(plaintext, s.cfg.SecretKey)
+	ciphertext, err := encrypt(plaintext, s.keys.Encryption)
 	if err != nil {
 		return nil, err
 	}
@@ -203,22 +639,39 @@ func (s *AuthService) encryptToken(token *oauth2.Token, roles []string) ([]byte,
 	return json.Marshal(encoded)
 }
 
+// errSessionUndecryptable means stored token data could not be decrypted with the secret
+// key. For one session it may be corruption; for many it means the key changed.
+var errSessionUndecryptable = errors.New("decrypting token data")
+
+// decryptFailureLogInterval rate-limits the warning logged when sessions fail to decrypt.
+const decryptFailureLogInterval = time.Minute
+
 // decryptToken decrypts and deserializes token data from storage.
-func (s *AuthService) decryptToken(data []byte) (*oauth2.Token, []string, error) {
+func (s *AuthService) decryptToken(data []byte) (tokenData, error) {
+	var td tokenData
+
 	// Unwrap JSON string
 	var encoded string
 	if err := json.Unmarshal(data, &encoded); err != nil {
-		return nil, nil, fmt.Errorf("unmarshaling encrypted envelope: %w", err)
+		return td, fmt.Errorf("unmarshaling encrypted envelope: %w", err)
 	}
 	ciphertext, err := base64.StdEncoding.DecodeString(encoded)
 	if err != nil {
-		return nil, nil, fmt.Errorf("decoding base64 ciphertext: %w", err)
+		return td, fmt.Errorf("decoding base64 ciphertext: %w", err)
 	}
-	plaintext, err := decrypt(ciphertext, s.cfg.SecretKey)
+	plaintext, err := decrypt(ciphertext, s.keys.Encryption)
 	if err != nil {
-		return nil, nil, fmt.Errorf("decrypting token data: %w", err)
+		// sessions created before keys were derived are encrypted with the secret key
+		// itself; they are re-encrypted with the derived key on their next token refresh
+		var legacyErr error
+		if plaintext, legacyErr = decrypt(ciphertext, s.cfg.SecretKey); legacyErr != nil {
+			return td, fmt.Errorf("%w: %w", errSessionUndecryptable, err)
+		}
+	}
+	if err := json.Unmarshal(plaintext, &td); err != nil {
+		return td, fmt.Errorf("unmarshaling token data: %w", err)
 	}
-	return tokenFromJSON(plaintext)
+	return td, nil
 }
 
 // connectOIDCProvider attempts to connect to the OIDC provider, retrying for up to 3 minutes.
@@ -254,6 +707,51 @@ func connectOIDCProvider(ctx context.Context, issuerURL string) (*oidc.Provider,
 	return nil, fmt.Errorf("failed to connect to OIDC provider after %s: %w", maxWait, lastErr)
 }
 
+// discoveryDocument is the subset of the OpenID discovery document needed to build a
+// provider without network access, plus an optional inline key set.
+type discoveryDocument struct {
+	oidc.ProviderConfig
+	JWKS *jose.JSONWebKeySet `json:"jwks"`
+}
+
+// staticOIDCProvider builds a provider and ID token verifier from a local discovery document
+// instead of fetching it. The verifier uses the document's inline keys when present and
+// otherwise fetches them from jwks_uri.
+func staticOIDCProvider(ctx context.Context, issuerURL string, document []byte, config *oidc.Config) (*oidc.Provider, *oidc.IDTokenVerifier, error) {
+	var doc discoveryDocument
+	if err := json.Unmarshal(document, &doc); err != nil {
+		return nil, nil, fmt.Errorf("parsing OIDC discovery document: %w", err)
+	}
+	if doc.IssuerURL != issuerURL {
+		return nil, nil, fmt.Errorf("OIDC discovery document issuer %q does not match configured issuer %q", doc.IssuerURL, issuerURL)
+	}
+	if doc.AuthURL == "" || doc.TokenURL == "" {
+		return nil, nil, errors.New("OIDC discovery document must set authorization_endpoint and token_endpoint")
+	}
+	if doc.JWKSURL == "" && doc.JWKS == nil {
+		return nil, nil, errors.New("OIDC discovery document must set jwks_uri or an inline jwks")
+	}
+
+	provider := doc.ProviderConfig.NewProvider(ctx)
+	if doc.JWKS == nil {
+		return provider, provider.Verifier(config), nil
+	}
+
+	keySet := &oidc.StaticKeySet{}
+	for _, key := range doc.JWKS.Keys {
+		if key.IsPublic() && (key.Use == "" || key.Use == "sig") {
+			keySet.PublicKeys = append(keySet.PublicKeys, key.Key)
+		}
+	}
+	if len(keySet.PublicKeys) == 0 {
+		return nil, nil, errors.New("OIDC discovery document jwks has no public signing keys")
+	}
+	if len(config.SupportedSigningAlgs) == 0 {
+		config.SupportedSigningAlgs = doc.Algorithms
+	}
+	return provider, oidc.NewVerifier(issuerURL, keySet, config), nil
+}
+
 func (s *AuthService) GenerateState() string {
 	b := make([]byte, 32)
 	if _, err := io.ReadFull(rand.Reader, b); err != nil {
@@ -262,33 +760,59 @@ func (s *AuthService) GenerateState() string {
 	return base64.URLEncoding.EncodeToString(b)
 }
 
-func (s *AuthService) GetSession(ctx context.Context, sessionID string) (*models.SessionData, bool) {
+// GetSession loads the session stored under sessionID. Errors wrapping
+// [ports.ErrUnavailable] mean the store could not be reached and the session may well be
+// valid; any other error means there is no usable session.
+func (s *AuthService) GetSession(ctx context.Context, sessionID string) (*models.SessionData, error) {
 	session, err := s.sessionManager.GetSession(ctx, sessionID)
 	if err != nil {
-		return nil, false
+		return nil, fmt.Errorf("loading session: %w", err)
 	}
 
-	token, roles, err := s.decryptToken(session.TokenData)
+	td, err := s.decryptToken(session.TokenData)
 	if err != nil {
-		return nil, false
+		if errors.Is(err, errSessionUndecryptable) {
+			s.warnDecryptFailure(err)
+		}
+		return nil, err
 	}
-
-	session.Token = token
-	session.Roles = roles
+	td.applyTo(session)
 
 	identity, err := s.identityManager.GetIdentityByID(ctx, session.IdentityID)
 	if err != nil {
-		return nil, false
+		return nil, fmt.Errorf("loading session identity: %w", err)
 	}
 
 	session.SubjectID = identity.AuthSub
 	session.UserID = identity.UserID
 
-	return session, true
+	return session, nil
+}
+
+// warnDecryptFailure logs that a stored session could not be decrypted, at most once per
+// decryptFailureLogInterval with a count of the failures in between. Existing sessions
+// failing to decrypt en masse usually means SECRET_KEY changed, which silently logs out
+// every user, so this is a warning rather than the quiet logout of a missing session.
+func (s *AuthService) warnDecryptFailure(err error) {
+	s.decryptFailuresMu.Lock()
+	s.decryptFailures++
+	if time.Since(s.decryptFailureLoggedAt) < decryptFailureLogInterval {
+		s.decryptFailuresMu.Unlock()
+		return
+	}
+	failures := s.decryptFailures
+	s.decryptFailures = 0
+	s.decryptFailureLoggedAt = time.Now()
+	s.decryptFailuresMu.Unlock()
+
+	slog.Warn("session token data failed to decrypt; if this repeats, SECRET_KEY may have changed",
+		"failures", failures,
+		"error", err,
+	)
 }
 
 func (s *AuthService) SetSession(ctx context.Context, sessionID string, session models.SessionData) error {
-	tokenEncrypted, err := s.encryptToken(session.Token, session.Roles)
+	tokenEncrypted, err := s.encryptToken(newTokenData(session))
 	if err != nil {
 		return fmt.Errorf("encrypting token data: %w", err)
 	}
@@ -297,44 +821,221 @@ func (s *AuthService) SetSession(ctx context.Context, sessionID string, session
 	return s.sessionManager.CreateSession(ctx, sessionID, session)
 }
 
+// RefreshToken refreshes an expired access token and updates session in place. The new
+// token is only written to the database when it differs from the stored one.
 func (s *AuthService) RefreshToken(ctx context.Context, sessionID string, session *models.SessionData) error {
 	if session.Token.Expiry.After(time.Now()) {
 		return nil
 	}
 
-	tokenSource := s.oauth2Config.TokenSource(ctx, session.Token)
-	newToken, err := tokenSource.Token()
+	// Concurrent requests on the same session share one refresh and one write, and requests
+	// that loaded the session just before a refresh was persisted reuse its result.
+	result, err, _ := s.refreshes.Do(sessionID, func() (any, error) {
+		if recent, ok := s.recentRefresh(sessionID); ok {
+			return recent, nil
+		}
+		// the refresh is shared, so one caller going away must not fail it for the others
+		refreshed, err := s.refreshSessionToken(context.WithoutCancel(ctx), sessionID, *session)
+		if err != nil {
+			return nil, err
+		}
+		s.rememberRefresh(sessionID, refreshed)
+		return refreshed, nil
+	})
 	if err != nil {
 		return err
 	}
+
+	refreshed := result.(refreshedToken)
+	session.Token = refreshed.token
+	session.TokenData = refreshed.tokenData
+	if refreshed.scopes != nil {
+		session.GrantedScopes = refreshed.scopes
+	}
+	if refreshed.entitlements != nil {
+		session.Roles = refreshed.entitlements.Roles
+		session.Groups = refreshed.entitlements.Groups
+		session.Claims = refreshed.entitlements.Claims
+		session.VerifiedAt = refreshed.entitlements.VerifiedAt
+	}
+	return nil
+}
+
+// errRefreshRejected means the session can never be refreshed again: the provider answered
+// invalid_grant (the refresh token expired, was revoked, or was already used once rotated)
+// or the session has no refresh token. Other refresh failures may be transient.
+var errRefreshRejected = errors.New("refresh token rejected")
+
+// refreshedToken is the outcome of a token refresh, shared by every request waiting on it.
+type refreshedToken struct {
+	token        *oauth2.Token
+	tokenData    []byte
+	scopes       []string
+	entitlements *models.SessionData // re-read Roles, Groups, Claims and VerifiedAt, if due
+	at           time.Time
+}
+
+// refreshReuseWindow is how long a completed refresh is reused for requests that read the
+// session before the new token was written.
+const refreshReuseWindow = 10 * time.Second
+
+// refreshSessionToken fetches a new token from the provider and persists it, skipping the
+// write when the provider returned the tokens the session already has.
+func (s *AuthService) refreshSessionToken(ctx context.Context, sessionID string, session models.SessionData) (refreshedToken, error) {
+	if session.Token.RefreshToken == "" {
+		return refreshedToken{}, fmt.Errorf("%w: no refresh token", errRefreshRejected)
+	}
+	// a rotated refresh token in newToken differs from the stored one, so it is persisted below
+	newToken, err := s.tokenSource(ctx, session.Token).Token()
+	if err != nil {
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(err, &retrieveErr) && retrieveErr.ErrorCode == "invalid_grant" {
+			return refreshedToken{}, fmt.Errorf("%w: %w", errRefreshRejected, err)
+		}
+		return refreshedToken{}, err
+	}
+
+	refreshed := refreshedToken{token: newToken, tokenData: session.TokenData, at: time.Now()}
+	if scope, ok := newToken.Extra("scope").(string); ok && scope != "" {
+		refreshed.scopes = strings.Fields(scope)
+	}
+	if s.cfg.RoleRefreshInterval >= 0 && time.Since(session.VerifiedAt) >= s.cfg.RoleRefreshInterval {
+		entitlements := session
+		if err := s.reverifyEntitlements(ctx, newToken, &entitlements); err != nil {
+			// keep the current roles and try again on the next refresh
+			slog.Warn("re-reading session roles failed", "identity_id", session.IdentityID, "error", err)
+		} else {
+			refreshed.entitlements = &entitlements
+			session = entitlements
+		}
+	}
+	if tokenUnchanged(session.Token, newToken) && (refreshed.scopes == nil || slices.Equal(refreshed.scopes, session.GrantedScopes)) && refreshed.entitlements == nil {
+		return refreshed, nil
+	}
+
 	session.Token = newToken
+	if refreshed.scopes != nil {
+		session.GrantedScopes = refreshed.scopes
+	}
+	refreshed.tokenData, err = s.encryptToken(newTokenData(session))
+	if err != nil {
+		return refreshedToken{}, fmt.Errorf("encrypting refreshed token: %w", err)
+	}
+	session.TokenData = refreshed.tokenData
 
-	tokenEncrypted, err := s.encryptToken(newToken, session.Roles)
+	if err := s.sessionManager.UpdateSessionToken(ctx, sessionID, session); err != nil {
+		return refreshedToken{}, err
+	}
+	return refreshed, nil
+}
+
+// reverifyEntitlements re-reads the roles, groups and session claims of session from the
+// ID token returned with a refreshed token, or from the userinfo endpoint when the provider
+// sends none, and stamps VerifiedAt. The claims must belong to the session's subject.
+func (s *AuthService) reverifyEntitlements(ctx context.Context, token *oauth2.Token, session *models.SessionData) error {
+	var rawClaims json.RawMessage
+	if rawIDToken, ok := token.Extra("id_token").(string); ok && rawIDToken != "" {
+		stdClaims, raw, err := s.VerifyToken(ctx, rawIDToken, &oidcClaims{})
+		if err != nil {
+			return err
+		}
+		if sub := stdClaims.(*oidcClaims).Sub; sub != session.SubjectID {
+			return fmt.Errorf("refreshed ID token is for subject %q, not %q", sub, session.SubjectID)
+		}
+		rawClaims = raw
+	} else {
+		info, err := s.provider.UserInfo(ctx, oauth2.StaticTokenSource(token))
+		if err != nil {
+			return fmt.Errorf("fetching userinfo: %w", err)
+		}
+		if info.Subject != session.SubjectID {
+			return fmt.Errorf("userinfo is for subject %q, not %q", info.Subject, session.SubjectID)
+		}
+		if err := info.Claims(&rawClaims); err != nil {
+			return fmt.Errorf("parsing userinfo claims: %w", err)
+		}
+	}
+
+	roles, err := s.ExtractRoles(rawClaims)
 	if err != nil {
-		return fmt.Errorf("encrypting refreshed token: %w", err)
+		return fmt.Errorf("extracting roles: %w", err)
+	}
+	groups, err := s.ExtractGroups(rawClaims)
+	if err != nil {
+		return fmt.Errorf("extracting groups: %w", err)
+	}
+	sessionClaims, err := s.sessionClaims(rawClaims)
+	if err != nil {
+		return fmt.Errorf("filtering claims: %w", err)
 	}
-	session.TokenData = tokenEncrypted
 
-	return s.sessionManager.UpdateSessionToken(ctx, sessionID, *session)
+	session.Roles = roles
+	session.Groups = groups
+	session.Claims = sessionClaims
+	session.VerifiedAt = time.Now()
+	return nil
 }
 
-// AuthCodeURL generates the OAuth2 authorization code URL with the given state
-func (s *AuthService) AuthCodeURL(state string) string {
-	return s.oauth2Config.AuthCodeURL(state)
+// tokenUnchanged reports whether a refresh returned the same tokens and expiry, in which
+// case there is nothing new to persist.
+func tokenUnchanged(old, new *oauth2.Token) bool {
+	return old.AccessToken == new.AccessToken &&
+		old.RefreshToken == new.RefreshToken &&
+		old.Expiry.Equal(new.Expiry)
+}
+
+// recentRefresh returns the refresh of sessionID completed within refreshReuseWindow, if any.
+func (s *AuthService) recentRefresh(sessionID string) (refreshedToken, bool) {
+	s.recentRefreshesMu.Lock()
+	defer s.recentRefreshesMu.Unlock()
+	refreshed, ok := s.recentRefreshes[sessionID]
+	if !ok || time.Since(refreshed.at) > refreshReuseWindow || !refreshed.token.Valid() {
+		return refreshedToken{}, false
+	}
+	return refreshed, true
+}
+
+// rememberRefresh records a completed refresh and prunes entries past refreshReuseWindow.
+func (s *AuthService) rememberRefresh(sessionID string, refreshed refreshedToken) {
+	s.recentRefreshesMu.Lock()
+	defer s.recentRefreshesMu.Unlock()
+	for id, r := range s.recentRefreshes {
+		if time.Since(r.at) > refreshReuseWindow {
+			delete(s.recentRefreshes, id)
+		}
+	}
+	s.recentRefreshes[sessionID] = refreshed
+}
+
+// AuthCodeURL generates the OAuth2 authorization code URL with the given state and nonce.
+// The provider echoes the nonce in the ID token, which Callback checks against the
+// oauth_nonce cookie so a token issued for another login cannot be replayed. opts are
+// added after the configured ones, e.g. the redirect_uri for the request's host.
+func (s *AuthService) AuthCodeURL(state, nonce string, opts ...oauth2.AuthCodeOption) string {
+	opts = slices.Concat(s.authCodeOptions, []oauth2.AuthCodeOption{oidc.Nonce(nonce)}, opts)
+	return s.oauth2Config.AuthCodeURL(state, opts...)
+}
+
+// redirectURI returns the redirect_uri for logins started by r, on the host it addressed
+// when that host is trusted (see AuthConfig.PublicOrigin). The token exchange must send
+// the same value.
+func (s *AuthService) redirectURI(r *http.Request) oauth2.AuthCodeOption {
+	return oauth2.SetAuthURLParam("redirect_uri", s.cfg.PublicOrigin.URL(r, "/callback"))
 }
 
 // registrationCodeURL generates a Keycloak registration URL by replacing the OIDC
 // auth endpoint (/auth) with the registration endpoint (/registrations).
 // All standard OAuth2 parameters (state, client_id, redirect_uri, scope) are preserved,
 // so the callback flow is identical to a normal login.
-func (s *AuthService) registrationCodeURL(state string) string {
-	authURL := s.oauth2Config.AuthCodeURL(state)
+func (s *AuthService) registrationCodeURL(state, nonce string, opts ...oauth2.AuthCodeOption) string {
+	authURL := s.AuthCodeURL(state, nonce, opts...)
 	return strings.Replace(authURL, "/protocol/openid-connect/auth", "/protocol/openid-connect/registrations", 1)
 }
 
-// ExchangeToken exchanges an authorization code for an OAuth2 token and extracts the raw ID token
-func (s *AuthService) ExchangeToken(ctx context.Context, code string) (*oauth2.Token, string, error) {
-	token, err := s.oauth2Config.Exchange(ctx, code)
+// ExchangeToken exchanges an authorization code for an OAuth2 token and extracts the raw ID token.
+// opts must repeat a redirect_uri passed to AuthCodeURL.
+func (s *AuthService) ExchangeToken(ctx context.Context, code string, opts ...oauth2.AuthCodeOption) (*oauth2.Token, string, error) {
+	token, err := s.oauth2Config.Exchange(ctx, code, opts...)
 	if err != nil {
 		return nil, "", err
 	}
@@ -366,9 +1067,140 @@ func (s *AuthService) VerifyToken(ctx context.Context, rawIDToken string, claims
 	return claimsStruct, rawClaims, nil
 }
 
-// ExtractRoles extracts roles from OIDC claims
+// ExtractRoles extracts roles from OIDC claims, applying the configured allowlist and cap
 func (s *AuthService) ExtractRoles(rawClaims json.RawMessage) ([]string, error) {
-	return s.roleExtractor(rawClaims, s.cfg.OIDCClientID)
+	roles, err := s.roleExtractor(rawClaims, s.cfg.OIDCClientID)
+	if err != nil {
+		return nil, err
+	}
+	return s.limitRoles(roles), nil
+}
+
+// limitRoles drops roles outside RoleAllowlist and truncates the rest to MaxRoles, logging
+// the roles dropped either way so operators can tell why a role is missing from a session.
+func (s *AuthService) limitRoles(roles []string) []string {
+	if len(s.cfg.RoleAllowlist) > 0 {
+		kept := make([]string, 0, len(roles))
+		var dropped []string
+		for _, role := range roles {
+			if slices.Contains(s.cfg.RoleAllowlist, role) {
+				kept = append(kept, role)
+			} else {
+				dropped = append(dropped, role)
+			}
+		}
+		if len(dropped) > 0 {
+			slog.Info("dropping session roles outside the allowlist", "roles", len(dropped), "dropped", dropped)
+		}
+		roles = kept
+	}
+
+	if s.cfg.MaxRoles > 0 && len(roles) > s.cfg.MaxRoles {
+		slog.Warn("truncating session roles", "roles", len(roles), "max_roles", s.cfg.MaxRoles, "dropped", roles[s.cfg.MaxRoles:])
+		roles = roles[:s.cfg.MaxRoles]
+	}
+	return roles
+}
+
+// ExtractGroups extracts group memberships from OIDC claims, or nil if no extractor is configured
+func (s *AuthService) ExtractGroups(rawClaims json.RawMessage) ([]string, error) {
+	if s.groupExtractor == nil {
+		return nil, nil
+	}
+	return s.groupExtractor(rawClaims)
+}
+
+// ExtractTenant extracts the tenant from OIDC claims, or "" if no extractor is configured
+func (s *AuthService) ExtractTenant(rawClaims json.RawMessage) (string, error) {
+	if s.tenantExtractor == nil {
+		return "", nil
+	}
+	return s.tenantExtractor(rawClaims)
+}
+
+// emailDomainAllowed applies AllowedEmailDomains and DeniedEmailDomains to the claimed email.
+// When either list is set, an email the provider reports as unverified is never admitted.
+func (s *AuthService) emailDomainAllowed(claims *oidcClaims) bool {
+	if len(s.cfg.AllowedEmailDomains) == 0 && len(s.cfg.DeniedEmailDomains) == 0 {
+		return true
+	}
+	if claims.EmailVerified != nil && !*claims.EmailVerified {
+		return false
+	}
+
+	at := strings.LastIndex(claims.Email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(claims.Email[at+1:])
+
+	if slices.ContainsFunc(s.cfg.DeniedEmailDomains, func(pattern string) bool { return matchEmailDomain(pattern, domain) }) {
+		return false
+	}
+	if len(s.cfg.AllowedEmailDomains) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(s.cfg.AllowedEmailDomains, func(pattern string) bool { return matchEmailDomain(pattern, domain) })
+}
+
+// matchEmailDomain reports whether domain (lowercase) matches pattern, where "*.example.com"
+// matches subdomains of example.com.
+func matchEmailDomain(pattern, domain string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(domain, "."+suffix)
+	}
+	return domain == pattern
+}
+
+// missingScopes returns the requested scopes absent from granted.
+func missingScopes(requested, granted []string) []string {
+	var missing []string
+	for _, scope := range requested {
+		if !slices.Contains(granted, scope) {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// sessionClaims returns the subset of raw claims configured by SessionClaims for storage on the session.
+func (s *AuthService) sessionClaims(rawClaims json.RawMessage) (json.RawMessage, error) {
+	if len(s.cfg.SessionClaims) == 0 {
+		return rawClaims, nil
+	}
+
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(rawClaims, &all); err != nil {
+		return nil, fmt.Errorf("parsing claims: %w", err)
+	}
+	kept := make(map[string]json.RawMessage, len(s.cfg.SessionClaims))
+	for _, name := range s.cfg.SessionClaims {
+		if v, ok := all[name]; ok {
+			kept[name] = v
+		}
+	}
+	return json.Marshal(kept)
+}
+
+// userAttributes returns the UserAttributeClaims present in rawClaims, or nil if none are
+// configured.
+func (s *AuthService) userAttributes(rawClaims json.RawMessage) (map[string]any, error) {
+	if len(s.cfg.UserAttributeClaims) == 0 {
+		return nil, nil
+	}
+
+	var all map[string]any
+	if err := json.Unmarshal(rawClaims, &all); err != nil {
+		return nil, fmt.Errorf("parsing claims: %w", err)
+	}
+	attributes := make(map[string]any, len(s.cfg.UserAttributeClaims))
+	for _, name := range s.cfg.UserAttributeClaims {
+		if v, ok := all[name]; ok {
+			attributes[name] = v
+		}
+	}
+	return attributes, nil
 }
 
 // RevokeSession revokes an OIDC session via backchannel logout.
@@ -444,62 +1276,301 @@ func decrypt(ciphertext, key []byte) ([]byte, error) {
 func (s *AuthService) RequireAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if framework.GetAuthSession(r) == nil {
-			http.Redirect(w, r, framework.UrlFor(r, s.loginFailureRedirect), http.StatusTemporaryRedirect)
+			if framework.SessionUnavailable(r) {
+				s.unavailable(w, r)
+				return
+			}
+			s.rememberReturnTo(w, r)
+			framework.Redirect(w, r, redirectURL(r, s.loginFailureRedirect), http.StatusTemporaryRedirect)
 			return
 		}
 		if framework.GetLoggedInUser(r) == nil {
-			http.Redirect(w, r, framework.UrlFor(r, s.loginFailureRedirect), http.StatusTemporaryRedirect)
+			framework.Redirect(w, r, redirectURL(r, s.loginFailureRedirect), http.StatusTemporaryRedirect)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireTenant is middleware that requires an authenticated user whose session carries a
+// tenant and, when the domain user is tenant-bound, that the two agree. Like RequireRole it
+// runs RequireAuth first, so anonymous requests are redirected to log in. Responds 403
+// Forbidden otherwise.
+//
+// It composes with role checks rather than replacing them: tenant scoping answers "which
+// organization's data", roles answer "what may this user do". Mount RequireTenant first,
+// then any role middleware, so role checks only ever run within an established tenant.
+func (s *AuthService) RequireTenant(next http.Handler) http.Handler {
+	return s.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// RequireAuth guarantees a session
+		session := framework.GetAuthSession(r)
+		if session.TenantID == "" {
+			s.forbidden(w, r)
+			return
+		}
+		if user := framework.GetLoggedInUser(r); user != nil && user.TenantID != "" && user.TenantID != session.TenantID {
+			slog.Warn("session tenant does not match user tenant", "user_id", user.ID, "session_tenant", session.TenantID, "user_tenant", user.TenantID)
+			s.forbidden(w, r)
 			return
 		}
 		next.ServeHTTP(w, r)
+	}))
+}
+
+// RequireRole returns middleware that requires an authenticated user whose session carries
+// at least one of the listed roles. It runs RequireAuth first, so anonymous requests are
+// redirected to log in rather than refused, and checks the session CheckAuth already loaded.
+// Responds 403 Forbidden otherwise.
+func (s *AuthService) RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return s.requireRoles(func(session *models.SessionData) bool {
+		return slices.ContainsFunc(roles, session.HasRole)
+	})
+}
+
+// RequireAllRoles is like RequireRole but requires the session to carry every listed role.
+func (s *AuthService) RequireAllRoles(roles ...string) func(http.Handler) http.Handler {
+	return s.requireRoles(func(session *models.SessionData) bool {
+		for _, role := range roles {
+			if !session.HasRole(role) {
+				return false
+			}
+		}
+		return true
 	})
 }
 
+func (s *AuthService) requireRoles(allowed func(*models.SessionData) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return s.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// RequireAuth guarantees a session
+			if !allowed(framework.GetAuthSession(r)) {
+				s.forbidden(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}))
+	}
+}
+
+// RequireGroup returns middleware that requires an authenticated user whose session belongs
+// to at least one of the listed groups. Like RequireRole it runs RequireAuth first, so
+// anonymous requests are redirected to log in. Responds 403 Forbidden otherwise.
+func (s *AuthService) RequireGroup(groups ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return s.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// RequireAuth guarantees a session
+			if !slices.ContainsFunc(groups, framework.GetAuthSession(r).HasGroup) {
+				s.forbidden(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}))
+	}
+}
+
+// RequireScope returns middleware that requires an authenticated user whose access token
+// was granted every listed scope. Like RequireRole it runs RequireAuth first, so anonymous
+// requests are redirected to log in; an invalid bearer token has already been answered with
+// 401 by CheckAuth. Responds 403 Forbidden otherwise.
+func (s *AuthService) RequireScope(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return s.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// RequireAuth guarantees a session
+			session := framework.GetAuthSession(r)
+			for _, scope := range scopes {
+				if !session.HasScope(scope) {
+					s.forbidden(w, r)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		}))
+	}
+}
+
+// forbidden writes the 403 response for the authorization middleware.
+func (s *AuthService) forbidden(w http.ResponseWriter, r *http.Request) {
+	if s.forbiddenHandler != nil {
+		s.forbiddenHandler(w, r)
+		return
+	}
+	http.Error(w, "Forbidden", http.StatusForbidden)
+}
+
+// unavailable writes the 503 response RequireAuth sends when the session store is down.
+func (s *AuthService) unavailable(w http.ResponseWriter, r *http.Request) {
+	if s.unavailableHandler != nil {
+		s.unavailableHandler(w, r)
+		return
+	}
+	http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+}
+
 // CheckAuth validates the session cookie and stores the auth session in the request context.
 // It does not load the domain user — that is handled by the ResolveUser middleware.
 func (s *AuthService) CheckAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie("session_id")
+		if token, ok := bearerToken(r); ok && s.cfg.BearerAuth {
+			session, err := s.bearerSession(r.Context(), token)
+			if err != nil {
+				// a bad token never falls back to the cookie, so clients see why they failed
+				s.logAuthEvent(r, slog.LevelWarn, "bearer_auth_failure", "error", err)
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				framework.WriteJSONError(w, r, framework.Unauthorized())
+				return
+			}
+			next.ServeHTTP(w, framework.SetAuthSession(r, session))
+			return
+		}
+
+		cookie, err := s.cfg.Cookies.Get(r, "session_id")
 		if err != nil {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		session, exists := s.GetSession(r.Context(), cookie.Value)
-		if !exists || time.Now().After(session.Expires) {
+		session, err := s.GetSession(r.Context(), cookie.Value)
+		if errors.Is(err, ports.ErrUnavailable) {
+			// keep the cookie: the session is likely still valid once the store is back.
+			// Public pages render logged out; RequireAuth answers 503 instead of a login.
+			framework.GetLogger(r).Warn("session store unavailable", "error", err)
+			next.ServeHTTP(w, framework.SetSessionUnavailable(r))
+			return
+		}
+		if err != nil || time.Now().After(session.Expires) {
 			s.DeleteSession(w, r)
 			next.ServeHTTP(w, r)
 			return
 		}
 
 		if err := s.RefreshToken(r.Context(), cookie.Value, session); err != nil {
-			slog.Warn("token refresh failed, deleting session", "session_id", cookie.Value, "error", err)
-			s.DeleteSession(w, r)
+			s.logAuthEvent(r, slog.LevelWarn, "token_refresh_failure", "identity_id", session.IdentityID, "error", err)
+			// a dead session is removed; after a transient failure it is kept so the next
+			// request retries, and only this request proceeds unauthenticated
+			if errors.Is(err, errRefreshRejected) {
+				s.recordAudit(r, "session_revoke", session.UserID, fmt.Sprintf("identity:%d", session.IdentityID), map[string]any{"reason": "token_refresh_failure"})
+				s.DeleteSession(w, r)
+			}
 			next.ServeHTTP(w, r)
 			return
 		}
 
+		s.slideSession(w, r, cookie.Value, session)
+
 		next.ServeHTTP(w, framework.SetAuthSession(r, session))
 	})
 }
 
+// bearerToken returns the token of an "Authorization: Bearer" header. ok is true for any
+// Bearer header, so a malformed one is rejected rather than ignored.
+func bearerToken(r *http.Request) (token string, ok bool) {
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// bearerSession verifies a bearer token and builds a request-scoped session from its
+// claims, the way Callback does at login, without reading or writing the sessions table.
+func (s *AuthService) bearerSession(ctx context.Context, rawToken string) (*models.SessionData, error) {
+	if rawToken == "" {
+		return nil, errors.New("empty bearer token")
+	}
+	stdClaims, rawClaims, err := s.VerifyToken(ctx, rawToken, &oidcClaims{})
+	if err != nil {
+		return nil, err
+	}
+	claims := stdClaims.(*oidcClaims)
+
+	var expiry struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(rawClaims, &expiry); err != nil {
+		return nil, fmt.Errorf("parsing expiry: %w", err)
+	}
+
+	roles, err := s.ExtractRoles(rawClaims)
+	if err != nil {
+		slog.Warn("role extraction failed, proceeding without roles", "error", err)
+		roles = nil
+	}
+	groups, err := s.ExtractGroups(rawClaims)
+	if err != nil {
+		slog.Warn("group extraction failed, proceeding without groups", "error", err)
+		groups = nil
+	}
+	tenantID, err := s.ExtractTenant(rawClaims)
+	if err != nil {
+		return nil, fmt.Errorf("extracting tenant: %w", err)
+	}
+	sessionClaims, err := s.sessionClaims(rawClaims)
+	if err != nil {
+		slog.Warn("claim filtering failed, proceeding without custom claims", "error", err)
+		sessionClaims = nil
+	}
+
+	identity, err := s.identityManager.GetIdentityBySub(ctx, claims.Sub)
+	if err != nil {
+		return nil, fmt.Errorf("loading identity for %q: %w", claims.Sub, err)
+	}
+
+	expires := time.Unix(expiry.Exp, 0)
+	return &models.SessionData{
+		Token:      &oauth2.Token{AccessToken: rawToken, TokenType: "Bearer", Expiry: expires},
+		SubjectID:  claims.Sub,
+		IdentityID: identity.ID,
+		UserID:     identity.UserID,
+		Roles:      roles,
+		Groups:     groups,
+		TenantID:   tenantID,
+		Claims:     sessionClaims,
+		VerifiedAt: time.Now(),
+		Expires:    expires,
+	}, nil
+}
+
+// slideSession extends session to a full SessionTTL when SessionSliding is on and the last
+// extension is at least SessionSlidingInterval ago. A failed update is logged and the
+// session keeps its current expiry.
+func (s *AuthService) slideSession(w http.ResponseWriter, r *http.Request, sessionID string, session *models.SessionData) {
+	if !s.cfg.SessionSliding || time.Until(session.Expires) > s.cfg.SessionTTL-s.cfg.SessionSlidingInterval {
+		return
+	}
+	expires := time.Now().Add(s.cfg.SessionTTL)
+	if err := s.sessionManager.UpdateSessionExpiry(r.Context(), sessionID, expires); err != nil {
+		framework.GetLogger(r).Warn("failed to extend session", "identity_id", session.IdentityID, "error", err)
+		return
+	}
+	session.Expires = expires
+	s.setCookie(w, r, "session_id", sessionID, int(s.cfg.SessionTTL/time.Second))
+}
+
+// setCookie writes an HttpOnly auth cookie with the configured name and attributes.
+// A negative maxAge deletes the cookie.
+func (s *AuthService) setCookie(w http.ResponseWriter, r *http.Request, name, value string, maxAge int) {
+	cookie := s.cfg.Cookies.New(r, name, value, maxAge)
+	if (name == "oauth_state" || name == "oauth_nonce" || name == returnToCookie) && cookie.SameSite == http.SameSiteStrictMode {
+		cookie.SameSite = http.SameSiteLaxMode
+	}
+	if s.cfg.Cookies.SameSiteCompat() && sameSiteIncompatible(r.UserAgent()) {
+		cookie.SameSite = http.SameSiteDefaultMode // leaves the attribute out
+	}
+	http.SetCookie(w, cookie)
+}
+
 // --- route handlers ---
 
 // Login handles GET /login — redirects to OIDC provider
 func (s *AuthService) Login(w http.ResponseWriter, r *http.Request) {
 	state := s.GenerateState()
+	nonce := s.GenerateState()
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "oauth_state",
-		Value:    state,
-		Path:     "/",
-		MaxAge:   300,
-		HttpOnly: true,
-		Secure:   !s.cfg.IsDev,
-		SameSite: http.SameSiteLaxMode,
-	})
+	s.setCookie(w, r, "oauth_state", state, 300)
+	s.setCookie(w, r, "oauth_nonce", nonce, 300)
 
-	authURL := s.AuthCodeURL(state)
+	s.logAuthEvent(r, slog.LevelInfo, "login_initiated", "flow", "login")
+	authURL := s.AuthCodeURL(state, nonce, s.redirectURI(r))
 	http.Redirect(w, r, authURL, http.StatusTemporaryRedirect)
 }
 
@@ -507,18 +1578,13 @@ func (s *AuthService) Login(w http.ResponseWriter, r *http.Request) {
 // After the user registers, Keycloak redirects back to /callback as normal.
 func (s *AuthService) Register(w http.ResponseWriter, r *http.Request) {
 	state := s.GenerateState()
+	nonce := s.GenerateState()
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "oauth_state",
-		Value:    state,
-		Path:     "/",
-		MaxAge:   300,
-		HttpOnly: true,
-		Secure:   !s.cfg.IsDev,
-		SameSite: http.SameSiteLaxMode,
-	})
+	s.setCookie(w, r, "oauth_state", state, 300)
+	s.setCookie(w, r, "oauth_nonce", nonce, 300)
 
-	http.Redirect(w, r, s.registrationCodeURL(state), http.StatusTemporaryRedirect)
+	s.logAuthEvent(r, slog.LevelInfo, "login_initiated", "flow", "register")
+	http.Redirect(w, r, s.registrationCodeURL(state, nonce, s.redirectURI(r)), http.StatusTemporaryRedirect)
 }
 
 // Callback handles GET /callback — OIDC callback.
@@ -527,134 +1593,342 @@ func (s *AuthService) Register(w http.ResponseWriter, r *http.Request) {
 func (s *AuthService) Callback(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	stateCookie, err := r.Cookie("oauth_state")
+	// the nonce is single-use: clear it before anything below can fail
+	var nonce string
+	if nonceCookie, err := s.cfg.Cookies.Get(r, "oauth_nonce"); err == nil {
+		nonce = nonceCookie.Value
+	}
+	s.setCookie(w, r, "oauth_nonce", "", -1)
+
+	stateCookie, err := s.cfg.Cookies.Get(r, "oauth_state")
 	if err != nil || stateCookie.Value != r.URL.Query().Get("state") {
-		s.DeleteSession(w, r)
-		http.Redirect(w, r, framework.UrlFor(r, s.loginFailureRedirect), http.StatusTemporaryRedirect)
+		s.failCallback(w, r, "state_mismatch", nil)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "oauth_state",
-		Value:    "",
-		Path:     "/",
-		MaxAge:   -1,
-		HttpOnly: true,
-		Secure:   !s.cfg.IsDev,
-		SameSite: http.SameSiteLaxMode,
-	})
+	s.setCookie(w, r, "oauth_state", "", -1)
 
 	code := r.URL.Query().Get("code")
-	token, rawIDToken, err := s.ExchangeToken(ctx, code)
+	token, rawIDToken, err := s.ExchangeToken(ctx, code, s.redirectURI(r))
 	if err != nil {
-		slog.Error("token exchange failed", "error", err)
-		s.DeleteSession(w, r)
-		http.Redirect(w, r, framework.UrlFor(r, s.loginFailureRedirect), http.StatusTemporaryRedirect)
+		s.failCallback(w, r, "token_exchange_failed", err)
 		return
 	}
 
 	claims := &oidcClaims{}
 	stdClaims, rawClaims, err := s.VerifyToken(ctx, rawIDToken, claims)
 	if err != nil {
-		slog.Error("token verification failed", "error", err)
-		s.DeleteSession(w, r)
-		http.Redirect(w, r, framework.UrlFor(r, s.loginFailureRedirect), http.StatusTemporaryRedirect)
+		s.failCallback(w, r, "token_verification_failed", err)
 		return
 	}
 
 	claims = stdClaims.(*oidcClaims)
 
+	limiterKeys := loginLimiterKeys(claims)
+	if until, locked, err := s.loginLimiter.lockedUntil(ctx, limiterKeys...); err != nil {
+		framework.GetLogger(r).Warn("login lockout check failed, proceeding without it", "sub", claims.Sub, "error", err)
+	} else if locked {
+		s.failCallback(w, r, "locked_out", nil, "sub", claims.Sub, "locked_until", until)
+		return
+	}
+
+	// a token minted for another login is a replay or injection attempt, not a failed login
+	// to retry, so it is refused outright rather than sent back to the login page
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		s.recordLoginFailure(r, limiterKeys, "sub", claims.Sub)
+		s.logAuthEvent(r, slog.LevelWarn, "callback_failure", "reason", "nonce_mismatch", "sub", claims.Sub)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
 	roles, err := s.ExtractRoles(rawClaims)
 	if err != nil {
 		slog.Warn("role extraction failed, proceeding without roles", "error", err)
 		roles = nil
 	}
 
+	groups, err := s.ExtractGroups(rawClaims)
+	if err != nil {
+		slog.Warn("group extraction failed, proceeding without groups", "error", err)
+		groups = nil
+	}
+
+	tenantID, err := s.ExtractTenant(rawClaims)
+	if err != nil {
+		s.failLogin(w, r, limiterKeys, "tenant_extraction_failed", err, "sub", claims.Sub)
+		return
+	}
+
+	sessionClaims, err := s.sessionClaims(rawClaims)
+	if err != nil {
+		slog.Warn("claim filtering failed, proceeding without custom claims", "error", err)
+		sessionClaims = nil
+	}
+
+	scopes := grantedScopes(token, s.oauth2Config.Scopes)
+	if missing := missingScopes(s.oauth2Config.Scopes, scopes); len(missing) > 0 {
+		s.logAuthEvent(r, slog.LevelWarn, "scope_mismatch", "sub", claims.Sub, "requested", s.oauth2Config.Scopes, "granted", scopes, "missing", missing)
+	}
+
+	if !s.emailDomainAllowed(claims) {
+		s.recordLoginFailure(r, limiterKeys, "sub", claims.Sub)
+		s.logAuthEvent(r, slog.LevelWarn, "access_denied", "sub", claims.Sub, "email", claims.Email)
+		s.recordAudit(r, "login_denied", nil, claims.Email, map[string]any{"reason": "email_domain"})
+		s.DeleteSession(w, r)
+		redirect := s.accessDeniedRedirect
+		if redirect == "" {
+			redirect = s.loginFailureRedirect
+		}
+		http.Redirect(w, r, redirectURL(r, redirect), http.StatusTemporaryRedirect)
+		return
+	}
+
 	displayName := claims.Name
 	if displayName == "" {
 		displayName = claims.Email
 	}
+	attributes, err := s.userAttributes(rawClaims)
+	if err != nil {
+		slog.Warn("attribute extraction failed, proceeding without user attributes", "error", err)
+		attributes = nil
+	}
+	loginInfo := LoginInfo{Email: claims.Email, Name: displayName, TenantID: tenantID, Attributes: attributes}
 
 	identity, err := s.identityManager.UpsertIdentity(ctx, claims.Sub)
 	if err != nil {
-		slog.Error("identity upsert failed", "error", err)
-		s.DeleteSession(w, r)
-		http.Redirect(w, r, framework.UrlFor(r, s.loginFailureRedirect), http.StatusTemporaryRedirect)
+		s.failCallback(w, r, "identity_upsert_failed", err, "sub", claims.Sub)
 		return
 	}
 
 	if identity.UserID == nil && s.onFirstLogin != nil {
-		userID, err := s.onFirstLogin(ctx, claims.Email, displayName)
+		userID, err := s.onFirstLogin(ctx, loginInfo)
 		if err != nil {
-			slog.Error("first login provisioning failed", "error", err)
-			s.DeleteSession(w, r)
-			http.Redirect(w, r, framework.UrlFor(r, s.loginFailureRedirect), http.StatusTemporaryRedirect)
+			s.failLogin(w, r, limiterKeys, "provisioning_failed", err, "sub", claims.Sub, "identity_id", identity.ID)
 			return
 		}
 		if err := s.identityManager.LinkUser(ctx, identity.ID, userID); err != nil {
-			slog.Error("identity link failed", "identity_id", identity.ID, "user_id", userID, "error", err)
-			s.DeleteSession(w, r)
-			http.Redirect(w, r, framework.UrlFor(r, s.loginFailureRedirect), http.StatusTemporaryRedirect)
+			s.failCallback(w, r, "identity_link_failed", err, "identity_id", identity.ID, "user_id", userID)
 			return
 		}
-		slog.Info("first login: provisioned user and linked identity", "identity_id", identity.ID, "user_id", userID)
+		identity.UserID = &userID
+		s.logAuthEvent(r, slog.LevelInfo, "first_login", "identity_id", identity.ID, "user_id", userID)
 	} else if identity.UserID != nil && s.onLogin != nil {
-		if err := s.onLogin(ctx, *identity.UserID, claims.Email, displayName); err != nil {
+		if err := s.onLogin(ctx, *identity.UserID, loginInfo); err != nil {
 			slog.Warn("onLogin hook failed", "identity_id", identity.ID, "user_id", identity.UserID, "error", err)
 		}
-		slog.Info("login", "identity_id", identity.ID, "user_id", identity.UserID)
 	}
 
 	sessionID := s.GenerateState()
 	if err := s.SetSession(ctx, sessionID, models.SessionData{
-		Token:      token,
-		IDToken:    rawIDToken,
-		SubjectID:  claims.Sub,
-		IdentityID: identity.ID,
-		Roles:      roles,
-		Expires:    time.Now().Add(24 * time.Hour),
+		Token:         token,
+		IDToken:       rawIDToken,
+		SubjectID:     claims.Sub,
+		IdentityID:    identity.ID,
+		Roles:         roles,
+		Groups:        groups,
+		TenantID:      tenantID,
+		Claims:        sessionClaims,
+		GrantedScopes: scopes,
+		VerifiedAt:    time.Now(),
+		Expires:       time.Now().Add(s.cfg.SessionTTL),
 	}); err != nil {
-		slog.Error("session creation failed", "error", err)
-		s.DeleteSession(w, r)
-		http.Redirect(w, r, framework.UrlFor(r, s.loginFailureRedirect), http.StatusTemporaryRedirect)
+		s.failCallback(w, r, "session_creation_failed", err, "identity_id", identity.ID)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_id",
-		Value:    sessionID,
-		Path:     "/",
-		MaxAge:   86400,
-		HttpOnly: true,
-		Secure:   !s.cfg.IsDev,
-		SameSite: http.SameSiteLaxMode,
-	})
+	s.setCookie(w, r, "session_id", sessionID, int(s.cfg.SessionTTL/time.Second))
 
-	http.Redirect(w, r, framework.UrlFor(r, s.loginRedirect), http.StatusTemporaryRedirect)
+	if err := s.loginLimiter.reset(ctx, limiterKeys...); err != nil {
+		framework.GetLogger(r).Warn("failed to reset login failures", "identity_id", identity.ID, "error", err)
+	}
+	s.logAuthEvent(r, slog.LevelInfo, "callback_success", "identity_id", identity.ID, "user_id", identity.UserID)
+	s.recordAudit(r, "login", identity.UserID, fmt.Sprintf("identity:%d", identity.ID), nil)
+	target := s.consumeReturnTo(w, r)
+	if target == "" {
+		target = redirectURL(r, s.loginRedirect)
+	}
+	http.Redirect(w, r, target, http.StatusTemporaryRedirect)
+}
+
+// returnToCookie carries the page RequireAuth turned an anonymous visitor away from, so
+// Callback can send them back there after login instead of to the login redirect.
+const (
+	returnToCookie = "login_return_to"
+	returnToTTL    = 10 * time.Minute
+)
+
+// rememberReturnTo stores the requested page in returnToCookie, encrypted and stamped with
+// an expiry so it cannot be forged or replayed later. Only plain GET page loads are kept:
+// htmx requests fetch fragments and other methods cannot be repeated by a redirect.
+func (s *AuthService) rememberReturnTo(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.RequestURI()
+	if r.Method != http.MethodGet || framework.IsHTMX(r) || !isLocalPath(target) {
+		return
+	}
+	payload := strconv.FormatInt(time.Now().Add(returnToTTL).Unix(), 10) + "|" + target
+	sealed, err := encrypt([]byte(payload), s.keys.State)
+	if err != nil {
+		framework.GetLogger(r).Warn("failed to store login return path", "error", err)
+		return
+	}
+	s.setCookie(w, r, returnToCookie, base64.RawURLEncoding.EncodeToString(sealed), int(returnToTTL/time.Second))
+}
+
+// consumeReturnTo clears returnToCookie and returns the path it holds, or "" if there is
+// none or it is expired, tampered with or not a local path.
+func (s *AuthService) consumeReturnTo(w http.ResponseWriter, r *http.Request) string {
+	cookie, err := s.cfg.Cookies.Get(r, returnToCookie)
+	if err != nil {
+		return ""
+	}
+	s.setCookie(w, r, returnToCookie, "", -1)
+
+	sealed, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return ""
+	}
+	payload, err := decrypt(sealed, s.keys.State)
+	if err != nil {
+		return ""
+	}
+	expires, target, ok := strings.Cut(string(payload), "|")
+	if !ok {
+		return ""
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().After(time.Unix(unix, 0)) || !isLocalPath(target) {
+		return ""
+	}
+	return target
+}
+
+// isLocalPath reports whether target is an absolute path on this site, guarding redirects
+// against "//host" and "/\host", which browsers resolve as other origins.
+func isLocalPath(target string) bool {
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.ContainsAny(target, "\\\r\n\t") {
+		return false
+	}
+	u, err := url.Parse(target)
+	return err == nil && u.Scheme == "" && u.Host == "" && u.User == nil
+}
+
+// failCallback records a callback_failure auth event, clears any session and sends the
+// user to the login failure page.
+func (s *AuthService) failCallback(w http.ResponseWriter, r *http.Request, reason string, err error, attrs ...any) {
+	attrs = append(attrs, "reason", reason)
+	if err != nil {
+		attrs = append(attrs, "error", err)
+	}
+	s.logAuthEvent(r, slog.LevelWarn, "callback_failure", attrs...)
+	s.DeleteSession(w, r)
+	http.Redirect(w, r, redirectURL(r, s.loginFailureRedirect), http.StatusTemporaryRedirect)
+}
+
+// failLogin is failCallback for failures that count towards the account's login limit.
+func (s *AuthService) failLogin(w http.ResponseWriter, r *http.Request, limiterKeys []string, reason string, err error, attrs ...any) {
+	s.recordLoginFailure(r, limiterKeys, attrs...)
+	s.failCallback(w, r, reason, err, attrs...)
+}
+
+// recordLoginFailure counts a failed login against limiterKeys, logging a login_locked_out
+// auth event with attrs when it locks the account.
+func (s *AuthService) recordLoginFailure(r *http.Request, limiterKeys []string, attrs ...any) {
+	until, err := s.loginLimiter.fail(r.Context(), limiterKeys...)
+	if err != nil {
+		framework.GetLogger(r).Warn("failed to record login failure", append(slices.Clip(attrs), "error", err)...)
+	}
+	if !until.IsZero() {
+		s.logAuthEvent(r, slog.LevelWarn, "login_locked_out", append(slices.Clip(attrs), "locked_until", until)...)
+	}
 }
 
 // Logout handles POST /logout
 func (s *AuthService) Logout(w http.ResponseWriter, r *http.Request) {
+	var attrs []any
+	if session := framework.GetAuthSession(r); session != nil {
+		attrs = append(attrs, "identity_id", session.IdentityID, "user_id", session.UserID)
+		s.recordAudit(r, "logout", session.UserID, fmt.Sprintf("identity:%d", session.IdentityID), nil)
+	}
+	s.logAuthEvent(r, slog.LevelInfo, "logout", attrs...)
+
 	s.DeleteSession(w, r)
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	framework.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// DeleteSessionsForUser revokes every session of userID across devices, e.g. when the
+// account may be compromised. Sessions are removed from the database only; provider-side
+// logout is left to each session's refresh token expiring.
+func (s *AuthService) DeleteSessionsForUser(ctx context.Context, userID models.UserID) (int64, error) {
+	return s.sessionManager.DeleteSessionsByUser(ctx, userID)
+}
+
+// LogoutAll handles POST /logout-all: it ends the current session like Logout, including
+// provider-side logout and clearing the cookie, and then every other session of the user.
+func (s *AuthService) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	session := framework.GetAuthSession(r)
+	if session == nil || session.UserID == nil {
+		s.Logout(w, r)
+		return
+	}
+
+	s.DeleteSession(w, r)
+	deleted, err := s.DeleteSessionsForUser(r.Context(), *session.UserID)
+	if err != nil {
+		s.logAuthEvent(r, slog.LevelError, "logout_all_failure", "user_id", *session.UserID, "error", err)
+		framework.WriteError(w, r, err)
+		return
+	}
+	s.logAuthEvent(r, slog.LevelInfo, "logout_all", "identity_id", session.IdentityID, "user_id", *session.UserID, "sessions", deleted+1)
+	s.recordAudit(r, "logout_all", session.UserID, fmt.Sprintf("user:%s", *session.UserID), map[string]any{"sessions": deleted + 1})
+	framework.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// logAuthEvent emits a structured authentication event. Every event carries the same
+// "event", "provider" and "request_id" fields so security tooling can filter on them.
+func (s *AuthService) logAuthEvent(r *http.Request, level slog.Level, event string, attrs ...any) {
+	attrs = append([]any{
+		"event", event,
+		"provider", s.cfg.OIDCIssuerURL,
+		"request_id", framework.GetRequestID(r),
+	}, attrs...)
+	slog.Log(r.Context(), level, "auth", attrs...)
+}
+
+// recordAudit writes an audit event if an audit log is configured. Failures are logged
+// rather than returned so auditing never blocks authentication.
+func (s *AuthService) recordAudit(r *http.Request, action string, actor *models.UserID, target string, details map[string]any) {
+	if s.audit == nil {
+		return
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if details == nil {
+		details = map[string]any{}
+	}
+	details["request_id"] = framework.GetRequestID(r)
+
+	if err := s.audit.Record(r.Context(), models.AuditEvent{
+		ActorUserID: actor,
+		Action:      action,
+		Target:      target,
+		IP:          ip,
+		Details:     details,
+	}); err != nil {
+		slog.Warn("failed to record audit event", "action", action, "error", err)
+	}
 }
 
 func (s *AuthService) DeleteSession(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("session_id")
+	cookie, err := s.cfg.Cookies.Get(r, "session_id")
 	if err == nil {
-		if session, exists := s.GetSession(r.Context(), cookie.Value); exists {
+		if session, err := s.GetSession(r.Context(), cookie.Value); err == nil {
 			s.RevokeSession(*session)
 		}
 		_ = s.sessionManager.DeleteSession(r.Context(), cookie.Value)
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_id",
-		Value:    "",
-		Path:     "/",
-		MaxAge:   -1,
-		HttpOnly: true,
-		Secure:   !s.cfg.IsDev,
-		SameSite: http.SameSiteLaxMode,
-	})
+	s.setCookie(w, r, "session_id", "", -1)
 }
@@ -0,0 +1,813 @@
+package web
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/antonkarounis/stoic/internal/adapters/memory"
+	"github.com/antonkarounis/stoic/internal/adapters/web/framework"
+	"github.com/antonkarounis/stoic/internal/domain/models"
+	"github.com/antonkarounis/stoic/internal/domain/ports"
+	"github.com/go-jose/go-jose/v4"
+	"golang.org/x/oauth2"
+)
+
+const testClientID = "stoic-test"
+
+// testProvider is an OIDC provider serving the token endpoint; its discovery document,
+// with the signing key inline, is passed to NewAuthService so no discovery fetch happens.
+// The ID token it issues carries the claims set with idTokenClaims.
+type testProvider struct {
+	t      *testing.T
+	key    *rsa.PrivateKey
+	server *httptest.Server
+
+	mu     sync.Mutex
+	claims map[string]any
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testProvider{t: t, key: key}
+	p.server = httptest.NewServer(http.HandlerFunc(p.token))
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *testProvider) issuer() string { return p.server.URL }
+
+func (p *testProvider) discoveryDocument() []byte {
+	doc, err := json.Marshal(map[string]any{
+		"issuer":                                p.issuer(),
+		"authorization_endpoint":                p.issuer() + "/auth",
+		"token_endpoint":                        p.issuer() + "/token",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"jwks": jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &p.key.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"},
+		}},
+	})
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	return doc
+}
+
+// idTokenClaims sets the claims of the ID tokens issued from now on, on top of iss, aud,
+// iat and exp.
+func (p *testProvider) idTokenClaims(claims map[string]any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.claims = claims
+}
+
+// sign returns a JWT with claims on top of the standard ones, expiring after ttl.
+func (p *testProvider) sign(claims map[string]any, ttl time.Duration) string {
+	p.t.Helper()
+	now := time.Now()
+	all := map[string]any{
+		"iss": p.issuer(),
+		"aud": testClientID,
+		"iat": now.Unix(),
+		"exp": now.Add(ttl).Unix(),
+	}
+	for k, v := range claims {
+		all[k] = v
+	}
+	payload, err := json.Marshal(all)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: p.key}, (&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "test"))
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	signed, err := signer.Sign(payload)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	raw, err := signed.CompactSerialize()
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	return raw
+}
+
+func (p *testProvider) token(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/token" {
+		http.NotFound(w, r)
+		return
+	}
+	p.mu.Lock()
+	claims := p.claims
+	p.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"access_token":  "access-" + r.FormValue("code"),
+		"refresh_token": "refresh-" + r.FormValue("code"),
+		"token_type":    "Bearer",
+		"expires_in":    3600,
+		"id_token":      p.sign(claims, time.Hour),
+	})
+}
+
+// testIdentities is an in-memory ports.IdentityRepository.
+type testIdentities struct {
+	mu     sync.Mutex
+	bySub  map[string]models.Identity
+	nextID int64
+}
+
+func newTestIdentities() *testIdentities {
+	return &testIdentities{bySub: map[string]models.Identity{}}
+}
+
+func (r *testIdentities) GetIdentityByID(ctx context.Context, identityID int64) (models.Identity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, identity := range r.bySub {
+		if identity.ID == identityID {
+			return identity, nil
+		}
+	}
+	return models.Identity{}, ports.ErrNotFound
+}
+
+func (r *testIdentities) GetIdentityBySub(ctx context.Context, authSub string) (models.Identity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	identity, ok := r.bySub[authSub]
+	if !ok {
+		return models.Identity{}, ports.ErrNotFound
+	}
+	return identity, nil
+}
+
+func (r *testIdentities) UpsertIdentity(ctx context.Context, authSub string) (models.Identity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	identity, ok := r.bySub[authSub]
+	if !ok {
+		r.nextID++
+		identity = models.Identity{ID: r.nextID, AuthSub: authSub}
+		r.bySub[authSub] = identity
+	}
+	return identity, nil
+}
+
+func (r *testIdentities) LinkUser(ctx context.Context, identityID int64, userID models.UserID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for sub, identity := range r.bySub {
+		if identity.ID == identityID {
+			identity.UserID = &userID
+			r.bySub[sub] = identity
+			return nil
+		}
+	}
+	return ports.ErrNotFound
+}
+
+// testAuth is an AuthService wired to a testProvider and in-memory repositories.
+type testAuth struct {
+	*AuthService
+	provider   *testProvider
+	sessions   *memory.SessionRepository
+	identities *testIdentities
+}
+
+// newTestAuth returns a testAuth; configure adjusts the AuthConfig before the service is built.
+func newTestAuth(t *testing.T, configure func(*AuthConfig)) *testAuth {
+	t.Helper()
+	provider := newTestProvider(t)
+	cfg := &AuthConfig{
+		OIDCIssuerURL:     provider.issuer(),
+		OIDCClientID:      testClientID,
+		OIDCClientSecret:  "secret",
+		AppURL:            "http://localhost:8080",
+		SecretKey:         []byte("0123456789abcdef0123456789abcdef"),
+		DiscoveryDocument: provider.discoveryDocument(),
+	}
+	if configure != nil {
+		configure(cfg)
+	}
+
+	identities := newTestIdentities()
+	sessions := memory.NewSessionRepository(identities)
+	s, err := NewAuthService(context.Background(), cfg, sessions, identities)
+	if err != nil {
+		t.Fatalf("NewAuthService: %v", err)
+	}
+	s.SetLoginRedirect("/app/dashboard")
+	s.SetLoginFailureRedirect("/login")
+	return &testAuth{AuthService: s, provider: provider, sessions: sessions, identities: identities}
+}
+
+// login runs Login, then answers Callback with an ID token carrying claims and the nonce
+// of the login. tamper, if set, may change the callback request before it is served.
+func (a *testAuth) login(t *testing.T, claims map[string]any, tamper func(r *http.Request)) *httptest.ResponseRecorder {
+	t.Helper()
+	start := httptest.NewRecorder()
+	a.Login(start, httptest.NewRequest(http.MethodGet, "/login", nil))
+	if start.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("Login: status %d", start.Code)
+	}
+	authURL, err := url.Parse(start.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idClaims := map[string]any{"nonce": authURL.Query().Get("nonce")}
+	for k, v := range claims {
+		idClaims[k] = v
+	}
+	a.provider.idTokenClaims(idClaims)
+
+	r := httptest.NewRequest(http.MethodGet, "/callback?code=abc&state="+url.QueryEscape(authURL.Query().Get("state")), nil)
+	for _, c := range start.Result().Cookies() {
+		r.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+	}
+	if tamper != nil {
+		tamper(r)
+	}
+	rec := httptest.NewRecorder()
+	a.Callback(rec, r)
+	return rec
+}
+
+// responseCookie returns the cookie named name set by rec, or nil.
+func responseCookie(rec *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestCallbackLogsIn(t *testing.T) {
+	a := newTestAuth(t, nil)
+
+	rec := a.login(t, map[string]any{"sub": "alice", "email": "alice@example.com"}, nil)
+
+	if rec.Code != http.StatusTemporaryRedirect || rec.Header().Get("Location") != "/app/dashboard" {
+		t.Fatalf("got %d to %q, want redirect to /app/dashboard", rec.Code, rec.Header().Get("Location"))
+	}
+	session := responseCookie(rec, "session_id")
+	if session == nil || session.Value == "" {
+		t.Fatal("no session cookie set")
+	}
+	if _, err := a.GetSession(context.Background(), session.Value); err != nil {
+		t.Fatalf("GetSession: %v", err)
+	}
+}
+
+func TestCallbackRejectsNonceMismatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(r *http.Request)
+	}{
+		{"tampered nonce cookie", func(r *http.Request) {
+			replaceCookie(r, "oauth_nonce", "forged")
+		}},
+		{"missing nonce cookie", func(r *http.Request) {
+			replaceCookie(r, "oauth_nonce", "")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAuth(t, nil)
+
+			rec := a.login(t, map[string]any{"sub": "alice"}, tt.tamper)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+			if c := responseCookie(rec, "session_id"); c != nil && c.Value != "" {
+				t.Error("session cookie set for a rejected callback")
+			}
+			if c := responseCookie(rec, "oauth_nonce"); c == nil || c.MaxAge >= 0 {
+				t.Error("nonce cookie not cleared")
+			}
+		})
+	}
+}
+
+func TestCallbackRejectsTokenFromAnotherLogin(t *testing.T) {
+	a := newTestAuth(t, nil)
+
+	// the provider issues a token carrying some other login's nonce
+	rec := a.login(t, map[string]any{"sub": "alice", "nonce": "nonce-of-another-login"}, nil)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestCallbackClearsNonceOnStateMismatch(t *testing.T) {
+	a := newTestAuth(t, nil)
+
+	rec := a.login(t, map[string]any{"sub": "alice"}, func(r *http.Request) {
+		replaceCookie(r, "oauth_state", "forged")
+	})
+
+	if rec.Code != http.StatusTemporaryRedirect || rec.Header().Get("Location") != "/login" {
+		t.Errorf("got %d to %q, want redirect to /login", rec.Code, rec.Header().Get("Location"))
+	}
+	if c := responseCookie(rec, "oauth_nonce"); c == nil || c.MaxAge >= 0 {
+		t.Error("nonce cookie not cleared")
+	}
+}
+
+// replaceCookie replaces the request cookie named name; an empty value removes it.
+func replaceCookie(r *http.Request, name, value string) {
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, c := range cookies {
+		if c.Name != name {
+			r.AddCookie(c)
+		}
+	}
+	if value != "" {
+		r.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+}
+
+// loggedInSession logs in as sub, with claims added to the ID token, and returns the
+// session ID and the loaded session.
+func (a *testAuth) loggedInSession(t *testing.T, sub string, claims map[string]any) (string, *models.SessionData) {
+	t.Helper()
+	idClaims := map[string]any{"sub": sub}
+	for k, v := range claims {
+		idClaims[k] = v
+	}
+	rec := a.login(t, idClaims, nil)
+	cookie := responseCookie(rec, "session_id")
+	if cookie == nil {
+		t.Fatalf("login failed: %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	session, err := a.GetSession(context.Background(), cookie.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cookie.Value, session
+}
+
+// storedTokenData returns the encrypted token data stored for sessionID. It is encrypted
+// with a fresh nonce on every write, so it changes whenever the session is rewritten.
+func (a *testAuth) storedTokenData(t *testing.T, sessionID string) string {
+	t.Helper()
+	session, err := a.sessions.GetSession(context.Background(), sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(session.TokenData)
+}
+
+// refreshWith makes refreshes return token, or fail with err if it is set.
+func (a *testAuth) refreshWith(token *oauth2.Token, err error) {
+	a.SetTokenSourceFactory(func(ctx context.Context, _ *oauth2.Token) oauth2.TokenSource {
+		return tokenSourceFunc(func() (*oauth2.Token, error) { return token, err })
+	})
+}
+
+type tokenSourceFunc func() (*oauth2.Token, error)
+
+func (f tokenSourceFunc) Token() (*oauth2.Token, error) { return f() }
+
+func TestRefreshTokenWritesOnlyChangedTokens(t *testing.T) {
+	tests := []struct {
+		name      string
+		change    func(token *oauth2.Token)
+		wantWrite bool
+	}{
+		{"provider returns the same token", func(*oauth2.Token) {}, false},
+		{"provider returns a new access token", func(token *oauth2.Token) {
+			token.AccessToken = "access-2"
+			token.Expiry = time.Now().Add(time.Hour)
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAuth(t, func(cfg *AuthConfig) { cfg.RoleRefreshInterval = -1 })
+			sessionID, session := a.loggedInSession(t, "alice", nil)
+			session.Token.Expiry = time.Now().Add(-time.Minute)
+			before := a.storedTokenData(t, sessionID)
+
+			refreshed := *session.Token
+			tt.change(&refreshed)
+			a.refreshWith(&refreshed, nil)
+			if err := a.RefreshToken(context.Background(), sessionID, session); err != nil {
+				t.Fatalf("RefreshToken: %v", err)
+			}
+
+			if written := a.storedTokenData(t, sessionID) != before; written != tt.wantWrite {
+				t.Errorf("session written = %v, want %v", written, tt.wantWrite)
+			}
+			if session.Token.AccessToken != refreshed.AccessToken {
+				t.Errorf("session access token = %q, want %q", session.Token.AccessToken, refreshed.AccessToken)
+			}
+		})
+	}
+}
+
+func TestCallbackUsesCustomRoleExtractor(t *testing.T) {
+	a := newTestAuth(t, nil)
+	var gotClientID string
+	a.SetRoleExtractor(func(rawClaims json.RawMessage, clientID string) ([]string, error) {
+		gotClientID = clientID
+		var claims struct {
+			Permissions []string `json:"permissions"`
+		}
+		err := json.Unmarshal(rawClaims, &claims)
+		return claims.Permissions, err
+	})
+
+	_, session := a.loggedInSession(t, "alice", map[string]any{"permissions": []string{"admin", "billing"}})
+
+	if !slices.Equal(session.Roles, []string{"admin", "billing"}) {
+		t.Errorf("session roles = %v, want [admin billing]", session.Roles)
+	}
+	if gotClientID != testClientID {
+		t.Errorf("extractor got client ID %q, want %q", gotClientID, testClientID)
+	}
+}
+
+func TestProviderRoleExtractors(t *testing.T) {
+	tests := []struct {
+		name      string
+		extractor RoleExtractor
+		claims    string
+		want      []string
+		wantErr   bool
+	}{
+		{"auth0 roles", NewAuth0RoleExtractor("https://example.com"), `{"sub":"a","https://example.com/roles":["admin","editor"]}`, []string{"admin", "editor"}, false},
+		{"auth0 namespace with trailing slash", NewAuth0RoleExtractor("https://example.com/"), `{"https://example.com/roles":["admin"]}`, []string{"admin"}, false},
+		{"auth0 single role as a string", NewAuth0RoleExtractor("https://example.com"), `{"https://example.com/roles":"admin"}`, []string{"admin"}, false},
+		{"auth0 empty roles", NewAuth0RoleExtractor("https://example.com"), `{"https://example.com/roles":[]}`, []string{}, false},
+		{"auth0 missing claim", NewAuth0RoleExtractor("https://example.com"), `{"sub":"a"}`, nil, false},
+		{"auth0 other namespace ignored", NewAuth0RoleExtractor("https://example.com"), `{"https://other.example/roles":["admin"]}`, nil, false},
+		{"auth0 malformed claim", NewAuth0RoleExtractor("https://example.com"), `{"https://example.com/roles":{"admin":true}}`, nil, true},
+		{"okta groups", OktaRoleExtractor, `{"sub":"a","groups":["Everyone","Admins"]}`, []string{"Everyone", "Admins"}, false},
+		{"okta empty groups", OktaRoleExtractor, `{"groups":[]}`, []string{}, false},
+		{"okta missing claim", OktaRoleExtractor, `{"sub":"a"}`, nil, false},
+		{"okta malformed claim", OktaRoleExtractor, `{"groups":42}`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.extractor(json.RawMessage(tt.claims), testClientID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("roles = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefreshTokenPersistsRotatedRefreshToken(t *testing.T) {
+	a := newTestAuth(t, func(cfg *AuthConfig) { cfg.RoleRefreshInterval = -1 })
+	sessionID, session := a.loggedInSession(t, "alice", nil)
+	session.Token.Expiry = time.Now().Add(-time.Minute)
+	before := a.storedTokenData(t, sessionID)
+
+	a.refreshWith(&oauth2.Token{AccessToken: "access-2", RefreshToken: "refresh-2", Expiry: time.Now().Add(time.Hour)}, nil)
+	if err := a.RefreshToken(context.Background(), sessionID, session); err != nil {
+		t.Fatalf("RefreshToken: %v", err)
+	}
+
+	if a.storedTokenData(t, sessionID) == before {
+		t.Fatal("stored token data unchanged after rotation")
+	}
+	stored, err := a.GetSession(context.Background(), sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Token.RefreshToken != "refresh-2" {
+		t.Errorf("stored refresh token = %q, want the rotated one", stored.Token.RefreshToken)
+	}
+}
+
+func TestCheckAuthRefreshFailure(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantDeleted bool
+	}{
+		{"invalid_grant ends the session", &oauth2.RetrieveError{ErrorCode: "invalid_grant"}, true},
+		{"transient failure keeps the session", errors.New("connection refused"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			a := newTestAuth(t, func(cfg *AuthConfig) { cfg.RoleRefreshInterval = -1 })
+			sessionID, session := a.loggedInSession(t, "alice", nil)
+			session.Token.Expiry = time.Now().Add(-time.Minute)
+			if err := a.SetSession(ctx, sessionID, *session); err != nil {
+				t.Fatal(err)
+			}
+			a.refreshWith(nil, tt.err)
+
+			r := httptest.NewRequest(http.MethodGet, "/app/dashboard", nil)
+			r.AddCookie(&http.Cookie{Name: "session_id", Value: sessionID})
+			rec := httptest.NewRecorder()
+			var authenticated bool
+			a.CheckAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				authenticated = framework.GetAuthSession(r) != nil
+			})).ServeHTTP(rec, r)
+
+			if authenticated {
+				t.Error("request authenticated after a failed refresh")
+			}
+			_, err := a.sessions.GetSession(ctx, sessionID)
+			if deleted := errors.Is(err, ports.ErrNotFound); deleted != tt.wantDeleted {
+				t.Errorf("session deleted = %v, want %v", deleted, tt.wantDeleted)
+			}
+			if cleared := responseCookie(rec, "session_id") != nil; cleared != tt.wantDeleted {
+				t.Errorf("session cookie cleared = %v, want %v", cleared, tt.wantDeleted)
+			}
+		})
+	}
+}
+
+func TestLogoutAllEndsEverySessionOfTheUser(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAuth(t, nil)
+	a.SetFirstLoginHook(func(ctx context.Context, info LoginInfo) (models.UserID, error) {
+		return models.UserID("user-" + info.Email), nil
+	})
+
+	current, session := a.loggedInSession(t, "alice", map[string]any{"email": "alice@example.com"})
+	other, _ := a.loggedInSession(t, "alice", map[string]any{"email": "alice@example.com"})
+	bob, _ := a.loggedInSession(t, "bob", map[string]any{"email": "bob@example.com"})
+
+	r := httptest.NewRequest(http.MethodPost, "/logout-all", nil)
+	r.AddCookie(&http.Cookie{Name: "session_id", Value: current})
+	rec := httptest.NewRecorder()
+	a.LogoutAll(rec, framework.SetAuthSession(r, session))
+
+	for _, id := range []string{current, other} {
+		if _, err := a.sessions.GetSession(ctx, id); !errors.Is(err, ports.ErrNotFound) {
+			t.Errorf("alice's session %s survived: %v", id, err)
+		}
+	}
+	if _, err := a.sessions.GetSession(ctx, bob); err != nil {
+		t.Errorf("bob's session was removed: %v", err)
+	}
+	if c := responseCookie(rec, "session_id"); c == nil || c.MaxAge >= 0 {
+		t.Error("session cookie not cleared")
+	}
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/" {
+		t.Errorf("got %d to %q, want redirect to /", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestCallbackReturnsToDeepLink(t *testing.T) {
+	a := newTestAuth(t, nil)
+
+	// an anonymous visitor follows a deep link and is sent to log in
+	start := httptest.NewRecorder()
+	a.RequireAuth(http.NotFoundHandler()).ServeHTTP(start, httptest.NewRequest(http.MethodGet, "/app/reports?year=2026", nil))
+	if start.Header().Get("Location") != "/login" {
+		t.Fatalf("got redirect to %q, want /login", start.Header().Get("Location"))
+	}
+	returnTo := responseCookie(start, returnToCookie)
+	if returnTo == nil {
+		t.Fatal("return path not remembered")
+	}
+
+	rec := a.login(t, map[string]any{"sub": "alice"}, func(r *http.Request) {
+		r.AddCookie(&http.Cookie{Name: returnTo.Name, Value: returnTo.Value})
+	})
+
+	if got := rec.Header().Get("Location"); got != "/app/reports?year=2026" {
+		t.Errorf("redirect to %q, want the deep link", got)
+	}
+	if c := responseCookie(rec, returnToCookie); c == nil || c.MaxAge >= 0 {
+		t.Error("return path cookie not cleared")
+	}
+}
+
+func TestCallbackRejectsNonLocalReturnPath(t *testing.T) {
+	tests := []struct {
+		name   string
+		cookie func(t *testing.T, a *testAuth) string
+	}{
+		{"sealed absolute URL", func(t *testing.T, a *testAuth) string { return a.sealReturnTo(t, "https://evil.example/phish") }},
+		{"sealed protocol-relative URL", func(t *testing.T, a *testAuth) string { return a.sealReturnTo(t, "//evil.example/phish") }},
+		{"unsealed path", func(*testing.T, *testAuth) string { return "/app/reports" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAuth(t, nil)
+
+			rec := a.login(t, map[string]any{"sub": "alice"}, func(r *http.Request) {
+				r.AddCookie(&http.Cookie{Name: returnToCookie, Value: tt.cookie(t, a)})
+			})
+
+			if got := rec.Header().Get("Location"); got != "/app/dashboard" {
+				t.Errorf("redirect to %q, want the default /app/dashboard", got)
+			}
+		})
+	}
+}
+
+// sealReturnTo returns a valid returnToCookie value for target, bypassing the local-path
+// check rememberReturnTo makes.
+func (a *testAuth) sealReturnTo(t *testing.T, target string) string {
+	t.Helper()
+	sealed, err := encrypt([]byte(strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10)+"|"+target), a.keys.State)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(sealed)
+}
+
+func TestIsLocalPath(t *testing.T) {
+	tests := []struct {
+		target string
+		want   bool
+	}{
+		{"/app/reports", true},
+		{"/app/reports?year=2026#q1", true},
+		{"/", true},
+		{"app/reports", false},
+		{"https://evil.example/", false},
+		{"//evil.example/", false},
+		{"/\\evil.example/", false},
+		{"/app\r\nSet-Cookie: x=1", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isLocalPath(tt.target); got != tt.want {
+			t.Errorf("isLocalPath(%q) = %v, want %v", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestCheckAuthBearerToken(t *testing.T) {
+	a := newTestAuth(t, func(cfg *AuthConfig) { cfg.BearerAuth = true })
+	if _, err := a.identities.UpsertIdentity(context.Background(), "alice"); err != nil {
+		t.Fatal(err)
+	}
+	roles := map[string]any{"sub": "alice", "realm_access": map[string]any{"roles": []string{"admin"}}}
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+		wantRoles     []string // of the session the handler sees; nil for none
+	}{
+		{"valid token", "Bearer " + a.provider.sign(roles, time.Hour), http.StatusOK, []string{"admin"}},
+		{"lowercase scheme", "bearer " + a.provider.sign(roles, time.Hour), http.StatusOK, []string{"admin"}},
+		{"expired token", "Bearer " + a.provider.sign(roles, -time.Minute), http.StatusUnauthorized, nil},
+		{"unknown subject", "Bearer " + a.provider.sign(map[string]any{"sub": "mallory"}, time.Hour), http.StatusUnauthorized, nil},
+		{"malformed token", "Bearer not-a-jwt", http.StatusUnauthorized, nil},
+		{"empty token", "Bearer ", http.StatusUnauthorized, nil},
+		{"no header falls back to cookies", "", http.StatusOK, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			var session *models.SessionData
+			a.CheckAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				session = framework.GetAuthSession(r)
+			})).ServeHTTP(rec, r)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("no WWW-Authenticate challenge")
+			}
+			if (session != nil) != (tt.wantRoles != nil) {
+				t.Fatalf("authenticated = %v, want %v", session != nil, tt.wantRoles != nil)
+			}
+			if session != nil {
+				if !slices.Equal(session.Roles, tt.wantRoles) || session.SubjectID != "alice" {
+					t.Errorf("session for %q with roles %v, want alice with %v", session.SubjectID, session.Roles, tt.wantRoles)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthRequestScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		scopes  []string
+		refresh bool
+		want    []string
+	}{
+		{"default", nil, false, []string{"openid", "profile", "email"}},
+		{"configured", []string{"openid", "groups"}, false, []string{"openid", "groups"}},
+		{"openid always present", []string{"profile", "groups"}, false, []string{"openid", "profile", "groups"}},
+		{"refresh token requested", []string{"openid"}, true, []string{"openid", "offline_access"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &AuthConfig{OIDCIssuerURL: "http://localhost:8180/realms/stoic", Scopes: tt.scopes, RequestRefreshToken: tt.refresh}
+			scopes, _ := authRequestOptions(cfg)
+			if !slices.Equal(scopes, tt.want) {
+				t.Errorf("scopes = %q, want %q", scopes, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthCookiesFollowCookieConfig(t *testing.T) {
+	a := newTestAuth(t, func(cfg *AuthConfig) {
+		cookies, err := framework.NewCookies(ports.CookieConfig{Prefix: "billing_", Domain: "localhost", SameSite: "strict"}, cfg.AppURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.Cookies = cookies
+	})
+
+	start := httptest.NewRecorder()
+	a.Login(start, httptest.NewRequest(http.MethodGet, "/login", nil))
+	rec := a.login(t, map[string]any{"sub": "alice"}, nil)
+
+	tests := []struct {
+		rec      *httptest.ResponseRecorder
+		name     string
+		sameSite http.SameSite
+	}{
+		// the login flow cookies must survive the cross-site redirect back from the provider
+		{start, "billing_oauth_state", http.SameSiteLaxMode},
+		{start, "billing_oauth_nonce", http.SameSiteLaxMode},
+		{rec, "billing_session_id", http.SameSiteStrictMode},
+	}
+	for _, tt := range tests {
+		c := responseCookie(tt.rec, tt.name)
+		if c == nil {
+			t.Errorf("%s not set", tt.name)
+			continue
+		}
+		if c.Domain != "localhost" || c.SameSite != tt.sameSite || !c.HttpOnly {
+			t.Errorf("%s: Domain=%q SameSite=%v HttpOnly=%v, want Domain=localhost SameSite=%v HttpOnly", tt.name, c.Domain, c.SameSite, c.HttpOnly, tt.sameSite)
+		}
+	}
+	if c := responseCookie(rec, "session_id"); c != nil {
+		t.Error("unprefixed session_id set")
+	}
+}
+
+func TestCallbackLocksOutAfterRepeatedFailures(t *testing.T) {
+	a := newTestAuth(t, func(cfg *AuthConfig) { cfg.LoginMaxFailures = 3 })
+	valid := map[string]any{"sub": "alice", "email": "alice@example.com"}
+	// a token minted for another login counts as a failure against the account it names
+	failed := map[string]any{"sub": "alice", "email": "alice@example.com", "nonce": "nonce-of-another-login"}
+	loggedIn := func(rec *httptest.ResponseRecorder) bool {
+		return rec.Header().Get("Location") == "/app/dashboard" && responseCookie(rec, "session_id") != nil
+	}
+
+	// a successful login clears the failures before it
+	for range 2 {
+		a.login(t, failed, nil)
+	}
+	if rec := a.login(t, valid, nil); !loggedIn(rec) {
+		t.Fatalf("login after 2 failures: got %d to %q, want logged in", rec.Code, rec.Header().Get("Location"))
+	}
+	for range 2 {
+		a.login(t, failed, nil)
+	}
+	if rec := a.login(t, valid, nil); !loggedIn(rec) {
+		t.Fatalf("login after 2 more failures: got %d to %q, want logged in", rec.Code, rec.Header().Get("Location"))
+	}
+
+	for range 3 {
+		a.login(t, failed, nil)
+	}
+	if rec := a.login(t, valid, nil); loggedIn(rec) || rec.Header().Get("Location") != "/login" {
+		t.Errorf("valid login while locked out: got %d to %q, want redirect to /login", rec.Code, rec.Header().Get("Location"))
+	}
+	// the lockout covers the email, so another identity with it is locked out too
+	if rec := a.login(t, map[string]any{"sub": "alice-2", "email": "Alice@example.com"}, nil); loggedIn(rec) {
+		t.Error("second identity with the locked email logged in")
+	}
+	if rec := a.login(t, map[string]any{"sub": "bob", "email": "bob@example.com"}, nil); !loggedIn(rec) {
+		t.Errorf("other account: got %d to %q, want logged in", rec.Code, rec.Header().Get("Location"))
+	}
+}
@@ -0,0 +1,17 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/antonkarounis/stoic/internal/adapters/web/framework"
+)
+
+// AccessDenied renders the error page for users whose account is not permitted to sign in.
+func AccessDenied(registry *framework.TemplateRegistry) http.HandlerFunc {
+	return registry.Handle(func(w http.ResponseWriter, r *http.Request) error {
+		return &framework.HTTPError{
+			Status:  http.StatusForbidden,
+			Message: "Access not permitted. Your account is not allowed to sign in to this application.",
+		}
+	})
+}
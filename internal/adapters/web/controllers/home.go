@@ -8,7 +8,7 @@ import (
 
 func Home(registry *framework.TemplateRegistry) http.HandlerFunc {
 	return registry.BuildSimpleHandler("home.html",
-		func(w http.ResponseWriter, r *http.Request, te *framework.TemplateRenderer) {
-			te.WriteTo(w, nil)
+		func(w http.ResponseWriter, r *http.Request, te *framework.TemplateRenderer) error {
+			return te.WriteTo(w, nil)
 		})
 }
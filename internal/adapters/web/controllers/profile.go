@@ -1,7 +1,6 @@
 package controllers
 
 import (
-	"log/slog"
 	"net/http"
 
 	"github.com/antonkarounis/stoic/internal/adapters/web/framework"
@@ -20,20 +19,13 @@ type ProfileViewModel struct {
 
 func Profile(registry *framework.TemplateRegistry) http.HandlerFunc {
 	return registry.BuildHandler("profile.html", ProfileViewModel{},
-		func(w http.ResponseWriter, r *http.Request, te *framework.TemplateRenderer) {
+		func(w http.ResponseWriter, r *http.Request, te *framework.TemplateRenderer) error {
 			user, err := framework.GetUserFromContext(r)
 			if err != nil {
-				slog.Error("user context error", "error", err)
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-				return
+				return err
 			}
 
-			if err != nil {
-				httpError(w, err)
-				return
-			}
-
-			te.WriteTo(w, ProfileViewModel{
+			return te.WriteTo(w, ProfileViewModel{
 				Name:  user.Name,
 				Email: user.Email,
 			})
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/antonkarounis/stoic/internal/adapters/web/framework"
+	"github.com/antonkarounis/stoic/internal/domain/ports"
+)
+
+type SettingsViewModel struct {
+	Name     string
+	Theme    string
+	Locale   string
+	Timezone string
+	Saved    bool
+}
+
+// Settings handles GET /app/settings — shows the display name and preferences forms.
+func Settings(registry *framework.TemplateRegistry) http.HandlerFunc {
+	return registry.BuildHandler("settings.html", SettingsViewModel{},
+		func(w http.ResponseWriter, r *http.Request, te *framework.TemplateRenderer) error {
+			user, err := framework.GetUserFromContext(r)
+			if err != nil {
+				return err
+			}
+
+			prefs := framework.GetPreferences(r)
+			return te.WriteTo(w, SettingsViewModel{
+				Name:     user.Name,
+				Theme:    prefs.Theme,
+				Locale:   prefs.Locale,
+				Timezone: prefs.Timezone,
+				Saved:    r.URL.Query().Get("saved") == "1",
+			})
+		})
+}
+
+// UpdateSettings handles POST /app/settings — saves a custom display name, which later
+// logins no longer overwrite from the provider, then redirects back to the form.
+func UpdateSettings(registry *framework.TemplateRegistry, users ports.UserService) http.HandlerFunc {
+	return registry.Handle(func(w http.ResponseWriter, r *http.Request) error {
+		user, err := framework.GetUserFromContext(r)
+		if err != nil {
+			return err
+		}
+
+		if _, err := users.UpdateProfile(r.Context(), ports.UpdateProfileInput{
+			UserID: user.ID,
+			Name:   r.PostFormValue("name"),
+		}); err != nil {
+			return err
+		}
+
+		framework.Redirect(w, r, framework.UrlFor(r, "settings")+"?saved=1", http.StatusSeeOther)
+		return nil
+	})
+}
+
+// UpdatePreferences handles POST /app/settings/preferences — saves theme, locale and
+// timezone, then redirects back to the settings page.
+func UpdatePreferences(registry *framework.TemplateRegistry, users ports.UserService) http.HandlerFunc {
+	return registry.Handle(func(w http.ResponseWriter, r *http.Request) error {
+		user, err := framework.GetUserFromContext(r)
+		if err != nil {
+			return err
+		}
+
+		if _, err := users.UpdatePreferences(r.Context(), ports.UpdatePreferencesInput{
+			UserID:   user.ID,
+			Theme:    r.PostFormValue("theme"),
+			Locale:   r.PostFormValue("locale"),
+			Timezone: r.PostFormValue("timezone"),
+		}); err != nil {
+			return err
+		}
+
+		framework.Redirect(w, r, framework.UrlFor(r, "settings")+"?saved=1", http.StatusSeeOther)
+		return nil
+	})
+}
@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/antonkarounis/stoic/internal/adapters/web/framework"
+	"github.com/antonkarounis/stoic/internal/adapters/web/middleware"
+	"github.com/antonkarounis/stoic/internal/domain/ports"
+)
+
+const themeCookieMaxAge = 365 * 24 * 60 * 60
+
+// SetTheme handles POST /theme — sets the color theme from the "theme" form value
+// ("light", "dark", "auto", or "toggle" to flip light/dark). The choice is kept in a cookie
+// and, for logged-in users, saved to their preferences. Redirects back to the referring page.
+func SetTheme(registry *framework.TemplateRegistry, users ports.UserService, cookies *framework.Cookies) http.HandlerFunc {
+	return registry.Handle(func(w http.ResponseWriter, r *http.Request) error {
+		theme := r.PostFormValue("theme")
+		switch theme {
+		case "light", "dark", "auto":
+		case "toggle":
+			theme = "dark"
+			if framework.GetTheme(r) == "dark" {
+				theme = "light"
+			}
+		default:
+			return framework.BadRequest("theme must be light, dark, auto or toggle")
+		}
+
+		if user := framework.GetLoggedInUser(r); user != nil {
+			prefs := framework.GetPreferences(r)
+			if _, err := users.UpdatePreferences(r.Context(), ports.UpdatePreferencesInput{
+				UserID:   user.ID,
+				Theme:    theme,
+				Locale:   prefs.Locale,
+				Timezone: prefs.Timezone,
+			}); err != nil {
+				return err
+			}
+		}
+
+		http.SetCookie(w, cookies.New(r, middleware.ThemeCookie, theme, themeCookieMaxAge))
+
+		framework.Redirect(w, r, sameOriginReferer(r, framework.UrlFor(r, "index")), http.StatusSeeOther)
+		return nil
+	})
+}
+
+// sameOriginReferer returns the path of the Referer if it points at this host, else fallback.
+func sameOriginReferer(r *http.Request, fallback string) string {
+	ref, err := url.Parse(r.Referer())
+	if err != nil || ref.Host != r.Host || ref.Path == "" {
+		return fallback
+	}
+	return ref.RequestURI()
+}
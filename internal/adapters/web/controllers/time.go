@@ -8,31 +8,17 @@ import (
 	"github.com/antonkarounis/stoic/internal/adapters/web/framework"
 )
 
-func Time() http.HandlerFunc {
-	return framework.BuildSSEHandler(func(ctx context.Context, messageChan chan string) {
-		ticker := time.NewTicker(time.Second)
-		defer ticker.Stop()
-
-		// Send initial time
-		select {
-		case messageChan <- generateTime():
-		case <-ctx.Done():
-			return
-		}
-
-		for {
-			select {
-			case <-ticker.C:
-				select {
-				case messageChan <- generateTime():
-				case <-ctx.Done():
-					return
-				}
-			case <-ctx.Done():
-				return
-			}
-		}
-	})
+// Time streams the server clock; the stream closes once shutdown is closed.
+func Time(shutdown <-chan struct{}) http.HandlerFunc {
+	return framework.BuildSSEHandlerWithOptions(framework.SSEOptions{
+		Shutdown: shutdown,
+		// Send the current time on connect, then one update per tick
+		Snapshot: func(ctx context.Context) framework.SSEMessage {
+			return framework.SSEMessage{Data: generateTime()}
+		},
+	}, framework.SSETicker(time.Second, func(ctx context.Context) string {
+		return generateTime()
+	}))
 }
 
 func generateTime() string {
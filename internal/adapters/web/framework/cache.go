@@ -0,0 +1,29 @@
+package framework
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SetNoStore marks the response as never to be stored by browsers or proxies. It is the
+// default for every dynamic route (see middleware.NoCache) and is restored for error pages.
+func SetNoStore(w http.ResponseWriter) {
+	h := w.Header()
+	h.Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	h.Set("Pragma", "no-cache")
+	h.Set("Expires", "0")
+}
+
+// SetPrivateCache lets the browser, but no shared cache, reuse the response for maxAge,
+// replacing the no-store default so back and forward navigation is instant. Call it
+// before writing the response. Reserve it for pages that can stay visible to whoever uses
+// the browser next, even after logout: never for account, payment or other sensitive pages,
+// nor for SSE streams. The page is served from the cache without a request, so it can
+// also show data up to maxAge old.
+func SetPrivateCache(w http.ResponseWriter, maxAge time.Duration) {
+	h := w.Header()
+	h.Set("Cache-Control", "private, max-age="+strconv.Itoa(int(maxAge/time.Second)))
+	h.Del("Pragma")
+	h.Del("Expires")
+}
@@ -6,11 +6,55 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"sync"
 
 	"github.com/antonkarounis/stoic/internal/domain/models"
 	"github.com/gorilla/mux"
 )
 
+// --- request id ---
+
+type requestIDKey string
+
+const requestIDContextKey requestIDKey = "requestID"
+
+// SetRequestID returns a new request with the request id stored in context.
+func SetRequestID(r *http.Request, id string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), requestIDContextKey, id))
+}
+
+// GetRequestID returns the request id from context, or "" if none was assigned.
+func GetRequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
+
+// --- logger ---
+
+type loggerKey string
+
+const loggerContextKey loggerKey = "logger"
+
+// SetLogger returns a new request with logger stored in context; see GetLogger.
+func SetLogger(r *http.Request, logger *slog.Logger) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), loggerContextKey, logger))
+}
+
+// GetLogger returns the request-scoped logger, pre-populated by middleware with fields such
+// as request_id, method, path and user_id. Falls back to slog.Default().
+func GetLogger(r *http.Request) *slog.Logger {
+	return LoggerFromContext(r.Context())
+}
+
+// LoggerFromContext returns the request-scoped logger stored in ctx, or slog.Default().
+// Use it in code below the handlers that only has a context.
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, _ := ctx.Value(loggerContextKey).(*slog.Logger); logger != nil {
+		return logger
+	}
+	return slog.Default()
+}
+
 // --- user ---
 
 type userKey string
@@ -49,6 +93,80 @@ func GetLoggedInUser(r *http.Request) *models.User {
 	return nil
 }
 
+// --- preferences ---
+
+type preferencesKey string
+
+const preferencesContextKey preferencesKey = "preferences"
+
+// SetPreferences returns a new request with the user's preferences stored in context.
+func SetPreferences(r *http.Request, prefs models.Preferences) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), preferencesContextKey, prefs))
+}
+
+// GetPreferences returns the current user's preferences, or the defaults when there is no
+// user or none were loaded.
+func GetPreferences(r *http.Request) models.Preferences {
+	prefs, _ := r.Context().Value(preferencesContextKey).(models.Preferences)
+	return prefs.WithDefaults()
+}
+
+// --- feature flags ---
+
+type flagsKey string
+
+const flagsContextKey flagsKey = "flags"
+
+// SetFlags returns a new request with the flags evaluated for its user stored in context.
+func SetFlags(r *http.Request, flags models.Flags) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), flagsContextKey, flags))
+}
+
+// GetFlags returns the request's evaluated flags, or nil when none were loaded.
+func GetFlags(r *http.Request) models.Flags {
+	return FlagsFromContext(r.Context())
+}
+
+// FlagsFromContext is GetFlags for code that only has the request context.
+func FlagsFromContext(ctx context.Context) models.Flags {
+	flags, _ := ctx.Value(flagsContextKey).(models.Flags)
+	return flags
+}
+
+// FlagEnabled reports whether feature flag name is on for the request's user. Flags that
+// are unknown, or not loaded because middleware.ResolveFlags is not mounted, are off.
+func FlagEnabled(ctx context.Context, name string) bool {
+	return FlagsFromContext(ctx).Enabled(name)
+}
+
+// FlagValue returns the variant of feature flag name for the request's user, or "" if the
+// flag is off.
+func FlagValue(ctx context.Context, name string) string {
+	return FlagsFromContext(ctx).Value(name)
+}
+
+// --- theme ---
+
+type themeKey string
+
+const themeContextKey themeKey = "theme"
+
+// SetTheme returns a new request with the color theme stored in context.
+func SetTheme(r *http.Request, theme string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), themeContextKey, theme))
+}
+
+// GetTheme returns the color theme for the request: "light", "dark", or "auto" to follow
+// the browser. Unknown values read as "auto".
+func GetTheme(r *http.Request) string {
+	switch theme, _ := r.Context().Value(themeContextKey).(string); theme {
+	case "light", "dark":
+		return theme
+	default:
+		return models.DefaultTheme
+	}
+}
+
 // --- auth session ---
 
 type authSessionKey string
@@ -61,11 +179,88 @@ func SetAuthSession(r *http.Request, session *models.SessionData) *http.Request
 }
 
 // GetAuthSession returns the auth session from context, or nil if not present.
+//
+// Which accessor to use:
+//   - CurrentSession on pages that work with or without a login
+//   - MustSession on routes behind RequireAuth, where a missing session is a bug
+//   - GetUserFromContext when the handler needs the domain user and should fail without one
 func GetAuthSession(r *http.Request) *models.SessionData {
 	s, _ := r.Context().Value(AuthSessionContextKey).(*models.SessionData)
 	return s
 }
 
+// CurrentSession returns the auth session and whether the request has one.
+func CurrentSession(r *http.Request) (*models.SessionData, bool) {
+	s := GetAuthSession(r)
+	return s, s != nil
+}
+
+// SetSessionUnavailable returns a new request marked as carrying a session cookie whose
+// session could not be loaded because the session store is unreachable.
+func SetSessionUnavailable(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), sessionUnavailableContextKey, true))
+}
+
+// SessionUnavailable reports whether the request's session could not be loaded because the
+// session store is unreachable. Such requests have no auth session, but the visitor may be
+// logged in, so routes that need a login should fail with a 503 rather than send them to
+// log in again.
+func SessionUnavailable(r *http.Request) bool {
+	unavailable, _ := r.Context().Value(sessionUnavailableContextKey).(bool)
+	return unavailable
+}
+
+const sessionUnavailableContextKey authSessionKey = "sessionUnavailable"
+
+// MustSession returns the auth session, panicking if there is none. Use it only on routes
+// behind RequireAuth, where a missing session means the route was registered outside the
+// protected subrouter; the panic is turned into a 500 by the recovery middleware.
+func MustSession(r *http.Request) *models.SessionData {
+	s := GetAuthSession(r)
+	if s == nil {
+		panic(fmt.Sprintf("MustSession: no auth session for %s %s; is the route behind RequireAuth?", r.Method, r.URL.Path))
+	}
+	return s
+}
+
+// --- tenant ---
+
+// GetTenantID returns the tenant of the current auth session, or "" if there is none.
+func GetTenantID(r *http.Request) string {
+	return TenantIDFromContext(r.Context())
+}
+
+// TenantIDFromContext returns the tenant of the auth session stored in ctx, or "" if there is none.
+// Use it to scope queries by tenant in code that only has a context.
+func TenantIDFromContext(ctx context.Context) string {
+	if s, _ := ctx.Value(AuthSessionContextKey).(*models.SessionData); s != nil {
+		return s.TenantID
+	}
+	return ""
+}
+
+// --- csrf ---
+
+type csrfKey string
+
+const csrfContextKey csrfKey = "csrfToken"
+
+// SetCSRFToken returns a new request with token stored in context. token is called at most
+// once, when a template or handler first asks for it, so requests that render no form do
+// not need a token issued.
+func SetCSRFToken(r *http.Request, token func() string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), csrfContextKey, sync.OnceValue(token)))
+}
+
+// GetCSRFToken returns the CSRF token to submit with unsafe requests, as the csrf_token
+// form field or the X-CSRF-Token header, or "" if the CSRF middleware did not run.
+func GetCSRFToken(r *http.Request) string {
+	if token, ok := r.Context().Value(csrfContextKey).(func() string); ok {
+		return token()
+	}
+	return ""
+}
+
 // --- urlFor ---
 
 type muxKey string
@@ -0,0 +1,153 @@
+package framework
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/antonkarounis/stoic/internal/domain/ports"
+)
+
+// Cookies names and builds every cookie the app sets, from one ports.CookieConfig, so
+// the session, OAuth, CSRF and theme cookies share a prefix, Domain and Secure/SameSite
+// policy. Handlers pass the unprefixed name ("session_id") to New and Get.
+type Cookies struct {
+	cfg       ports.CookieConfig
+	sameSite  http.SameSite
+	https     bool // the app's public URL is https, so auto Secure always applies
+	localhost bool // the app's public URL is on the loopback host
+}
+
+// NewCookies validates cfg and fills in its defaults: no prefix, host-only cookies,
+// SameSite=Lax and Secure "auto", which sets Secure when appURL is https or the request
+// arrived over HTTPS, directly or via a TLS-terminating proxy. Secure cookies with an
+// http appURL on any host but localhost are rejected: browsers would never send them back,
+// so no login could succeed.
+func NewCookies(cfg ports.CookieConfig, appURL string) (*Cookies, error) {
+	cfg.Secure = strings.ToLower(cfg.Secure)
+	switch cfg.Secure {
+	case "":
+		cfg.Secure = "auto"
+	case "true", "false", "auto":
+	default:
+		return nil, fmt.Errorf("cookie secure must be true, false or auto, got %q", cfg.Secure)
+	}
+
+	c := &Cookies{cfg: cfg, https: strings.HasPrefix(appURL, "https://")}
+	if u, err := url.Parse(appURL); err == nil {
+		host := u.Hostname()
+		c.localhost = host == "localhost" || strings.HasSuffix(host, ".localhost") || net.ParseIP(host).IsLoopback()
+	}
+	switch strings.ToLower(cfg.SameSite) {
+	case "", "lax":
+		c.sameSite = http.SameSiteLaxMode
+	case "strict":
+		c.sameSite = http.SameSiteStrictMode
+	case "none":
+		if cfg.Secure == "false" {
+			return nil, errors.New("cookie SameSite=None requires Secure cookies; set cookie secure to true or auto")
+		}
+		c.sameSite = http.SameSiteNoneMode
+	default:
+		return nil, fmt.Errorf("cookie SameSite must be lax, strict or none, got %q", cfg.SameSite)
+	}
+
+	alwaysSecure := cfg.Secure == "true" || c.sameSite == http.SameSiteNoneMode
+	if alwaysSecure && strings.HasPrefix(appURL, "http://") && !c.localhost {
+		return nil, fmt.Errorf("cookies are always Secure but app URL %s is http, so browsers would never send them; use an https app URL or cookie secure auto", appURL)
+	}
+	return c, nil
+}
+
+// SchemeWarnings reports cookie settings that work against the app URL's scheme without
+// breaking outright, for logging at startup. isDev flags setups that are fine in
+// production but trip up local development.
+func (c *Cookies) SchemeWarnings(isDev bool) []string {
+	var warnings []string
+	if c.cfg.Secure == "false" && c.https {
+		warnings = append(warnings, "cookie secure is false but the app URL is https; cookies may leak over plain http")
+	}
+	alwaysSecure := c.cfg.Secure == "true" || c.sameSite == http.SameSiteNoneMode
+	if alwaysSecure && !c.https && c.localhost {
+		warnings = append(warnings, "cookies are always Secure but the app URL is http; Safari drops Secure cookies on http://localhost")
+	}
+	if isDev && c.https && c.cfg.Secure != "false" {
+		warnings = append(warnings, "the app URL is https, so cookies are Secure and logins fail when the app is opened over plain http; use an http app URL locally")
+	}
+	return warnings
+}
+
+// Name returns the configured name of the cookie called name.
+func (c *Cookies) Name(name string) string {
+	return c.cfg.Prefix + name
+}
+
+// SameSite returns the configured SameSite mode.
+func (c *Cookies) SameSite() http.SameSite {
+	return c.sameSite
+}
+
+// SameSiteCompat reports whether auth cookies should omit SameSite for browsers known to
+// mishandle it.
+func (c *Cookies) SameSiteCompat() bool {
+	return c.cfg.SameSiteCompat
+}
+
+// New returns an HttpOnly cookie for r with the configured name, Domain, Secure and
+// SameSite attributes, valid for the whole site. A negative maxAge deletes the cookie.
+// Adjust the result before passing it to http.SetCookie if a cookie needs otherwise.
+func (c *Cookies) New(r *http.Request, name, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     c.Name(name),
+		Value:    value,
+		Path:     "/",
+		Domain:   c.cfg.Domain,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   c.secure(r),
+		SameSite: c.sameSite,
+	}
+}
+
+// Get returns the cookie called name from r, under its configured name.
+func (c *Cookies) Get(r *http.Request, name string) (*http.Cookie, error) {
+	return r.Cookie(c.Name(name))
+}
+
+// secure resolves the Secure setting for r. SameSite=None always gets Secure, since
+// browsers drop such cookies otherwise.
+func (c *Cookies) secure(r *http.Request) bool {
+	switch {
+	case c.cfg.Secure == "true", c.sameSite == http.SameSiteNoneMode:
+		return true
+	case c.cfg.Secure == "false":
+		return false
+	default:
+		return c.https || RequestScheme(r) == "https"
+	}
+}
+
+// RequestScheme returns the scheme the client used, honouring X-Forwarded-Proto and the
+// proto parameter of Forwarded as set by TLS-terminating proxies.
+func RequestScheme(r *http.Request) string {
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		first, _, _ := strings.Cut(proto, ",")
+		return strings.ToLower(strings.TrimSpace(first))
+	}
+	if forwarded := r.Header.Get("Forwarded"); forwarded != "" {
+		first, _, _ := strings.Cut(forwarded, ",")
+		for _, pair := range strings.Split(first, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(key, "proto") {
+				return strings.ToLower(strings.Trim(value, `"`))
+			}
+		}
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
@@ -0,0 +1,68 @@
+package framework
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/antonkarounis/stoic/internal/domain/ports"
+)
+
+func TestCookiesSetCookieHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    ports.CookieConfig
+		appURL string
+		maxAge int
+		want   string
+	}{
+		{"defaults", ports.CookieConfig{}, "http://localhost:8080", 60,
+			"session_id=abc; Path=/; Max-Age=60; HttpOnly; SameSite=Lax"},
+		{"prefix and domain", ports.CookieConfig{Prefix: "billing_", Domain: "example.com"}, "https://billing.example.com", 60,
+			"billing_session_id=abc; Path=/; Domain=example.com; Max-Age=60; HttpOnly; Secure; SameSite=Lax"},
+		{"strict", ports.CookieConfig{SameSite: "Strict"}, "http://localhost:8080", 60,
+			"session_id=abc; Path=/; Max-Age=60; HttpOnly; SameSite=Strict"},
+		{"none is always secure", ports.CookieConfig{SameSite: "none"}, "http://localhost:8080", 60,
+			"session_id=abc; Path=/; Max-Age=60; HttpOnly; Secure; SameSite=None"},
+		{"secure forced on", ports.CookieConfig{Secure: "true"}, "http://localhost:8080", 60,
+			"session_id=abc; Path=/; Max-Age=60; HttpOnly; Secure; SameSite=Lax"},
+		{"secure forced off", ports.CookieConfig{Secure: "false"}, "https://example.com", 60,
+			"session_id=abc; Path=/; Max-Age=60; HttpOnly; SameSite=Lax"},
+		{"deletion", ports.CookieConfig{Prefix: "billing_"}, "http://localhost:8080", -1,
+			"billing_session_id=abc; Path=/; Max-Age=0; HttpOnly; SameSite=Lax"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cookies, err := NewCookies(tt.cfg, tt.appURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rec := httptest.NewRecorder()
+			http.SetCookie(rec, cookies.New(httptest.NewRequest(http.MethodGet, "/", nil), "session_id", "abc", tt.maxAge))
+
+			if got := rec.Header().Get("Set-Cookie"); got != tt.want {
+				t.Errorf("Set-Cookie = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewCookiesRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    ports.CookieConfig
+		appURL string
+	}{
+		{"unknown secure", ports.CookieConfig{Secure: "sometimes"}, "https://example.com"},
+		{"unknown SameSite", ports.CookieConfig{SameSite: "loose"}, "https://example.com"},
+		{"SameSite none without secure", ports.CookieConfig{SameSite: "none", Secure: "false"}, "https://example.com"},
+		{"secure over plain http", ports.CookieConfig{Secure: "true"}, "http://example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewCookies(tt.cfg, tt.appURL); err == nil {
+				t.Error("config accepted")
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package framework
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// ServeDownload sends content as a file download named name. It wraps http.ServeContent,
+// so the content type is derived from name's extension (or sniffed), Range and If-Range
+// requests are answered with partial content for resumable downloads, and a non-zero
+// modtime enables Last-Modified and conditional requests.
+//
+// The response is marked Cache-Control: no-transform so that compressing proxies or
+// middleware leave the body as is; a re-encoded body would no longer match the byte
+// ranges and Content-Length computed here.
+func ServeDownload(w http.ResponseWriter, r *http.Request, content io.ReadSeeker, name string, modtime time.Time) {
+	// browsers only use the final element; drop directories so none leak into the header
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	if name == "." || name == "/" {
+		name = "download"
+	}
+
+	h := w.Header()
+	// FormatMediaType quotes the name and switches to RFC 2231 encoding for non-ASCII names
+	h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	if cc := h.Get("Cache-Control"); cc != "" {
+		h.Set("Cache-Control", cc+", no-transform")
+	} else {
+		h.Set("Cache-Control", "no-transform")
+	}
+	h.Del("Content-Encoding")
+
+	http.ServeContent(w, r, name, modtime, content)
+}
@@ -0,0 +1,118 @@
+package framework
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/antonkarounis/stoic/internal/domain/ports"
+)
+
+// HTTPError is an error carrying the status and user-facing message of the response it
+// should produce. Err, if set, is the underlying cause; it is logged but never shown.
+type HTTPError struct {
+	Status  int
+	Message string
+	Err     error
+}
+
+func (e *HTTPError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// NewHTTPError returns an HTTPError for status using the standard status text as message.
+func NewHTTPError(status int, err error) *HTTPError {
+	return &HTTPError{Status: status, Message: http.StatusText(status), Err: err}
+}
+
+func BadRequest(message string) *HTTPError {
+	return &HTTPError{Status: http.StatusBadRequest, Message: message}
+}
+
+func Unauthorized() *HTTPError {
+	return NewHTTPError(http.StatusUnauthorized, nil)
+}
+
+func Forbidden() *HTTPError {
+	return NewHTTPError(http.StatusForbidden, nil)
+}
+
+func NotFound() *HTTPError {
+	return NewHTTPError(http.StatusNotFound, nil)
+}
+
+// Unavailable is the 503 for a backing store that cannot be reached, e.g. during a database
+// outage.
+func Unavailable(err error) *HTTPError {
+	return &HTTPError{
+		Status:  http.StatusServiceUnavailable,
+		Message: "This page is temporarily unavailable. Please try again in a few minutes.",
+		Err:     err,
+	}
+}
+
+func InternalError(err error) *HTTPError {
+	return NewHTTPError(http.StatusInternalServerError, err)
+}
+
+// AsHTTPError converts any error into an HTTPError. Domain errors from ports map to their
+// matching status; anything else becomes a 500 with the original error as its cause.
+func AsHTTPError(err error) *HTTPError {
+	var httpErr *HTTPError
+	switch {
+	case errors.As(err, &httpErr):
+		return httpErr
+	case errors.Is(err, ports.ErrNotFound):
+		return NewHTTPError(http.StatusNotFound, err)
+	case errors.Is(err, ports.ErrForbidden):
+		return NewHTTPError(http.StatusForbidden, err)
+	case errors.Is(err, ports.ErrInvalidInput):
+		return NewHTTPError(http.StatusBadRequest, err)
+	case errors.Is(err, ports.ErrUnavailable):
+		return Unavailable(err)
+	default:
+		return InternalError(err)
+	}
+}
+
+// HandlerFunc is an HTTP handler that reports failure by returning an error instead of
+// writing the error response itself.
+type HandlerFunc func(http.ResponseWriter, *http.Request) error
+
+// Handler adapts fn into an http.HandlerFunc. A returned error is logged and written as a
+// plain-text response; use TemplateRegistry.Handle to render an error page instead.
+func Handler(fn HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := fn(w, r); err != nil {
+			WriteError(w, r, err)
+		}
+	}
+}
+
+// WriteError logs err and writes it as a plain-text response with the matching status.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	httpErr := logHTTPError(r, err)
+	http.Error(w, httpErr.Message, httpErr.Status)
+}
+
+// logHTTPError logs err with the request logger, at error level for 5xx and debug otherwise,
+// and returns it as an HTTPError.
+func logHTTPError(r *http.Request, err error) *HTTPError {
+	httpErr := AsHTTPError(err)
+	level := slog.LevelDebug
+	if httpErr.Status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	GetLogger(r).Log(r.Context(), level, "request failed",
+		"status", httpErr.Status,
+		"error", err,
+	)
+	return httpErr
+}
@@ -0,0 +1,132 @@
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Trigger adds event to the HX-Trigger response header, making htmx dispatch it on the
+// requesting element with detail (any JSON-encodable value, or nil) as event.detail:
+//
+//	framework.Trigger(w, "toast", map[string]string{"message": "Settings saved"})
+//
+// Repeated calls merge into a single JSON object, so several events can be sent with one
+// response; a later call for the same event replaces its detail. Call it before the
+// response is written, e.g. before WriteTo; typed handlers use TriggerContext instead.
+func Trigger(w http.ResponseWriter, event string, detail any) error {
+	events, err := parseTriggerHeader(w.Header().Get("HX-Trigger"))
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(detail)
+	if err != nil {
+		return fmt.Errorf("encoding %s trigger detail: %w", event, err)
+	}
+	events[event] = raw
+	return setTriggerHeader(w, events)
+}
+
+func setTriggerHeader(w http.ResponseWriter, events map[string]json.RawMessage) error {
+	header, err := json.Marshal(events)
+	if err != nil {
+		return fmt.Errorf("encoding HX-Trigger: %w", err)
+	}
+	w.Header().Set("HX-Trigger", string(header))
+	return nil
+}
+
+// parseTriggerHeader reads an existing HX-Trigger value, which is either a JSON object or
+// a comma-separated list of event names set by other code.
+func parseTriggerHeader(value string) (map[string]json.RawMessage, error) {
+	events := make(map[string]json.RawMessage)
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return events, nil
+	}
+	if strings.HasPrefix(value, "{") {
+		if err := json.Unmarshal([]byte(value), &events); err != nil {
+			return nil, fmt.Errorf("parsing existing HX-Trigger: %w", err)
+		}
+		return events, nil
+	}
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			events[name] = json.RawMessage("null")
+		}
+	}
+	return events, nil
+}
+
+// Redirect sends the client to url in a way that works for both plain and htmx requests.
+// htmx follows a 3xx response inside its XHR and swaps the target page into the element,
+// so a form posted with hx-post would appear to do nothing. htmx requests instead get a
+// 200 with HX-Redirect, a full page load, or for boosted requests HX-Location, which
+// swaps the body and pushes the URL like boosted navigation. Other requests get a normal
+// redirect with code.
+func Redirect(w http.ResponseWriter, r *http.Request, url string, code int) {
+	switch {
+	case IsHTMX(r):
+		w.Header().Set("HX-Redirect", url)
+	case r.Header.Get("HX-Request") == "true":
+		w.Header().Set("HX-Location", url)
+	default:
+		http.Redirect(w, r, url, code)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+type triggersKey string
+
+const triggersContextKey triggersKey = "hx-triggers"
+
+// pendingTriggers collects the events queued with TriggerContext during a JSONHandler call.
+type pendingTriggers struct {
+	mu     sync.Mutex
+	events map[string]json.RawMessage
+}
+
+func withPendingTriggers(ctx context.Context) (context.Context, *pendingTriggers) {
+	pending := &pendingTriggers{events: make(map[string]json.RawMessage)}
+	return context.WithValue(ctx, triggersContextKey, pending), pending
+}
+
+// TriggerContext is Trigger for typed handlers, which have no ResponseWriter: the event is
+// added to the HX-Trigger header when the JSONHandler that passed ctx writes a successful
+// response. Events are dropped if the handler fails.
+func TriggerContext(ctx context.Context, event string, detail any) error {
+	pending, ok := ctx.Value(triggersContextKey).(*pendingTriggers)
+	if !ok {
+		return errors.New("TriggerContext called outside a JSONHandler")
+	}
+	raw, err := json.Marshal(detail)
+	if err != nil {
+		return fmt.Errorf("encoding %s trigger detail: %w", event, err)
+	}
+	pending.mu.Lock()
+	defer pending.mu.Unlock()
+	pending.events[event] = raw
+	return nil
+}
+
+// apply merges the queued events into w's HX-Trigger header.
+func (p *pendingTriggers) apply(w http.ResponseWriter) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.events) == 0 {
+		return nil
+	}
+	events, err := parseTriggerHeader(w.Header().Get("HX-Trigger"))
+	if err != nil {
+		return err
+	}
+	for event, raw := range p.events {
+		events[event] = raw
+	}
+	return setTriggerHeader(w, events)
+}
@@ -0,0 +1,41 @@
+package framework
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirect(t *testing.T) {
+	tests := []struct {
+		name         string
+		headers      map[string]string
+		wantStatus   int
+		wantHeader   string // the header carrying the URL
+		wantLocation bool   // whether Location is set
+	}{
+		{"plain request", nil, http.StatusSeeOther, "Location", true},
+		{"htmx request", map[string]string{"HX-Request": "true"}, http.StatusOK, "HX-Redirect", false},
+		{"boosted request", map[string]string{"HX-Request": "true", "HX-Boosted": "true"}, http.StatusOK, "HX-Location", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/settings", nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			Redirect(rec, r, "/app/dashboard", http.StatusSeeOther)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get(tt.wantHeader); got != "/app/dashboard" {
+				t.Errorf("%s = %q, want /app/dashboard", tt.wantHeader, got)
+			}
+			if got := rec.Header().Get("Location") != ""; got != tt.wantLocation {
+				t.Errorf("Location set = %v, want %v", got, tt.wantLocation)
+			}
+		})
+	}
+}
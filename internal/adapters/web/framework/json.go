@@ -0,0 +1,210 @@
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+)
+
+const defaultJSONMaxBodyBytes = 1 << 20
+
+// Validator is implemented by request types that check themselves after decoding.
+// JSONHandler responds 422 with the returned error; return a *ValidationError to
+// report per-field messages.
+type Validator interface {
+	Validate() error
+}
+
+// ValidationError reports invalid request fields, keyed by JSON field name.
+type ValidationError struct {
+	Fields map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	return "validation failed"
+}
+
+// JSONOptions configures JSONHandlerWithOptions.
+type JSONOptions struct {
+	MaxBodyBytes int64 // defaults to 1 MiB
+	// Validate, if set, runs after decoding and after the request's own Validate method.
+	Validate func(req any) error
+	// Encoding, if set, formats this handler's responses, errors included, in place of
+	// the encoding set on the request with SetJSONEncoding.
+	Encoding *JSONEncoding
+}
+
+// JSONEncoding controls how WriteJSON formats responses. The zero value writes compact,
+// HTML-safe JSON.
+type JSONEncoding struct {
+	Indent string // indentation per level, e.g. "  "; empty writes compact JSON
+	// NoHTMLEscape leaves <, > and & unescaped, for clients that never embed the JSON in
+	// HTML. Escaping is the safe default for browsers.
+	NoHTMLEscape bool
+}
+
+type jsonEncodingKey string
+
+const jsonEncodingContextKey jsonEncodingKey = "jsonEncoding"
+
+// SetJSONEncoding sets the encoding of the JSON responses to r, e.g. indented output in
+// development; see middleware.JSONEncoding to set it for a router.
+func SetJSONEncoding(r *http.Request, enc JSONEncoding) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), jsonEncodingContextKey, enc))
+}
+
+// GetJSONEncoding returns the encoding set with SetJSONEncoding, or the zero JSONEncoding.
+func GetJSONEncoding(r *http.Request) JSONEncoding {
+	enc, _ := r.Context().Value(jsonEncodingContextKey).(JSONEncoding)
+	return enc
+}
+
+// jsonErrorBody is the standard error envelope: {"error": {"status": ..., "message": ...}}.
+type jsonErrorBody struct {
+	Error jsonError `json:"error"`
+}
+
+type jsonError struct {
+	Status  int               `json:"status"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// JSONHandler adapts a typed function into a JSON API handler using default options.
+// See JSONHandlerWithOptions.
+func JSONHandler[Req, Resp any](fn func(ctx context.Context, req Req) (Resp, error)) http.HandlerFunc {
+	return JSONHandlerWithOptions(JSONOptions{}, fn)
+}
+
+// JSONHandlerWithOptions decodes the request body into Req, validates it, calls fn and
+// writes its result as JSON with status 200. Requests without a body (e.g. GET) are passed
+// a zero Req. Failures are written as the standard error envelope: 415 for a non-JSON
+// content type, 413 for oversized bodies, 400 for malformed JSON, 422 for validation
+// errors, and the status derived by AsHTTPError for errors returned by fn. fn can queue
+// htmx events for the response with TriggerContext.
+func JSONHandlerWithOptions[Req, Resp any](opts JSONOptions, fn func(ctx context.Context, req Req) (Resp, error)) http.HandlerFunc {
+	if opts.MaxBodyBytes <= 0 {
+		opts.MaxBodyBytes = defaultJSONMaxBodyBytes
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req Req
+		if err := decodeJSONBody(w, r, opts.MaxBodyBytes, &req); err != nil {
+			writeJSONErrorEncoded(w, r, err, opts.Encoding)
+			return
+		}
+		if err := validateJSONRequest(&req, opts.Validate); err != nil {
+			writeJSONErrorEncoded(w, r, err, opts.Encoding)
+			return
+		}
+
+		ctx, triggers := withPendingTriggers(r.Context())
+		resp, err := fn(ctx, req)
+		if err != nil {
+			writeJSONErrorEncoded(w, r, err, opts.Encoding)
+			return
+		}
+		if err := triggers.apply(w); err != nil {
+			GetLogger(r).Error("HX-Trigger header encoding failed", "error", err)
+		}
+		writeJSONEncoded(w, r, http.StatusOK, resp, opts.Encoding)
+	}
+}
+
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, maxBytes int64, dst any) error {
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return &HTTPError{Status: http.StatusUnsupportedMediaType, Message: "Content-Type must be application/json"}
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		var maxErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxErr):
+			return NewHTTPError(http.StatusRequestEntityTooLarge, err)
+		case errors.Is(err, io.EOF):
+			return nil
+		default:
+			return &HTTPError{Status: http.StatusBadRequest, Message: "malformed JSON: " + err.Error()}
+		}
+	}
+	if dec.More() {
+		return BadRequest("request body must contain a single JSON value")
+	}
+	return nil
+}
+
+// validateJSONRequest runs the request's own Validate method, then the handler-level hook.
+// req is a *Req, so Validate is found whether it has a value or pointer receiver.
+func validateJSONRequest(req any, hook func(any) error) error {
+	if v, ok := req.(Validator); ok {
+		if err := v.Validate(); err != nil {
+			return asValidationError(err)
+		}
+	}
+	if hook != nil {
+		if err := hook(req); err != nil {
+			return asValidationError(err)
+		}
+	}
+	return nil
+}
+
+func asValidationError(err error) error {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return err
+	}
+	return &HTTPError{Status: http.StatusUnprocessableEntity, Message: err.Error(), Err: err}
+}
+
+// WriteJSON writes v as a JSON response to r with the given status, formatted as set with
+// SetJSONEncoding. The encoder writes straight to w, without another copy of the body.
+func WriteJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	writeJSONEncoded(w, r, status, v, nil)
+}
+
+// writeJSONEncoded is WriteJSON with enc, if set, in place of the request's encoding.
+func writeJSONEncoded(w http.ResponseWriter, r *http.Request, status int, v any, enc *JSONEncoding) {
+	if enc == nil {
+		requestEnc := GetJSONEncoding(r)
+		enc = &requestEnc
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", enc.Indent)
+	encoder.SetEscapeHTML(!enc.NoHTMLEscape)
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := encoder.Encode(v); err != nil {
+		slog.Error("json response encoding failed", "error", err)
+	}
+}
+
+// WriteJSONError logs err and writes it as the standard JSON error envelope.
+func WriteJSONError(w http.ResponseWriter, r *http.Request, err error) {
+	writeJSONErrorEncoded(w, r, err, nil)
+}
+
+func writeJSONErrorEncoded(w http.ResponseWriter, r *http.Request, err error, enc *JSONEncoding) {
+	httpErr := logHTTPError(r, err)
+	SetNoStore(w)
+	body := jsonErrorBody{Error: jsonError{Status: httpErr.Status, Message: httpErr.Message}}
+
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		body.Error.Message = validationErr.Error()
+		body.Error.Fields = validationErr.Fields
+	}
+	writeJSONEncoded(w, r, httpErr.Status, body, enc)
+}
@@ -0,0 +1,61 @@
+package framework
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteJSONEncoding(t *testing.T) {
+	body := map[string]string{"html": "<b>"}
+	tests := []struct {
+		name string
+		enc  *JSONEncoding // set on the request; nil sets none
+		want string
+	}{
+		{"default is compact and HTML-safe", nil, "{\"html\":\"\\u003cb\\u003e\"}\n"},
+		{"indented", &JSONEncoding{Indent: "  "}, "{\n  \"html\": \"\\u003cb\\u003e\"\n}\n"},
+		{"unescaped", &JSONEncoding{NoHTMLEscape: true}, "{\"html\":\"<b>\"}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.enc != nil {
+				r = SetJSONEncoding(r, *tt.enc)
+			}
+			rec := httptest.NewRecorder()
+			WriteJSON(rec, r, http.StatusCreated, body)
+
+			if rec.Code != http.StatusCreated {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusCreated)
+			}
+			if got := rec.Body.String(); got != tt.want {
+				t.Errorf("body = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONEncodingDoesNotLeakBetweenRequests(t *testing.T) {
+	rec := httptest.NewRecorder()
+	WriteJSON(rec, SetJSONEncoding(httptest.NewRequest(http.MethodGet, "/", nil), JSONEncoding{Indent: "  "}), http.StatusOK, []int{1})
+
+	rec = httptest.NewRecorder()
+	WriteJSON(rec, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK, []int{1})
+	if got := rec.Body.String(); got != "[1]\n" {
+		t.Errorf("body = %q, want compact output", got)
+	}
+}
+
+func TestJSONHandlerEncodingOverridesRequest(t *testing.T) {
+	handler := JSONHandlerWithOptions(JSONOptions{Encoding: &JSONEncoding{}}, func(ctx context.Context, req struct{}) ([]int, error) {
+		return []int{1}, nil
+	})
+
+	rec := httptest.NewRecorder()
+	handler(rec, SetJSONEncoding(httptest.NewRequest(http.MethodGet, "/", nil), JSONEncoding{Indent: "  "}))
+	if got := rec.Body.String(); got != "[1]\n" {
+		t.Errorf("body = %q, want the handler's compact encoding", got)
+	}
+}
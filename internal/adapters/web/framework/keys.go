@@ -0,0 +1,37 @@
+package framework
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"fmt"
+)
+
+// Keys are the purpose-specific keys derived from the app's single secret key, so no
+// bytes are used by two algorithms: AES-GCM token encryption, CSRF token HMACs and the
+// sealing of short-lived login state are each keyed independently.
+type Keys struct {
+	Encryption []byte // AES-256-GCM key for OAuth tokens stored with sessions
+	CSRF       []byte // HMAC-SHA256 key for CSRF tokens; see middleware.CSRF
+	State      []byte // AES-256-GCM key for login state carried in cookies
+}
+
+// DeriveKeys derives Keys from secret with HKDF-SHA256. The same secret always yields the
+// same keys, so they need no storage and survive restarts.
+func DeriveKeys(secret []byte) (Keys, error) {
+	var keys Keys
+	for _, k := range []struct {
+		key  *[]byte
+		info string
+	}{
+		{&keys.Encryption, "stoic token encryption"},
+		{&keys.CSRF, "stoic csrf"},
+		{&keys.State, "stoic login state"},
+	} {
+		derived, err := hkdf.Key(sha256.New, secret, nil, k.info, 32)
+		if err != nil {
+			return Keys{}, fmt.Errorf("deriving %s key: %w", k.info, err)
+		}
+		*k.key = derived
+	}
+	return keys, nil
+}
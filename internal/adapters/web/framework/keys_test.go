@@ -0,0 +1,45 @@
+package framework
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDeriveKeys(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	keys, err := DeriveKeys(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subkeys := map[string][]byte{"encryption": keys.Encryption, "csrf": keys.CSRF, "state": keys.State}
+	for name, key := range subkeys {
+		if len(key) != 32 {
+			t.Errorf("%s key is %d bytes, want 32", name, len(key))
+		}
+		if bytes.Equal(key, secret) {
+			t.Errorf("%s key is the secret itself", name)
+		}
+		for other, otherKey := range subkeys {
+			if name < other && bytes.Equal(key, otherKey) {
+				t.Errorf("%s and %s keys are equal", name, other)
+			}
+		}
+	}
+
+	again, err := DeriveKeys(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again.Encryption, keys.Encryption) || !bytes.Equal(again.CSRF, keys.CSRF) || !bytes.Equal(again.State, keys.State) {
+		t.Error("keys differ across derivations from the same secret")
+	}
+
+	other, err := DeriveKeys([]byte("another secret, another key set"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(other.Encryption, keys.Encryption) {
+		t.Error("different secrets derived the same encryption key")
+	}
+}
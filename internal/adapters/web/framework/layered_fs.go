@@ -0,0 +1,62 @@
+package framework
+
+import (
+	"errors"
+	"io/fs"
+	"slices"
+	"strings"
+)
+
+// layeredFS overlays filesystems, searched in order: a file is read from the first layer
+// that has it, so an override layer replaces single templates while inheriting the rest
+// from the layers below. Directory listings are the union of every layer's entries; when
+// layers disagree on an entry (even file versus directory), the earliest layer wins.
+type layeredFS []fs.FS
+
+var _ fs.ReadDirFS = layeredFS(nil)
+
+func (l layeredFS) Open(name string) (fs.File, error) {
+	var firstErr error
+	for _, layer := range l {
+		f, err := layer.Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func (l layeredFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	var entries []fs.DirEntry
+	seen := make(map[string]bool)
+	found := false
+	for _, layer := range l {
+		layerEntries, err := fs.ReadDir(layer, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found = true
+		for _, entry := range layerEntries {
+			if !seen[entry.Name()] {
+				seen[entry.Name()] = true
+				entries = append(entries, entry)
+			}
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return entries, nil
+}
@@ -0,0 +1,299 @@
+package framework
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// APIDoc describes an API operation in the document served by OpenAPIHandler.
+type APIDoc struct {
+	Summary     string
+	Description string
+	Tags        []string
+}
+
+// APIHandler is a typed JSON handler that carries its documentation. Register it like any
+// other handler; OpenAPIHandler finds it by walking the router.
+type APIHandler struct {
+	http.HandlerFunc
+	Doc      APIDoc
+	Request  reflect.Type
+	Response reflect.Type
+}
+
+// DocumentedJSONHandler is JSONHandler with documentation for OpenAPIHandler.
+func DocumentedJSONHandler[Req, Resp any](doc APIDoc, fn func(ctx context.Context, req Req) (Resp, error)) *APIHandler {
+	return DocumentedJSONHandlerWithOptions(doc, JSONOptions{}, fn)
+}
+
+// DocumentedJSONHandlerWithOptions is JSONHandlerWithOptions with documentation for
+// OpenAPIHandler. The request and response schemas are derived from Req and Resp.
+func DocumentedJSONHandlerWithOptions[Req, Resp any](doc APIDoc, opts JSONOptions, fn func(ctx context.Context, req Req) (Resp, error)) *APIHandler {
+	return &APIHandler{
+		HandlerFunc: JSONHandlerWithOptions(opts, fn),
+		Doc:         doc,
+		Request:     reflect.TypeFor[Req](),
+		Response:    reflect.TypeFor[Resp](),
+	}
+}
+
+// OpenAPIInfo is the info object of the generated document.
+type OpenAPIInfo struct {
+	Title   string
+	Version string
+}
+
+// OpenAPIHandler serves a minimal OpenAPI 3.1 document for the APIHandler routes of
+// router, built on the first request so routes registered after this call are included.
+// Paths and methods come from the route templates; schemas are derived from the Go types
+// by their json tags. Pages and other plain handlers are left out.
+func OpenAPIHandler(router *mux.Router, info OpenAPIInfo) http.HandlerFunc {
+	var (
+		once sync.Once
+		doc  map[string]any
+		err  error
+	)
+	return func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() { doc, err = buildOpenAPI(router, info) })
+		if err != nil {
+			WriteJSONError(w, r, InternalError(err))
+			return
+		}
+		WriteJSON(w, r, http.StatusOK, doc)
+	}
+}
+
+// pathParamPattern matches a mux path variable, capturing its name without the pattern.
+var pathParamPattern = regexp.MustCompile(`\{([^}:]+)(?::[^}]*)?\}`)
+
+func buildOpenAPI(router *mux.Router, info OpenAPIInfo) (map[string]any, error) {
+	schemas := newSchemaSet()
+	paths := map[string]map[string]any{}
+
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		api, ok := route.GetHandler().(*APIHandler)
+		if !ok {
+			return nil
+		}
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil // routes without a path, e.g. host-only matchers
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			methods = []string{http.MethodGet}
+		}
+
+		path := pathParamPattern.ReplaceAllString(template, "{$1}")
+		if paths[path] == nil {
+			paths[path] = map[string]any{}
+		}
+		for _, method := range methods {
+			paths[path][strings.ToLower(method)] = openAPIOperation(route, api, method, template, schemas)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{
+		"openapi": "3.1.0",
+		"info":    map[string]any{"title": info.Title, "version": info.Version},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": schemas.defs,
+		},
+	}, nil
+}
+
+func openAPIOperation(route *mux.Route, api *APIHandler, method, template string, schemas *schemaSet) map[string]any {
+	op := map[string]any{
+		"responses": map[string]any{
+			"200": jsonContent("OK", schemas.schemaFor(api.Response)),
+			"default": jsonContent("Error", map[string]any{
+				"type":     "object",
+				"required": []string{"error"},
+				"properties": map[string]any{
+					"error": schemas.schemaFor(reflect.TypeFor[jsonError]()),
+				},
+			}),
+		},
+	}
+	if api.Doc.Summary != "" {
+		op["summary"] = api.Doc.Summary
+	}
+	if api.Doc.Description != "" {
+		op["description"] = api.Doc.Description
+	}
+	if len(api.Doc.Tags) > 0 {
+		op["tags"] = api.Doc.Tags
+	}
+	if name := route.GetName(); name != "" {
+		op["operationId"] = name + "_" + strings.ToLower(method)
+	}
+
+	var params []map[string]any
+	for _, match := range pathParamPattern.FindAllStringSubmatch(template, -1) {
+		params = append(params, map[string]any{
+			"name":     match[1],
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]any{"type": "string"},
+		})
+	}
+	if params != nil {
+		op["parameters"] = params
+	}
+
+	// JSONHandler passes a zero request to bodiless methods, so only document a body
+	// where clients send one
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete:
+	default:
+		if !isEmptyStruct(api.Request) {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": schemas.schemaFor(api.Request)},
+				},
+			}
+		}
+	}
+	return op
+}
+
+func jsonContent(description string, schema map[string]any) map[string]any {
+	return map[string]any{
+		"description": description,
+		"content": map[string]any{
+			"application/json": map[string]any{"schema": schema},
+		},
+	}
+}
+
+func isEmptyStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t.NumField() == 0
+}
+
+// schemaSet collects the component schemas of named struct types, so shared and
+// recursive types are emitted once and referenced by $ref.
+type schemaSet struct {
+	defs  map[string]any
+	names map[reflect.Type]string
+}
+
+func newSchemaSet() *schemaSet {
+	s := &schemaSet{defs: map[string]any{}, names: map[reflect.Type]string{}}
+	// the unexported error envelope gets a readable component name
+	errorType := reflect.TypeFor[jsonError]()
+	s.names[errorType] = "Error"
+	s.defs["Error"] = s.structSchema(errorType)
+	return s
+}
+
+var (
+	timeType       = reflect.TypeFor[time.Time]()
+	rawMessageType = reflect.TypeFor[json.RawMessage]()
+	schemaNameChar = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+)
+
+// schemaFor returns the JSON Schema of t as encoding/json would encode it.
+func (s *schemaSet) schemaFor(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == rawMessageType:
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": "array", "items": s.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.structSchema(t)
+		}
+		name, ok := s.names[t]
+		if !ok {
+			name = schemaNameChar.ReplaceAllString(t.Name(), "_")
+			s.names[t] = name
+			s.defs[name] = map[string]any{} // placeholder, in case t refers to itself
+			s.defs[name] = s.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	default:
+		return map[string]any{} // interfaces and anything else: any value
+	}
+}
+
+func (s *schemaSet) structSchema(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	var required []string
+	s.addFields(t, properties, &required)
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if required != nil {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// addFields adds the exported fields of t, flattening untagged embedded structs as
+// encoding/json does. Fields without omitempty or omitzero are required.
+func (s *schemaSet) addFields(t reflect.Type, properties map[string]any, required *[]string) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			s.addFields(fieldType, properties, required)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = s.schemaFor(field.Type)
+		if !strings.Contains(opts, "omitempty") && !strings.Contains(opts, "omitzero") {
+			*required = append(*required, name)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package framework
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultPerPage    = 20
+	defaultMaxPerPage = 100
+)
+
+// PaginationOptions bounds the page size clients may request on list endpoints.
+type PaginationOptions struct {
+	DefaultPerPage int // used when ?per_page is absent or invalid; defaults to 20
+	MaxPerPage     int // larger ?per_page values are clamped to this; defaults to 100
+}
+
+// Pagination is the page requested by a client, with the effective limits applied. It
+// doubles as the pagination view model for list templates.
+type Pagination struct {
+	Page           int // 1-based
+	PerPage        int
+	DefaultPerPage int
+	MaxPerPage     int
+	Total          int // total item count; set with WithTotal
+	TotalPages     int
+}
+
+// Paginate reads ?page and ?per_page from r. Missing or invalid values fall back to page 1
+// and DefaultPerPage, and per_page is clamped to MaxPerPage so a client cannot request an
+// unbounded number of rows.
+func Paginate(r *http.Request, opts PaginationOptions) Pagination {
+	if opts.MaxPerPage <= 0 {
+		opts.MaxPerPage = defaultMaxPerPage
+	}
+	if opts.DefaultPerPage <= 0 {
+		opts.DefaultPerPage = defaultPerPage
+	}
+	opts.DefaultPerPage = min(opts.DefaultPerPage, opts.MaxPerPage)
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	perPage, err := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if err != nil || perPage < 1 {
+		perPage = opts.DefaultPerPage
+	}
+
+	return Pagination{
+		Page:           page,
+		PerPage:        min(perPage, opts.MaxPerPage),
+		DefaultPerPage: opts.DefaultPerPage,
+		MaxPerPage:     opts.MaxPerPage,
+	}
+}
+
+// Offset is the number of rows to skip for the current page (SQL OFFSET).
+func (p Pagination) Offset() int {
+	return (p.Page - 1) * p.PerPage
+}
+
+// Limit is the number of rows in a page (SQL LIMIT).
+func (p Pagination) Limit() int {
+	return p.PerPage
+}
+
+// WithTotal returns p with Total and TotalPages set from the total item count.
+func (p Pagination) WithTotal(total int) Pagination {
+	p.Total = total
+	p.TotalPages = (total + p.PerPage - 1) / p.PerPage
+	return p
+}
+
+func (p Pagination) HasPrev() bool {
+	return p.Page > 1
+}
+
+func (p Pagination) HasNext() bool {
+	return p.Page < p.TotalPages
+}
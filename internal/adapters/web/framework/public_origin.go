@@ -0,0 +1,67 @@
+package framework
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// PublicOrigin builds absolute URLs for links and redirects that leave the app, such as
+// the OIDC redirect_uri. By default every URL is based on the configured app URL. An app
+// served on several domains through one proxy can list them as trusted hosts: a request
+// whose X-Forwarded-Host (or Host, without a proxy) is on the list gets URLs on that
+// host, with the scheme from RequestScheme. Any other host falls back to the app URL, so
+// a forged header cannot point generated links or redirects at a foreign site.
+type PublicOrigin struct {
+	appURL  *url.URL
+	trusted []string // lower-cased host[:port] values
+}
+
+// NewPublicOrigin returns a PublicOrigin for appURL (e.g. "https://example.com") that
+// also accepts the hosts in trustedHosts (e.g. "example.org", "app.example.net:8443").
+func NewPublicOrigin(appURL string, trustedHosts []string) (*PublicOrigin, error) {
+	u, err := url.Parse(strings.TrimSuffix(appURL, "/"))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("app URL %q must be an absolute URL", appURL)
+	}
+	o := &PublicOrigin{appURL: u}
+	for _, host := range trustedHosts {
+		if host == "" || strings.ContainsAny(host, "/?#@") {
+			return nil, fmt.Errorf("trusted host %q must be a host name with an optional port", host)
+		}
+		o.trusted = append(o.trusted, strings.ToLower(host))
+	}
+	return o, nil
+}
+
+// URL returns the absolute URL of path, which must start with "/", for r.
+func (o *PublicOrigin) URL(r *http.Request, path string) string {
+	return o.Base(r) + path
+}
+
+// Base returns the URL that URLs for r are built on, without a trailing slash: the app URL,
+// or its path under the trusted host r addressed.
+func (o *PublicOrigin) Base(r *http.Request) string {
+	if host := o.requestHost(r); host != "" {
+		return RequestScheme(r) + "://" + host + o.appURL.Path
+	}
+	return o.appURL.String()
+}
+
+// requestHost returns the host the client addressed when it is trusted, or "".
+func (o *PublicOrigin) requestHost(r *http.Request) string {
+	if len(o.trusted) == 0 {
+		return ""
+	}
+	host := r.Host
+	if forwarded := r.Header.Get("X-Forwarded-Host"); forwarded != "" {
+		host, _, _ = strings.Cut(forwarded, ",")
+	}
+	host = strings.ToLower(strings.TrimSpace(host))
+	if slices.Contains(o.trusted, host) {
+		return host
+	}
+	return ""
+}
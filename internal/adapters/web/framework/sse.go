@@ -2,35 +2,369 @@ package framework
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// SSEHandlerFunc produces a client's messages. It runs in its own goroutine and must return
+// once ctx is done: after the client disconnects nothing reads messageChan any more, so an
+// unguarded send blocks forever and leaks the goroutine. Send with SendSSE, or build
+// periodic producers with SSETicker, which both handle this.
 type SSEHandlerFunc func(context context.Context, messageChan chan string)
 
+// LastEventID returns the id of the last event a reconnecting client received, from the
+// Last-Event-ID header browsers send or, for clients that cannot set headers, the
+// lastEventId query parameter; "" on a first connect. It is available in the ctx given to
+// producers and snapshots.
+//
+// Resuming is up to the producer: nothing is buffered here, so a producer that gives its
+// events increasing ids (SSEMessage.ID, with BuildSSEEventHandler) must itself replay the
+// events after LastEventID before streaming new ones, or send a fresh snapshot.
+func LastEventID(ctx context.Context) string {
+	id, _ := ctx.Value(lastEventIDContextKey).(string)
+	return id
+}
+
+type lastEventIDKey string
+
+const lastEventIDContextKey lastEventIDKey = "lastEventID"
+
+// SSEEventHandlerFunc is SSEHandlerFunc for producers of whole events, with an event type,
+// id or retry hint, rather than data alone. The same rules apply; send with SendSSE.
+type SSEEventHandlerFunc func(context context.Context, messageChan chan SSEMessage)
+
+// SendSSE sends data on messageChan unless ctx is done first. It reports whether the
+// message was sent; a producer should return as soon as it gets false.
+func SendSSE[T string | SSEMessage](ctx context.Context, messageChan chan T, data T) bool {
+	select {
+	case messageChan <- data:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// SSETicker returns a producer that sends generate's result every interval until the
+// client disconnects, stopping its ticker on the way out.
+func SSETicker(interval time.Duration, generate func(ctx context.Context) string) SSEHandlerFunc {
+	return func(ctx context.Context, messageChan chan string) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if !SendSSE(ctx, messageChan, generate(ctx)) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// SSEMessage is a single server-sent event. Only Data is required.
+type SSEMessage struct {
+	ID    string // sent as the event id; browsers echo the last one in Last-Event-ID on reconnect
+	Event string // event type; empty for the default "message" event
+	Data  string // may span multiple lines
+
+	// Retry, when positive, tells the browser how long to wait before reconnecting once
+	// the stream closes. Sent in whole milliseconds.
+	Retry time.Duration
+}
+
+// SSEOptions configures BuildSSEHandlerWithOptions.
+type SSEOptions struct {
+	// Snapshot, if set, returns the full current state, sent before anything from the
+	// producer. It is skipped when the client reconnects with a LastEventID, since the
+	// client already has state and the producer's stream resumes from there.
+	Snapshot func(ctx context.Context) SSEMessage
+
+	// Headers are added to the response after the defaults, so they can also override them.
+	Headers http.Header
+	// AllowProxyBuffering omits the "X-Accel-Buffering: no" header that otherwise stops
+	// nginx from buffering the stream, which would hold events back until the buffer fills.
+	AllowProxyBuffering bool
+
+	// Heartbeat is how long a stream may go without output before a comment line is sent
+	// to keep proxies and load balancers from closing it as idle. Zero uses 15s; a
+	// negative value disables heartbeats.
+	Heartbeat time.Duration
+	// newHeartbeatTimer makes the heartbeat timer; nil uses a real one. Tests set it to
+	// fire heartbeats without waiting.
+	newHeartbeatTimer func(time.Duration) sseTimer
+	// WriteTimeout bounds each write and flush to the client. A client that stops
+	// reading, leaving the connection open, is dropped once it expires instead of
+	// blocking the handler forever. Zero uses 10s. It also extends the server's
+	// WriteTimeout, which would otherwise end every stream at that age.
+	WriteTimeout time.Duration
+
+	// Shutdown, once closed, ends the stream with an SSECloseEvent. http.Server.Shutdown
+	// does not cancel request contexts, so without it open streams hold up shutdown until
+	// its deadline. Pass the Done channel of a context cancelled before Shutdown is called.
+	Shutdown <-chan struct{}
+}
+
+// SSECloseEvent is the event type sent when a stream ends because the server is shutting
+// down. Pages should close their EventSource on it rather than let it reconnect to a
+// server that is going away; a fresh page load reaches the new one:
+//
+//	source.addEventListener("close", () => source.close())
+const SSECloseEvent = "close"
+
+const (
+	// defaultSSEHeartbeat stays under the 30-60s idle timeouts common in proxies.
+	defaultSSEHeartbeat = 15 * time.Second
+
+	defaultSSEWriteTimeout = 10 * time.Second
+)
+
+// sseStream writes events to a client, each under a fresh write deadline, and flushes
+// them. Any error, a missed deadline included, means the client is gone.
+type sseStream struct {
+	w            http.ResponseWriter
+	rc           *http.ResponseController
+	writeTimeout time.Duration
+}
+
+func newSSEStream(w http.ResponseWriter, writeTimeout time.Duration) *sseStream {
+	if writeTimeout <= 0 {
+		writeTimeout = defaultSSEWriteTimeout
+	}
+	return &sseStream{w: w, rc: http.NewResponseController(w), writeTimeout: writeTimeout}
+}
+
+// send writes msg and flushes it.
+func (s *sseStream) send(msg SSEMessage) error {
+	return s.write(func() error { return writeSSEMessage(s.w, msg) })
+}
+
+// heartbeat writes a comment line, which EventSource ignores, and flushes it.
+func (s *sseStream) heartbeat() error {
+	return s.write(func() error {
+		_, err := io.WriteString(s.w, ": keepalive\n\n")
+		return err
+	})
+}
+
+// flush sends buffered output, such as the headers before the first event.
+func (s *sseStream) flush() error {
+	return s.write(func() error { return nil })
+}
+
+func (s *sseStream) write(fn func() error) error {
+	// writers that cannot take a deadline, e.g. in tests, are written to without one
+	if err := s.rc.SetWriteDeadline(time.Now().Add(s.writeTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	if err := s.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+// sseHeartbeat fires once a stream has been idle for its interval; reset it after every
+// write. With heartbeats disabled its channel is nil and never fires.
+type sseHeartbeat struct {
+	timer    sseTimer
+	interval time.Duration
+}
+
+// sseTimer is the part of a *time.Timer sseHeartbeat uses, so tests can fire it by hand.
+type sseTimer interface {
+	C() <-chan time.Time
+	Reset(d time.Duration) bool
+	Stop() bool
+}
+
+// stdTimer is an sseTimer backed by a real *time.Timer.
+type stdTimer struct{ *time.Timer }
+
+func (t stdTimer) C() <-chan time.Time { return t.Timer.C }
+
+func newStdTimer(d time.Duration) sseTimer { return stdTimer{time.NewTimer(d)} }
+
+// newSSEHeartbeat returns a heartbeat for interval, its timer made by newTimer, or by
+// newStdTimer when nil.
+func newSSEHeartbeat(interval time.Duration, newTimer func(time.Duration) sseTimer) *sseHeartbeat {
+	if interval == 0 {
+		interval = defaultSSEHeartbeat
+	}
+	if newTimer == nil {
+		newTimer = newStdTimer
+	}
+	h := &sseHeartbeat{interval: interval}
+	if interval > 0 {
+		h.timer = newTimer(interval)
+	}
+	return h
+}
+
+func (h *sseHeartbeat) C() <-chan time.Time {
+	if h.timer == nil {
+		return nil
+	}
+	return h.timer.C()
+}
+
+func (h *sseHeartbeat) reset() {
+	if h.timer != nil {
+		h.timer.Reset(h.interval)
+	}
+}
+
+func (h *sseHeartbeat) stop() {
+	if h.timer != nil {
+		h.timer.Stop()
+	}
+}
+
 func BuildSSEHandler(newClient SSEHandlerFunc) http.HandlerFunc {
+	return BuildSSEHandlerWithOptions(SSEOptions{}, newClient)
+}
+
+// BuildSSEHandlerWithOptions streams the messages newClient sends on its channel, after
+// the optional snapshot. This is the connect-then-stream pattern, e.g. for notifications:
+//
+//	framework.BuildSSEHandlerWithOptions(framework.SSEOptions{
+//		Snapshot: func(ctx context.Context) framework.SSEMessage {
+//			return framework.SSEMessage{Event: "notifications", Data: renderUnread(ctx)}
+//		},
+//	}, func(ctx context.Context, messages chan string) {
+//		for n := range subscribe(ctx) { // incremental updates only
+//			if !framework.SendSSE(ctx, messages, renderNotification(n)) {
+//				return
+//			}
+//		}
+//	})
+func BuildSSEHandlerWithOptions(opts SSEOptions, newClient SSEHandlerFunc) http.HandlerFunc {
+	return buildSSEHandler(opts, newClient, func(data string) SSEMessage {
+		return SSEMessage{Data: data}
+	})
+}
+
+// BuildSSEEventHandler is BuildSSEHandlerWithOptions for producers of SSEMessage, whose
+// event type lets the browser dispatch each message to its own listener:
+//
+//	source.addEventListener("notification", e => render(e.data))
+func BuildSSEEventHandler(opts SSEOptions, newClient SSEEventHandlerFunc) http.HandlerFunc {
+	return buildSSEHandler(opts, newClient, func(msg SSEMessage) SSEMessage {
+		return msg
+	})
+}
+
+func buildSSEHandler[T any](opts SSEOptions, newClient func(context.Context, chan T), toMessage func(T) SSEMessage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/event-stream")
-		w.Header().Set("Cache-Control", "no-cache")
-		w.Header().Set("Connection", "keep-alive")
+		setSSEHeaders(w, opts)
 
-		rc := http.NewResponseController(w)
+		stream := newSSEStream(w, opts.WriteTimeout)
 		done := r.Context().Done()
-		clientChannel := make(chan string)
+		clientChannel := make(chan T)
 
-		go newClient(r.Context(), clientChannel)
+		lastEventID := r.Header.Get("Last-Event-ID")
+		if lastEventID == "" {
+			lastEventID = r.URL.Query().Get("lastEventId")
+		}
+		ctx := context.WithValue(r.Context(), lastEventIDContextKey, lastEventID)
+
+		if opts.Snapshot != nil && lastEventID == "" {
+			if err := stream.send(opts.Snapshot(ctx)); err != nil {
+				return
+			}
+		}
+
+		go newClient(ctx, clientChannel)
+
+		heartbeat := newSSEHeartbeat(opts.Heartbeat, opts.newHeartbeatTimer)
+		defer heartbeat.stop()
 
 		for {
 			select {
 			case data := <-clientChannel:
-				_, err := fmt.Fprintf(w, "data: %s\n\n", data)
-				if err != nil {
+				if err := stream.send(toMessage(data)); err != nil {
 					return
 				}
-				rc.Flush()
+				heartbeat.reset()
+			case <-heartbeat.C():
+				if err := stream.heartbeat(); err != nil {
+					return
+				}
+				heartbeat.reset()
+			case <-opts.Shutdown:
+				_ = stream.send(SSEMessage{Event: SSECloseEvent, Data: "shutdown"})
+				return
 			case <-done:
 				return
 			}
 		}
 	}
 }
+
+// setSSEHeaders sets the event-stream response headers, then opts.Headers.
+func setSSEHeaders(w http.ResponseWriter, opts SSEOptions) {
+	w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	SetNoStore(w)
+	w.Header().Set("Connection", "keep-alive")
+	if !opts.AllowProxyBuffering {
+		w.Header().Set("X-Accel-Buffering", "no")
+	}
+	for name, values := range opts.Headers {
+		w.Header()[http.CanonicalHeaderKey(name)] = values
+	}
+}
+
+// WriteSSEEvent writes a single SSE event and flushes it to the client. event may be empty
+// for the default "message" event. data may span multiple lines (e.g. an HTML fragment from
+// RenderFragment); each line is framed as its own data field so the client reassembles it intact.
+func WriteSSEEvent(w http.ResponseWriter, event, data string) error {
+	return WriteSSEMessage(w, SSEMessage{Event: event, Data: data})
+}
+
+// WriteSSEMessage is WriteSSEEvent for a whole message, with its id and retry hint.
+func WriteSSEMessage(w http.ResponseWriter, msg SSEMessage) error {
+	if err := writeSSEMessage(w, msg); err != nil {
+		return err
+	}
+	return http.NewResponseController(w).Flush()
+}
+
+// writeSSEMessage encodes msg as one event frame: optional id and event fields, a data
+// field per line of Data, then the blank line ending the event. It only needs an
+// io.Writer, so framing can be checked byte for byte without a ResponseWriter; the
+// handlers add flushing on top.
+func writeSSEMessage(w io.Writer, msg SSEMessage) error {
+	var sb strings.Builder
+	if msg.ID != "" {
+		sb.WriteString("id: ")
+		sb.WriteString(msg.ID)
+		sb.WriteString("\n")
+	}
+	if msg.Event != "" {
+		sb.WriteString("event: ")
+		sb.WriteString(msg.Event)
+		sb.WriteString("\n")
+	}
+	if msg.Retry > 0 {
+		sb.WriteString("retry: ")
+		sb.WriteString(strconv.FormatInt(msg.Retry.Milliseconds(), 10))
+		sb.WriteString("\n")
+	}
+	data := strings.ReplaceAll(msg.Data, "\r\n", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		sb.WriteString("data: ")
+		sb.WriteString(line)
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,190 @@
+package framework
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// hubClientBuffer is how many broadcasts a client may fall behind before it misses some.
+const hubClientBuffer = 16
+
+// HubReconnectEvent is the event type Shutdown sends before closing each stream. The
+// browser's EventSource reconnects on its own once the stream ends; pages can listen for
+// it to show that an update is in progress.
+const HubReconnectEvent = "reconnect"
+
+// Hub fans server-sent events out to every connected client, e.g. to push a change made
+// by one user to all open pages. Clients connect through HubSSEHandler; anything can call
+// Broadcast. A Hub is process-local: with several instances, each only reaches its own
+// clients. The zero value is ready to use.
+type Hub struct {
+	mu      sync.Mutex
+	clients map[chan SSEMessage]struct{}
+	closing chan struct{} // closed by Shutdown; created lazily so the zero value works
+	retry   time.Duration // retry hint sent with the reconnect event
+	idle    chan struct{} // closed once the last client is gone after Shutdown
+}
+
+// Register adds a client and returns the channel its broadcasts arrive on. Call
+// Unregister with it once the client is gone.
+func (h *Hub) Register() chan SSEMessage {
+	client := make(chan SSEMessage, hubClientBuffer)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.clients == nil {
+		h.clients = make(map[chan SSEMessage]struct{})
+	}
+	h.clients[client] = struct{}{}
+	return client
+}
+
+// Unregister removes a client added with Register. Its channel is not closed, so a
+// Broadcast racing with the disconnect never sends on a closed channel.
+func (h *Hub) Unregister(client chan SSEMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients, client)
+	if h.idle != nil && len(h.clients) == 0 {
+		h.markIdle()
+	}
+}
+
+// Broadcast sends msg to every registered client without blocking: a client whose buffer
+// is full, because its connection is slow, misses msg rather than holding up the others.
+func (h *Hub) Broadcast(msg SSEMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for client := range h.clients {
+		select {
+		case client <- msg:
+		default:
+		}
+	}
+}
+
+// Clients returns the number of registered clients.
+func (h *Hub) Clients() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients)
+}
+
+// Shutdown ends every HubSSEHandler stream, so clients reconnect to another instance
+// instead of holding the connection until the server drops it. Each stream gets the
+// broadcasts still queued for it, then a HubReconnectEvent carrying retry as the delay
+// before the browser reconnects, and is closed. Clients connecting afterwards get the
+// reconnect event straight away. Shutdown waits until every stream has ended or ctx is
+// done, returning ctx.Err() in the latter case.
+//
+// Call it before http.Server.Shutdown, which waits for open streams to end on their own:
+//
+//	hub.Shutdown(shutdownCtx, 2*time.Second)
+//	server.Shutdown(shutdownCtx)
+func (h *Hub) Shutdown(ctx context.Context, retry time.Duration) error {
+	h.mu.Lock()
+	closing := h.closingChan()
+	select {
+	case <-closing:
+	default:
+		h.retry = retry
+		close(closing)
+	}
+	if h.idle == nil {
+		h.idle = make(chan struct{})
+	}
+	if len(h.clients) == 0 {
+		h.markIdle()
+	}
+	idle := h.idle
+	h.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// markIdle closes idle unless already closed. h.mu must be held.
+func (h *Hub) markIdle() {
+	select {
+	case <-h.idle:
+	default:
+		close(h.idle)
+	}
+}
+
+// closingChan returns the channel Shutdown closes. h.mu must be held.
+func (h *Hub) closingChan() chan struct{} {
+	if h.closing == nil {
+		h.closing = make(chan struct{})
+	}
+	return h.closing
+}
+
+// HubSSEHandler streams hub's broadcasts to the client for as long as the request lasts,
+// registering it on connect and unregistering it on disconnect or Hub.Shutdown. Idle
+// streams get a heartbeat every 15s and writes time out after 10s, as with SSEOptions.
+func HubSSEHandler(hub *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setSSEHeaders(w, SSEOptions{})
+
+		client := hub.Register()
+		defer hub.Unregister(client)
+
+		hub.mu.Lock()
+		closing := hub.closingChan()
+		hub.mu.Unlock()
+
+		stream := newSSEStream(w, 0)
+		// send the headers now, so the browser sees the stream open before the first event
+		if err := stream.flush(); err != nil {
+			return
+		}
+
+		heartbeat := newSSEHeartbeat(0, nil)
+		defer heartbeat.stop()
+
+		done := r.Context().Done()
+		for {
+			select {
+			case msg := <-client:
+				if err := stream.send(msg); err != nil {
+					return
+				}
+				heartbeat.reset()
+			case <-heartbeat.C():
+				if err := stream.heartbeat(); err != nil {
+					return
+				}
+				heartbeat.reset()
+			case <-closing:
+				hub.sendReconnect(stream, client)
+				return
+			case <-done:
+				return
+			}
+		}
+	}
+}
+
+// sendReconnect sends the broadcasts still queued for client, then the reconnect event.
+func (h *Hub) sendReconnect(stream *sseStream, client chan SSEMessage) {
+	for {
+		select {
+		case msg := <-client:
+			if err := stream.send(msg); err != nil {
+				return
+			}
+		default:
+			h.mu.Lock()
+			retry := h.retry
+			h.mu.Unlock()
+			_ = stream.send(SSEMessage{Event: HubReconnectEvent, Data: "reconnect", Retry: retry})
+			return
+		}
+	}
+}
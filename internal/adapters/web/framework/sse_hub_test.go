@@ -0,0 +1,162 @@
+package framework
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// connectHub opens a HubSSEHandler stream on server and returns the response once the
+// stream is open, i.e. the client is registered.
+func connectHub(t *testing.T, server *httptest.Server) *http.Response {
+	t.Helper()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	return resp
+}
+
+func TestHubShutdownSendsReconnect(t *testing.T) {
+	hub := &Hub{}
+	server := httptest.NewServer(HubSSEHandler(hub))
+	defer server.Close()
+
+	var responses []*http.Response
+	for range 2 {
+		responses = append(responses, connectHub(t, server))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := hub.Shutdown(ctx, 2*time.Second); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	want := "event: reconnect\nretry: 2000\ndata: reconnect\n\n"
+	for i, resp := range responses {
+		body, err := io.ReadAll(resp.Body) // returns once the stream is closed
+		if err != nil {
+			t.Fatalf("client %d: %v", i, err)
+		}
+		if string(body) != want {
+			t.Errorf("client %d got %q, want %q", i, body, want)
+		}
+	}
+	if n := hub.Clients(); n != 0 {
+		t.Errorf("%d clients still registered after Shutdown", n)
+	}
+}
+
+func TestHubShutdownFlushesQueuedBroadcasts(t *testing.T) {
+	hub := &Hub{}
+	client := hub.Register()
+	hub.Broadcast(SSEMessage{Data: "last update"})
+
+	rec := httptest.NewRecorder()
+	hub.sendReconnect(newSSEStream(rec, 0), client)
+
+	want := "data: last update\n\nevent: reconnect\ndata: reconnect\n\n"
+	if got := rec.Body.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestHubShutdownWithoutClients(t *testing.T) {
+	hub := &Hub{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := hub.Shutdown(ctx, time.Second); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+}
+
+func TestHubShutdownTimesOut(t *testing.T) {
+	hub := &Hub{}
+	hub.Register() // never served, so never unregistered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := hub.Shutdown(ctx, time.Second); err != context.DeadlineExceeded {
+		t.Errorf("Shutdown = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestHubClientConnectingAfterShutdown(t *testing.T) {
+	hub := &Hub{}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := hub.Shutdown(ctx, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(HubSSEHandler(hub))
+	defer server.Close()
+	body, err := io.ReadAll(connectHub(t, server).Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "event: reconnect\nretry: 1000\ndata: reconnect\n\n"; string(body) != want {
+		t.Errorf("got %q, want %q", body, want)
+	}
+}
+
+// readEvent reads one event frame, up to and including its blank line, from r.
+func readEvent(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	var event strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading event: %v (got %q)", err, event.String())
+		}
+		event.WriteString(line)
+		if line == "\n" {
+			return event.String()
+		}
+	}
+}
+
+func TestHubBroadcastReachesEveryClient(t *testing.T) {
+	hub := &Hub{}
+	server := httptest.NewServer(HubSSEHandler(hub))
+	t.Cleanup(server.Close) // after connectHub closes the streams, which it waits for
+
+	var readers []*bufio.Reader
+	for range 3 {
+		readers = append(readers, bufio.NewReader(connectHub(t, server).Body))
+	}
+	if n := hub.Clients(); n != 3 {
+		t.Fatalf("%d clients registered, want 3", n)
+	}
+
+	hub.Broadcast(SSEMessage{Event: "note", Data: "saved"})
+
+	for i, r := range readers {
+		if got, want := readEvent(t, r), "event: note\ndata: saved\n\n"; got != want {
+			t.Errorf("client %d got %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestHubUnregisteredClientGetsNothing(t *testing.T) {
+	hub := &Hub{}
+	client := hub.Register()
+	hub.Unregister(client)
+
+	hub.Broadcast(SSEMessage{Data: "late"})
+
+	if len(client) != 0 {
+		t.Error("unregistered client received a broadcast")
+	}
+}
@@ -0,0 +1,238 @@
+package framework
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// idleProducer sends nothing and returns once the client is gone.
+func idleProducer(ctx context.Context, messages chan string) { <-ctx.Done() }
+
+// serveClosedSSE serves one request to handler from a client that has already gone, so
+// the handler sets up the stream and returns at once.
+func serveClosedSSE(handler http.HandlerFunc, r *http.Request) *httptest.ResponseRecorder {
+	ctx, cancel := context.WithCancel(r.Context())
+	cancel()
+	rec := httptest.NewRecorder()
+	handler(rec, r.WithContext(ctx))
+	return rec
+}
+
+func TestSSEHeaders(t *testing.T) {
+	tests := []struct {
+		name string
+		opts SSEOptions
+		want map[string]string // "" means the header must be absent
+	}{
+		{"defaults", SSEOptions{}, map[string]string{
+			"Content-Type":      "text/event-stream; charset=utf-8",
+			"Cache-Control":     "no-cache, no-store, must-revalidate",
+			"X-Accel-Buffering": "no",
+		}},
+		{"proxy buffering allowed", SSEOptions{AllowProxyBuffering: true}, map[string]string{
+			"X-Accel-Buffering": "",
+		}},
+		{"extra headers", SSEOptions{Headers: http.Header{"access-control-allow-origin": {"*"}}}, map[string]string{
+			"Access-Control-Allow-Origin": "*",
+			"X-Accel-Buffering":           "no",
+		}},
+		{"extra headers override defaults", SSEOptions{Headers: http.Header{"X-Accel-Buffering": {"yes"}}}, map[string]string{
+			"X-Accel-Buffering": "yes",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := BuildSSEHandlerWithOptions(tt.opts, idleProducer)
+			rec := serveClosedSSE(handler, httptest.NewRequest(http.MethodGet, "/events", nil))
+
+			for name, want := range tt.want {
+				if got := rec.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteSSEMessageFraming(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  SSEMessage
+		want string
+	}{
+		{"data only", SSEMessage{Data: "hello"}, "data: hello\n\n"},
+		{"empty data", SSEMessage{}, "data: \n\n"},
+		{"named event", SSEMessage{Event: "notification", Data: "hello"}, "event: notification\ndata: hello\n\n"},
+		{"multi-line data", SSEMessage{Data: "<li>\n  one\n</li>"}, "data: <li>\ndata:   one\ndata: </li>\n\n"},
+		{"CRLF line endings", SSEMessage{Data: "a\r\nb"}, "data: a\ndata: b\n\n"},
+		{"trailing newline", SSEMessage{Data: "a\n"}, "data: a\ndata: \n\n"},
+		{"id and retry", SSEMessage{ID: "42", Retry: 5 * time.Second, Data: "hello"}, "id: 42\nretry: 5000\ndata: hello\n\n"},
+		{"sub-millisecond retry", SSEMessage{Retry: 1500 * time.Microsecond, Data: "hello"}, "retry: 1\ndata: hello\n\n"},
+		{"every field", SSEMessage{ID: "7", Event: "update", Retry: 3 * time.Second, Data: "one\ntwo"},
+			"id: 7\nevent: update\nretry: 3000\ndata: one\ndata: two\n\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeSSEMessage(&buf, tt.msg); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLastEventIDReachesTheProducer(t *testing.T) {
+	tests := []struct {
+		name         string
+		header       string // Last-Event-ID
+		target       string
+		want         string
+		wantSnapshot bool
+	}{
+		{"first connection", "", "/events", "", true},
+		{"reconnect with header", "41", "/events", "41", false},
+		{"reconnect with query param", "", "/events?lastEventId=41", "41", false},
+		{"header wins over query param", "41", "/events?lastEventId=7", "41", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := make(chan string, 1)
+			handler := BuildSSEHandlerWithOptions(SSEOptions{
+				Snapshot: func(ctx context.Context) SSEMessage { return SSEMessage{Event: "snapshot", Data: "state"} },
+			}, func(ctx context.Context, messages chan string) {
+				ids <- LastEventID(ctx)
+			})
+
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.header != "" {
+				r.Header.Set("Last-Event-ID", tt.header)
+			}
+			rec := serveClosedSSE(handler, r)
+
+			if got := <-ids; got != tt.want {
+				t.Errorf("LastEventID = %q, want %q", got, tt.want)
+			}
+			if sent := strings.Contains(rec.Body.String(), "event: snapshot\n"); sent != tt.wantSnapshot {
+				t.Errorf("snapshot sent = %v, want %v", sent, tt.wantSnapshot)
+			}
+		})
+	}
+}
+
+// manualTimer is an sseTimer that fires only when the test sends on it.
+type manualTimer chan time.Time
+
+func (t manualTimer) C() <-chan time.Time      { return t }
+func (t manualTimer) Reset(time.Duration) bool { return true }
+func (t manualTimer) Stop() bool               { return true }
+
+func TestSSEHeartbeatWhenIdle(t *testing.T) {
+	timer := make(manualTimer, 1)
+	timer <- time.Time{} // the stream has been idle since it opened
+	send := make(chan struct{})
+	server := httptest.NewServer(BuildSSEHandlerWithOptions(SSEOptions{
+		newHeartbeatTimer: func(time.Duration) sseTimer { return timer },
+	}, func(ctx context.Context, messages chan string) {
+		select {
+		case <-send:
+			SendSSE(ctx, messages, "hello")
+		case <-ctx.Done():
+			return
+		}
+		<-ctx.Done()
+	}))
+	t.Cleanup(server.Close) // after connectHub closes the stream
+
+	r := bufio.NewReader(connectHub(t, server).Body)
+	if got := readEvent(t, r); got != ": keepalive\n\n" {
+		t.Fatalf("idle stream sent %q, want a keepalive comment", got)
+	}
+
+	close(send)
+	if got := readEvent(t, r); got != "data: hello\n\n" {
+		t.Errorf("got %q, want the message intact", got)
+	}
+
+	timer <- time.Time{}
+	if got := readEvent(t, r); got != ": keepalive\n\n" {
+		t.Errorf("idle stream sent %q after a message, want a keepalive comment", got)
+	}
+}
+
+// stalledWriter is a ResponseWriter whose client has stopped reading: each write blocks
+// until the write deadline passes, then fails as a network connection would.
+type stalledWriter struct {
+	header   http.Header
+	deadline time.Time
+}
+
+func (w *stalledWriter) Header() http.Header { return w.header }
+func (w *stalledWriter) WriteHeader(int)     {}
+
+func (w *stalledWriter) Write(p []byte) (int, error) {
+	if w.deadline.IsZero() {
+		select {} // no deadline: blocked for good
+	}
+	time.Sleep(time.Until(w.deadline))
+	return 0, os.ErrDeadlineExceeded
+}
+
+func (w *stalledWriter) SetWriteDeadline(deadline time.Time) error {
+	w.deadline = deadline
+	return nil
+}
+
+func TestSSEDropsStalledClient(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler := BuildSSEHandlerWithOptions(SSEOptions{WriteTimeout: 20 * time.Millisecond}, func(ctx context.Context, messages chan string) {
+		for SendSSE(ctx, messages, "tick") {
+		}
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler(&stalledWriter{header: http.Header{}}, httptest.NewRequest(http.MethodGet, "/events", nil).WithContext(ctx))
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler still blocked on a client that stopped reading")
+	}
+}
+
+func TestSSEShutdownEndsStream(t *testing.T) {
+	shutdown := make(chan struct{})
+	server := httptest.NewServer(BuildSSEHandlerWithOptions(SSEOptions{Shutdown: shutdown, Heartbeat: -1},
+		func(ctx context.Context, messages chan string) {
+			SendSSE(ctx, messages, "ready")
+			<-ctx.Done()
+		}))
+	t.Cleanup(server.Close) // after connectHub closes the stream
+
+	r := bufio.NewReader(connectHub(t, server).Body)
+	if got := readEvent(t, r); got != "data: ready\n\n" {
+		t.Fatalf("got %q before shutdown", got)
+	}
+	close(shutdown)
+
+	if got, want := readEvent(t, r), "event: close\ndata: shutdown\n\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if rest, err := io.ReadAll(r); err != nil || len(rest) > 0 {
+		t.Errorf("stream went on after the close event: %q (%v)", rest, err)
+	}
+}
@@ -5,45 +5,131 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"io/fs"
 	"log/slog"
 	"net/http"
 	"path"
 	"reflect"
+	"runtime/debug"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"text/template/parse"
+	"time"
 )
 
-const defaultBaseTemplate = "base.html"
+const (
+	defaultBaseTemplate  = "base.html"
+	defaultErrorTemplate = "error.html"
+	defaultErrorFragment = "error_fragment"
+	defaultContentBlock  = "content"
+)
+
+// SharedDataFunc is the template func reserved for the values of SharedDataProviders:
+// {{ shared "nav" }} returns the value contributed under "nav", or nil if none was.
+// Chain fields onto it with {{ (shared "nav").Items }} or {{ with shared "nav" }}.
+const SharedDataFunc = "shared"
+
+// SharedDataProvider contributes one value to the data every template on a request can
+// read through SharedDataFunc, e.g. the navigation from one module and an unread count
+// from another. It returns the key to store value under, or "" to contribute nothing for
+// this request. An error fails the render, so the handler reports a 500.
+type SharedDataProvider func(r *http.Request) (key string, value any, err error)
 
 type TemplateRegistryOptions struct {
 	FS                   fs.FS                                // required: the filesystem to load templates from
+	OverrideFS           []fs.FS                              // optional: searched in order before FS; see below
 	RootDir              string                               // directory within FS containing page templates
 	IncludeDir           string                               // directory within FS containing shared includes
 	FuncMap              map[string]any                       // custom template functions
 	BaseTemplate         string                               // defaults to "base.html" if empty
 	Reload               bool                                 // when true, reload templates on each request
 	RequestFuncsProvider func(*http.Request) template.FuncMap // optional: provides request-scoped template functions
+	DevHeaders           bool                                 // dev only: emit X-Template-Reload and X-Render-Time headers
+	ErrorTemplate        string                               // page rendered with ErrorViewModel for handler errors; defaults to "error.html"
+	ErrorFragment        string                               // block of ErrorTemplate rendered instead for htmx requests; defaults to "error_fragment"
+
+	// ContentBlock is the block of the base layout holding the page body, rendered alone
+	// for partial requests; defaults to "content".
+	ContentBlock string
+	// PartialRequest reports whether WriteTo should render only ContentBlock instead of the
+	// whole base layout; defaults to IsPartialRequest. Return false to always send full
+	// pages. Handlers can force either form with WritePage and WriteContent.
+	PartialRequest func(*http.Request) bool
+
+	// UnusedBlocks sets what happens when a page defines a block that is never rendered
+	// (e.g. a typo'd name, or a block the base layout doesn't reference): "warn" (the
+	// default) logs it at startup, "error" fails the handler build, "ignore" skips the
+	// check. Blocks rendered only through RenderFragment are reported too.
+	UnusedBlocks string
+
+	// OverrideFS layers filesystems over FS for themes and plugins. Every path (pages,
+	// includes, tenant overlays) resolves to the first filesystem that has it, in the order
+	// OverrideFS..., FS, so an override can replace a single template and inherit the rest.
+	// Directory listings are merged; when layers disagree about an entry, the earlier one
+	// wins. Templates are validated as resolved, so an override must accept the same view
+	// model as the template it replaces.
+
+	// TenantDir is an optional directory within FS holding per-tenant overlays, one
+	// subdirectory per tenant id (e.g. "views/tenants/<id>/home.html" overrides
+	// "views/www/home.html" for that tenant). Overlays share the default includes.
+	TenantDir string
+	// TenantFunc resolves the tenant for a request; defaults to GetTenantID.
+	TenantFunc func(*http.Request) string
 }
 
 type TemplateRegistry struct {
 	storedTemplates map[string]*template.Template
+	tenantTemplates map[string]map[string]*template.Template // tenant id -> template path -> overlay
 	baseExists      bool
+	includeNames    map[string]bool // templates defined by includes, as opposed to pages
 	options         TemplateRegistryOptions
-	mu              sync.RWMutex // protects storedTemplates during reload
+	mu              sync.RWMutex // protects storedTemplates, tenantTemplates, baseExists and includeNames during reload
+
+	renderersMu sync.Mutex
+	renderers   []*TemplateRenderer // every page built into a handler, for Warm
+
+	providersMu sync.RWMutex
+	providers   []SharedDataProvider // run on every render; see AddSharedData
 }
 
 func NewTemplateRegistry(options TemplateRegistryOptions) (*TemplateRegistry, error) {
 	if options.FS == nil {
 		return nil, errors.New("FS is required")
 	}
+	if len(options.OverrideFS) > 0 {
+		options.FS = append(layeredFS(slices.Clone(options.OverrideFS)), options.FS)
+	}
 	if options.FuncMap == nil {
 		options.FuncMap = make(map[string]any)
 	}
 	if options.BaseTemplate == "" {
 		options.BaseTemplate = defaultBaseTemplate
 	}
+	if options.ErrorTemplate == "" {
+		options.ErrorTemplate = defaultErrorTemplate
+	}
+	if options.ErrorFragment == "" {
+		options.ErrorFragment = defaultErrorFragment
+	}
+	if options.ContentBlock == "" {
+		options.ContentBlock = defaultContentBlock
+	}
+	if options.PartialRequest == nil {
+		options.PartialRequest = IsPartialRequest
+	}
+	switch options.UnusedBlocks {
+	case "":
+		options.UnusedBlocks = "warn"
+	case "warn", "error", "ignore":
+	default:
+		return nil, fmt.Errorf("UnusedBlocks must be warn, error or ignore, got %q", options.UnusedBlocks)
+	}
+	if options.TenantDir != "" && options.TenantFunc == nil {
+		options.TenantFunc = GetTenantID
+	}
 
 	tm := &TemplateRegistry{
 		options: options,
@@ -52,18 +138,34 @@ func NewTemplateRegistry(options TemplateRegistryOptions) (*TemplateRegistry, er
 	if err := tm.loadTemplates(); err != nil {
 		return nil, err
 	}
+
+	if tmpl := tm.storedTemplates[options.ErrorTemplate]; tmpl != nil {
+		if err := tm.validateModelFields(extractFieldsFromData(ErrorViewModel{}), tmpl, options.ErrorTemplate); err != nil {
+			return nil, err
+		}
+		if tmpl.Lookup(options.ErrorFragment) != nil {
+			if err := tm.ValidateFragment(options.ErrorTemplate, options.ErrorFragment, ErrorViewModel{}); err != nil {
+				return nil, err
+			}
+		}
+	}
 	return tm, nil
 }
 
-func (tm *TemplateRegistry) loadTemplates() error {
-	tm.mu.Lock()
-	defer tm.mu.Unlock()
-
-	tm.storedTemplates = make(map[string]*template.Template)
-	tm.baseExists = false
+// Reload re-parses all templates and swaps them in atomically. On error the previously
+// loaded templates stay in use. Safe to call concurrently with rendering, e.g. from a
+// file watcher or a dev-only reload endpoint.
+func (tm *TemplateRegistry) Reload() error {
+	return tm.loadTemplates()
+}
 
+// loadTemplates parses includes, pages and tenant overlays without holding the lock, then
+// swaps them in under it so readers never observe a partially loaded set.
+func (tm *TemplateRegistry) loadTemplates() error {
 	// load includes from IncludeDir
-	includes := template.New("root").Funcs(tm.options.FuncMap)
+	includes := template.New("root").Funcs(tm.options.FuncMap).Funcs(template.FuncMap{
+		SharedDataFunc: sharedDataFunc(nil), // replaced per render; nil outside one, e.g. in fragments
+	})
 
 	if tm.options.RequestFuncsProvider != nil {
 		includes = includes.Funcs(tm.options.RequestFuncsProvider(&http.Request{}))
@@ -74,6 +176,8 @@ func (tm *TemplateRegistry) loadTemplates() error {
 		if err != nil {
 			return fmt.Errorf("reading include dir: %w", err)
 		}
+		definedIn := make(map[string]string) // template name -> include that defines it
+		var conflicts []error
 		for _, entry := range includeEntries {
 			if entry.IsDir() {
 				continue
@@ -83,19 +187,78 @@ func (tm *TemplateRegistry) loadTemplates() error {
 			if err != nil {
 				return fmt.Errorf("reading include %s: %w", includePath, err)
 			}
+
+			// html/template silently lets a later define replace an earlier one, so catch
+			// two includes defining the same name before parsing them into one set
+			names, err := definedTemplateNames(entry.Name(), string(content))
+			if err != nil {
+				return fmt.Errorf("parsing include %s: %w", includePath, err)
+			}
+			for _, name := range names {
+				if other, ok := definedIn[name]; ok {
+					conflicts = append(conflicts, fmt.Errorf("template %q is defined in both %s and %s", name, other, includePath))
+					continue
+				}
+				definedIn[name] = includePath
+			}
+
 			_, err = includes.New(entry.Name()).Parse(string(content))
 			if err != nil {
 				return fmt.Errorf("parsing include %s: %w", includePath, err)
 			}
 		}
+		if len(conflicts) > 0 {
+			return fmt.Errorf("duplicate include templates: %w", errors.Join(conflicts...))
+		}
 	}
 
-	if base := includes.Lookup(tm.options.BaseTemplate); base != nil {
-		tm.baseExists = true
+	baseExists := includes.Lookup(tm.options.BaseTemplate) != nil
+	includeNames := make(map[string]bool)
+	for _, t := range includes.Templates() {
+		includeNames[t.Name()] = true
 	}
 
 	// load page templates from RootDir
-	err := fs.WalkDir(tm.options.FS, tm.options.RootDir, func(filePath string, d fs.DirEntry, err error) error {
+	pages, err := loadPages(tm.options.FS, tm.options.RootDir, includes)
+	if err != nil {
+		return err
+	}
+
+	// load per-tenant overlays, one subdirectory per tenant
+	tenantTemplates := make(map[string]map[string]*template.Template)
+	if tm.options.TenantDir != "" {
+		tenantEntries, err := fs.ReadDir(tm.options.FS, tm.options.TenantDir)
+		if err != nil {
+			return fmt.Errorf("reading tenant dir: %w", err)
+		}
+		for _, entry := range tenantEntries {
+			if !entry.IsDir() {
+				continue
+			}
+			overlays, err := loadPages(tm.options.FS, path.Join(tm.options.TenantDir, entry.Name()), includes)
+			if err != nil {
+				return fmt.Errorf("loading templates for tenant %s: %w", entry.Name(), err)
+			}
+			tenantTemplates[entry.Name()] = overlays
+		}
+	}
+
+	tm.mu.Lock()
+	tm.storedTemplates = pages
+	tm.tenantTemplates = tenantTemplates
+	tm.baseExists = baseExists
+	tm.includeNames = includeNames
+	tm.mu.Unlock()
+
+	return nil
+}
+
+// loadPages parses every file under dir as a page template layered on a clone of includes,
+// keyed by its path relative to dir.
+func loadPages(fsys fs.FS, dir string, includes *template.Template) (map[string]*template.Template, error) {
+	pages := make(map[string]*template.Template)
+
+	err := fs.WalkDir(fsys, dir, func(filePath string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -103,13 +266,17 @@ func (tm *TemplateRegistry) loadTemplates() error {
 			return nil
 		}
 
-		// Get path relative to RootDir
-		relativePath, err := relPath(tm.options.RootDir, filePath)
+		// Get path relative to dir
+		relativePath, err := relPath(dir, filePath)
 		if err != nil {
 			return err
 		}
+		// a page named like an include would replace the include in its own template set
+		if includes.Lookup(relativePath) != nil {
+			return fmt.Errorf("page %s has the same name as an include template %q", filePath, relativePath)
+		}
 
-		content, err := fs.ReadFile(tm.options.FS, filePath)
+		content, err := fs.ReadFile(fsys, filePath)
 		if err != nil {
 			return fmt.Errorf("reading template %s: %w", filePath, err)
 		}
@@ -124,11 +291,29 @@ func (tm *TemplateRegistry) loadTemplates() error {
 			return fmt.Errorf("parsing template %s: %w", filePath, err)
 		}
 
-		tm.storedTemplates[relativePath] = newTemplate
+		pages[relativePath] = newTemplate
 		return nil
 	})
 
-	return err
+	return pages, err
+}
+
+// definedTemplateNames returns the names of every template content defines, including
+// blocks and the file's own top-level template. Functions are not resolved, so no FuncMap
+// is needed.
+func definedTemplateNames(name, content string) ([]string, error) {
+	tree := parse.New(name)
+	tree.Mode = parse.SkipFuncCheck
+	trees := make(map[string]*parse.Tree)
+	if _, err := tree.Parse(content, "", "", trees); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(trees))
+	for n := range trees {
+		names = append(names, n)
+	}
+	slices.Sort(names)
+	return names, nil
 }
 
 // relPath returns the relative path from base to target using path (not filepath)
@@ -144,64 +329,285 @@ func relPath(base, target string) (string, error) {
 	return rel, nil
 }
 
-// getTemplateToRender returns the template, reloading all templates first if Reload is enabled
-func (tm *TemplateRegistry) getTemplateToRender(templatePath string) (*template.Template, error) {
+// getTemplateToRender returns the template, reloading all templates first if Reload is enabled.
+// A tenant overlay for templatePath takes precedence over the default template.
+// The returned bool reports whether a reload happened for this call.
+func (tm *TemplateRegistry) getTemplateToRender(templatePath, tenant string) (*template.Template, bool, error) {
 	if tm.options.Reload {
 		if err := tm.loadTemplates(); err != nil {
-			return nil, fmt.Errorf("reloading templates: %w", err)
+			return nil, false, fmt.Errorf("reloading templates: %w", err)
 		}
 	}
 
 	tm.mu.RLock()
 	defer tm.mu.RUnlock()
 
+	if overlay := tm.tenantTemplates[tenant][templatePath]; overlay != nil {
+		return overlay, tm.options.Reload, nil
+	}
+
 	tmpl := tm.storedTemplates[templatePath]
 	if tmpl == nil {
-		return nil, errors.New("couldn't find template: " + templatePath)
+		return nil, tm.options.Reload, errors.New("couldn't find template: " + templatePath)
 	}
-	return tmpl, nil
+	return tmpl, tm.options.Reload, nil
 }
 
-// usesBaseLayout returns true if the template defines a "content" block,
-// indicating it should be rendered via the base layout
-func usesBaseLayout(tmpl *template.Template) bool {
-	return tmpl.Lookup("content") != nil
+// usesBaseLayout returns true if the page renders nothing outside its {{define}} blocks,
+// indicating it only supplies blocks (content, title, ...) for the base layout. A page with
+// its own top-level markup is a standalone document and is rendered directly.
+//
+// This can't be decided by looking up "content": the base layout's own {{block "content"}}
+// default is present in every page's template set, overridden or not.
+func usesBaseLayout(tmpl *template.Template, templatePath string) bool {
+	page := tmpl.Lookup(templatePath)
+	if page == nil || page.Tree == nil {
+		return false
+	}
+	for _, node := range page.Tree.Root.Nodes {
+		text, ok := node.(*parse.TextNode)
+		if !ok || len(bytes.TrimSpace(text.Text)) > 0 {
+			return false
+		}
+	}
+	return true
 }
 
-type TemplateHandler func(http.ResponseWriter, *http.Request, *TemplateRenderer)
+// execName returns the template to execute for the page: the base layout if the page uses
+// it, otherwise the page itself.
+func (tm *TemplateRegistry) execName(tmpl *template.Template, templatePath string) string {
+	tm.mu.RLock()
+	baseExists := tm.baseExists
+	tm.mu.RUnlock()
+
+	if baseExists && usesBaseLayout(tmpl, templatePath) {
+		return tm.options.BaseTemplate
+	}
+	return templatePath
+}
+
+// checkUnusedBlocks applies the UnusedBlocks policy to blocks the page defines but that are
+// unreachable from the template actually executed, and so would be silently dropped.
+func (tm *TemplateRegistry) checkUnusedBlocks(tmpl *template.Template, templatePath string) error {
+	if tm.options.UnusedBlocks == "ignore" {
+		return nil
+	}
+
+	tm.mu.RLock()
+	includeNames := tm.includeNames
+	tm.mu.RUnlock()
+
+	reachable := make(map[string]bool)
+	collectReachableTemplates(tmpl, tm.execName(tmpl, templatePath), reachable)
+
+	var unused []string
+	for _, t := range tmpl.Templates() {
+		name := t.Name()
+		if name == templatePath || includeNames[name] || reachable[name] {
+			continue
+		}
+		unused = append(unused, name)
+	}
+	if len(unused) == 0 {
+		return nil
+	}
+
+	slices.Sort(unused)
+	err := fmt.Errorf("template %s defines blocks that are never rendered: %s", templatePath, strings.Join(unused, ", "))
+	if tm.options.UnusedBlocks == "error" {
+		return err
+	}
+	slog.Warn(err.Error())
+	return nil
+}
+
+// collectReachableTemplates records name and every template it invokes, transitively.
+func collectReachableTemplates(root *template.Template, name string, seen map[string]bool) {
+	if seen[name] {
+		return
+	}
+	seen[name] = true
+
+	t := root.Lookup(name)
+	if t == nil || t.Tree == nil {
+		return
+	}
+	var walk func(parse.Node)
+	walk = func(n parse.Node) {
+		switch node := n.(type) {
+		case *parse.TemplateNode:
+			collectReachableTemplates(root, node.Name, seen)
+		case *parse.ListNode:
+			if node == nil {
+				return
+			}
+			for _, child := range node.Nodes {
+				walk(child)
+			}
+		case *parse.IfNode:
+			walk(node.List)
+			walk(node.ElseList)
+		case *parse.RangeNode:
+			walk(node.List)
+			walk(node.ElseList)
+		case *parse.WithNode:
+			walk(node.List)
+			walk(node.ElseList)
+		}
+	}
+	walk(t.Tree.Root)
+}
+
+// AddSharedData registers providers that run, in the order added, each time a page or
+// the error page is rendered, merging their results into the data read with
+// SharedDataFunc. Keys are not merged any deeper: two providers returning the same key
+// for one request fail the render instead of silently overwriting each other, so give
+// each module its own key. Register providers at startup, before serving.
+//
+// Shared data is not part of the view model, so the validator ignores what templates
+// read from it; a missing key reads as nil.
+func (tm *TemplateRegistry) AddSharedData(providers ...SharedDataProvider) {
+	tm.providersMu.Lock()
+	defer tm.providersMu.Unlock()
+	tm.providers = append(tm.providers, providers...)
+}
+
+// sharedData runs the registered providers for r and merges their results.
+func (tm *TemplateRegistry) sharedData(r *http.Request) (map[string]any, error) {
+	tm.providersMu.RLock()
+	providers := tm.providers
+	tm.providersMu.RUnlock()
+
+	data := make(map[string]any, len(providers))
+	for _, provider := range providers {
+		key, value, err := provider(r)
+		if err != nil {
+			return nil, fmt.Errorf("shared data %q: %w", key, err)
+		}
+		if key == "" {
+			continue
+		}
+		if _, exists := data[key]; exists {
+			return nil, fmt.Errorf("shared data key %q is provided twice", key)
+		}
+		data[key] = value
+	}
+	return data, nil
+}
+
+func sharedDataFunc(data map[string]any) func(string) any {
+	return func(key string) any {
+		return data[key]
+	}
+}
+
+// TemplateHandler renders a page through te. A returned error is rendered with the
+// registry's error page (see RenderError).
+type TemplateHandler func(w http.ResponseWriter, r *http.Request, te *TemplateRenderer) error
+
+// ErrorViewModel is the view model of the error page.
+type ErrorViewModel struct {
+	Status  int
+	Title   string
+	Message string
+}
 
 func (tm *TemplateRegistry) buildRenderer(templatePath string, exampleModel any) *TemplateRenderer {
 	tm.mu.RLock()
 	tmpl := tm.storedTemplates[templatePath]
+	overlays := make(map[string]*template.Template)
+	for tenant, templates := range tm.tenantTemplates {
+		if overlay := templates[templatePath]; overlay != nil {
+			overlays[tenant] = overlay
+		}
+	}
 	tm.mu.RUnlock()
 
 	if tmpl == nil {
 		panic(errors.New("couldn't find template: " + templatePath))
 	}
 
+	if err := tm.checkUnusedBlocks(tmpl, templatePath); err != nil {
+		panic(err)
+	}
+	for _, overlay := range overlays {
+		if err := tm.checkUnusedBlocks(overlay, templatePath); err != nil {
+			panic(err)
+		}
+	}
+
+	// the model type never changes, so reflect it once and reuse the tree on every reload
+	var modelFields *templateField
 	if exampleModel != nil {
-		err := validateViewModelAllBlocks(exampleModel, tmpl, templatePath)
+		modelFields = extractFieldsFromData(exampleModel)
+		if err := tm.validateModelFields(modelFields, tmpl, templatePath); err != nil {
+			panic(err)
+		}
 
-		if err != nil {
-			panic(fmt.Errorf("couldn't validate view model for [%v]: %v", templatePath, err.Error()))
+		// every tenant overlay must accept the same view model as the default
+		for tenant, overlay := range overlays {
+			if err := tm.validateModelFields(modelFields, overlay, templatePath); err != nil {
+				panic(fmt.Errorf("tenant %v: %w", tenant, err))
+			}
 		}
 	}
 
-	return &TemplateRenderer{
+	renderer := &TemplateRenderer{
 		registry:         tm,
 		templateName:     templatePath,
 		baseTemplateName: tm.options.BaseTemplate,
+		modelFields:      modelFields,
+		exampleModel:     exampleModel,
 		Request:          nil, // will be set below in both handler functions right before execution
 	}
+	tm.renderersMu.Lock()
+	tm.renderers = append(tm.renderers, renderer)
+	tm.renderersMu.Unlock()
+	return renderer
+}
+
+// Warm renders every page built with BuildHandler or BuildSimpleHandler once with its
+// example model (nil for simple handlers), discarding the output, so the first real
+// request to each page doesn't pay for the initial execution and render-time errors (a
+// panicking method, a failing template func) surface at startup instead of in production.
+// r stands in for a visitor without a session: it supplies the context for request-scoped
+// template funcs, so give it what they need, e.g. the router via SetUrlFuncInContext.
+// Call it after registering all handlers and before serving; the returned error lists
+// every page that failed.
+func (tm *TemplateRegistry) Warm(r *http.Request) error {
+	tm.renderersMu.Lock()
+	renderers := slices.Clone(tm.renderers)
+	tm.renderersMu.Unlock()
+
+	var errs []error
+	for _, base := range renderers {
+		re := *base
+		re.Request = r
+		if err := re.render(discardResponseWriter{header: make(http.Header)}, http.StatusOK, re.exampleModel, layoutPage); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
 }
 
+// discardResponseWriter is the target of Warm, accepting and dropping the rendered page.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w discardResponseWriter) Header() http.Header         { return w.header }
+func (w discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w discardResponseWriter) WriteHeader(int)             {}
+
 func (tm *TemplateRegistry) BuildSimpleHandler(templatePath string, fn TemplateHandler) http.HandlerFunc {
 	base := tm.buildRenderer(templatePath, nil) // validates at startup; panics on field mismatch
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		re := *base // copy per request to avoid data race on Request field
 		re.Request = r
-		fn(w, r, &re)
+		if err := fn(w, r, &re); err != nil {
+			tm.RenderError(w, r, err)
+		}
 	}
 }
 
@@ -211,8 +617,130 @@ func (tm *TemplateRegistry) BuildHandler(templatePath string, exampleModel any,
 	return func(w http.ResponseWriter, r *http.Request) {
 		re := *base // copy per request to avoid data race on Request field
 		re.Request = r
-		fn(w, r, &re)
+		if err := fn(w, r, &re); err != nil {
+			tm.RenderError(w, r, err)
+		}
+	}
+}
+
+// Handle adapts fn into an http.HandlerFunc whose errors are rendered with the error page.
+func (tm *TemplateRegistry) Handle(fn HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := fn(w, r); err != nil {
+			tm.RenderError(w, r, err)
+		}
+	}
+}
+
+// RenderError logs err and renders the error page with the status derived from it (see
+// AsHTTPError). htmx requests get only the ErrorFragment block, so a failed partial update
+// shows a compact message in its target instead of a whole page. Falls back to a
+// plain-text response if there is no error page or it fails.
+func (tm *TemplateRegistry) RenderError(w http.ResponseWriter, r *http.Request, err error) {
+	httpErr := logHTTPError(r, err)
+	SetNoStore(w) // a page that opted into caching must not cache its error
+
+	tm.mu.RLock()
+	errorPage := tm.storedTemplates[tm.options.ErrorTemplate]
+	tm.mu.RUnlock()
+
+	if errorPage != nil && IsHTMX(r) && errorPage.Lookup(tm.options.ErrorFragment) != nil {
+		renderErr := tm.writeErrorFragment(w, r, httpErr)
+		if renderErr == nil {
+			return
+		}
+		GetLogger(r).Error("error fragment rendering failed", "template", tm.options.ErrorTemplate, "error", renderErr)
+	} else if errorPage != nil {
+		te := &TemplateRenderer{
+			registry:         tm,
+			templateName:     tm.options.ErrorTemplate,
+			baseTemplateName: tm.options.BaseTemplate,
+			Request:          r,
+		}
+		renderErr := te.WriteStatusTo(w, httpErr.Status, ErrorViewModel{
+			Status:  httpErr.Status,
+			Title:   http.StatusText(httpErr.Status),
+			Message: httpErr.Message,
+		})
+		if renderErr == nil {
+			return
+		}
+		GetLogger(r).Error("error page rendering failed", "template", tm.options.ErrorTemplate, "error", renderErr)
+	}
+
+	http.Error(w, httpErr.Message, httpErr.Status)
+}
+
+// writeErrorFragment writes the ErrorFragment block for httpErr, keeping its status. htmx
+// does not swap error responses by default, so HX-Reswap marks the body as meant to be
+// shown; the page opts in with an htmx:beforeSwap listener (see dashboard.html).
+func (tm *TemplateRegistry) writeErrorFragment(w http.ResponseWriter, r *http.Request, httpErr *HTTPError) error {
+	html, err := tm.RenderFragment(tm.options.ErrorTemplate, tm.options.ErrorFragment, ErrorViewModel{
+		Status:  httpErr.Status,
+		Title:   http.StatusText(httpErr.Status),
+		Message: httpErr.Message,
+	})
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("HX-Reswap", "innerHTML")
+	w.WriteHeader(httpErr.Status)
+	if _, err := io.WriteString(w, html); err != nil {
+		// the response is already committed, so there is nothing left to report to the client
+		GetLogger(r).Error("error fragment write failed", "template", tm.options.ErrorTemplate, "error", err)
+	}
+	return nil
+}
+
+// IsHTMX reports whether r was issued by htmx to update part of a page. Boosted requests
+// replace the whole body, so they are treated as regular page loads.
+func IsHTMX(r *http.Request) bool {
+	return r.Header.Get("HX-Request") == "true" && r.Header.Get("HX-Boosted") != "true"
+}
+
+// IsPartialRequest reports whether r is an htmx request, boosted ones included, that swaps
+// the page body into an existing layout and so needs only the content block. History
+// restores after a cache miss replace the whole document and get the full page. Boosted
+// links must target the content container (e.g. hx-target="main") for this to apply.
+func IsPartialRequest(r *http.Request) bool {
+	return r.Header.Get("HX-Request") == "true" && r.Header.Get("HX-History-Restore-Request") != "true"
+}
+
+// RenderFragment executes a single block of a page template (e.g. "row" defined in
+// "dashboard.html") with data and returns the HTML, for pushing partial updates over SSE
+// with WriteSSEEvent. Request-scoped template functions are not available to fragments.
+func (tm *TemplateRegistry) RenderFragment(templatePath, block string, data any) (string, error) {
+	tmpl, _, err := tm.getTemplateToRender(templatePath, "")
+	if err != nil {
+		return "", err
+	}
+
+	var buff bytes.Buffer
+	if err := executeBuffered(tmpl, &buff, block, data); err != nil {
+		return "", fmt.Errorf("executing fragment %s in %s: %w", block, templatePath, err)
+	}
+	return buff.String(), nil
+}
+
+// ValidateFragment checks that exampleModel matches the fields used by block in templatePath,
+// the same way BuildHandler validates whole pages. Call it at startup for each fragment.
+func (tm *TemplateRegistry) ValidateFragment(templatePath, block string, exampleModel any) error {
+	tm.mu.RLock()
+	tmpl := tm.storedTemplates[templatePath]
+	tm.mu.RUnlock()
+
+	if tmpl == nil {
+		return errors.New("couldn't find template: " + templatePath)
+	}
+	fragment := tmpl.Lookup(block)
+	if fragment == nil || fragment.Tree == nil {
+		return fmt.Errorf("template %s has no block %q", templatePath, block)
 	}
+
+	rootTemplateField := newTemplateField("Root")
+	extractFieldsFromTemplate(tmpl, fragment.Tree.Root, rootTemplateField)
+	return fieldMismatchError(fmt.Sprintf("template %s block %q", templatePath, block), rootTemplateField, extractFieldsFromData(exampleModel))
 }
 
 // -----------------------------------
@@ -221,80 +749,166 @@ type TemplateRenderer struct {
 	registry         *TemplateRegistry
 	templateName     string
 	baseTemplateName string
+	modelFields      *templateField // reflected view model; nil when the handler has no example model
+	exampleModel     any            // the model modelFields was reflected from, rendered by Warm
 	Request          *http.Request
 }
 
-func (te *TemplateRenderer) WriteTo(writer http.ResponseWriter, data any) {
-	tmpl, err := te.registry.getTemplateToRender(te.templateName)
+// renderLayout selects how much of a page using the base layout is rendered.
+type renderLayout int
+
+const (
+	layoutAuto    renderLayout = iota // decided per request by PartialRequest
+	layoutPage                        // the whole base layout
+	layoutContent                     // only ContentBlock
+)
+
+// WriteTo renders the page with data and writes it with status 200. Pages using the base
+// layout are rendered in full, or as only their content block when the PartialRequest
+// option says so (by default for htmx requests). Nothing is written if rendering fails;
+// the error is returned for the handler to report.
+func (te *TemplateRenderer) WriteTo(writer http.ResponseWriter, data any) error {
+	return te.WriteStatusTo(writer, http.StatusOK, data)
+}
+
+// WritePage is WriteTo, always rendering the full base layout.
+func (te *TemplateRenderer) WritePage(writer http.ResponseWriter, data any) error {
+	return te.render(writer, http.StatusOK, data, layoutPage)
+}
+
+// WriteContent is WriteTo, always rendering only the content block.
+func (te *TemplateRenderer) WriteContent(writer http.ResponseWriter, data any) error {
+	return te.render(writer, http.StatusOK, data, layoutContent)
+}
+
+// WriteStatusTo is WriteTo with the given status, e.g. for a 404 page or a form re-rendered
+// with 422. The page is rendered to a buffer first, so the status is only written once
+// rendering succeeded; on failure nothing is written and the handler can still report the
+// error with its own status.
+func (te *TemplateRenderer) WriteStatusTo(writer http.ResponseWriter, status int, data any) error {
+	return te.render(writer, status, data, layoutAuto)
+}
+
+func (te *TemplateRenderer) render(writer http.ResponseWriter, status int, data any, layout renderLayout) error {
+	start := time.Now()
+
+	tenant := ""
+	if te.registry.options.TenantFunc != nil {
+		tenant = te.registry.options.TenantFunc(te.Request)
+	}
+
+	tmpl, reloaded, err := te.registry.getTemplateToRender(te.templateName, tenant)
 	if err != nil {
-		slog.Error("template not found", "template", te.templateName, "error", err)
-		http.Error(writer, "Internal Server Error", http.StatusInternalServerError)
-		return
+		return fmt.Errorf("template %s not found: %w", te.templateName, err)
+	}
+
+	// Re-check reloaded templates against the cached model tree; only the templates changed
+	if reloaded && te.modelFields != nil {
+		if err := te.registry.validateModelFields(te.modelFields, tmpl, te.templateName); err != nil {
+			return err
+		}
+	}
+
+	shared, err := te.registry.sharedData(te.Request)
+	if err != nil {
+		return fmt.Errorf("rendering template %s: %w", te.templateName, err)
 	}
 
 	// Clone and add request-scoped funcs if provider exists
-	if te.registry.options.RequestFuncsProvider != nil {
+	if te.registry.options.RequestFuncsProvider != nil || len(shared) > 0 {
 		clonedTmpl, err := tmpl.Clone()
 		if err != nil {
-			slog.Error("cloning template failed", "template", te.templateName, "error", err)
-			http.Error(writer, "Internal Server Error", http.StatusInternalServerError)
-			return
+			return fmt.Errorf("cloning template %s: %w", te.templateName, err)
 		}
-		requestFuncs := te.registry.options.RequestFuncsProvider(te.Request)
-		clonedTmpl.Funcs(requestFuncs)
+		if te.registry.options.RequestFuncsProvider != nil {
+			clonedTmpl.Funcs(te.registry.options.RequestFuncsProvider(te.Request))
+		}
+		clonedTmpl.Funcs(template.FuncMap{SharedDataFunc: sharedDataFunc(shared)})
 		tmpl = clonedTmpl
 	}
 
-	// If template defines "content" block, render via base layout
-	// Otherwise render the page template directly
-	execName := te.templateName
-	if usesBaseLayout(tmpl) && te.registry.baseExists {
-		execName = te.baseTemplateName
+	// Pages that only define blocks render via the base layout, or just their content
+	// block for partial requests; others render directly
+	execName := te.registry.execName(tmpl, te.templateName)
+	if execName == te.baseTemplateName {
+		if layout == layoutAuto {
+			// the body depends on these headers, so caches must key on them
+			writer.Header().Add("Vary", "HX-Request, HX-History-Restore-Request")
+			if te.registry.options.PartialRequest(te.Request) {
+				layout = layoutContent
+			}
+		}
+		if layout == layoutContent {
+			execName = te.registry.options.ContentBlock
+		}
 	}
 
 	var buff bytes.Buffer
 
-	if err := tmpl.ExecuteTemplate(&buff, execName, data); err != nil {
-		slog.Error("template execution failed", "template", te.templateName, "error", err)
-		http.Error(writer, "Internal Server Error", http.StatusInternalServerError)
-		return
+	if err := executeBuffered(tmpl, &buff, execName, data); err != nil {
+		return fmt.Errorf("executing template %s: %w", te.templateName, err)
+	}
+
+	if te.registry.options.DevHeaders {
+		writer.Header().Set("X-Template-Reload", strconv.FormatBool(reloaded))
+		writer.Header().Set("X-Render-Time", time.Since(start).String())
 	}
 
+	if writer.Header().Get("Content-Type") == "" {
+		writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	writer.WriteHeader(status)
 	if _, err := writer.Write(buff.Bytes()); err != nil {
-		slog.Error("template write failed", "template", te.templateName, "error", err)
-		return
+		// the response is already committed, so there is nothing left to report to the client
+		GetLogger(te.Request).Error("template write failed", "template", te.templateName, "error", err)
 	}
+	return nil
 }
 
-// validateViewModelAllBlocks validates the data model against all blocks defined by the page template.
-// This catches fields used in any block (content, nav, head, title, etc.), not just "content".
-func validateViewModelAllBlocks(data interface{}, tmpl *template.Template, templatePath string) error {
-	// Collect all block names defined by this page template
-	blockNames := []string{templatePath}
-	knownBlocks := []string{"content", "nav", "head", "title"}
-	for _, name := range knownBlocks {
-		if t := tmpl.Lookup(name); t != nil {
-			blockNames = append(blockNames, name)
+// executeBuffered executes name into buff, converting a panic into an error. text/template
+// already recovers panics raised inside template funcs; this also covers anything it doesn't
+// (e.g. a panicking String or Error method on the data). Because output goes to a buffer,
+// a failed render never leaves a truncated page on the wire.
+func executeBuffered(tmpl *template.Template, buff *bytes.Buffer, name string, data any) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			buff.Reset()
+			err = fmt.Errorf("panic executing template %s: %v\n%s", name, p, debug.Stack())
 		}
-	}
+	}()
+	return tmpl.ExecuteTemplate(buff, name, data)
+}
 
-	// Extract fields used across all blocks
+// validateModelFields validates the reflected view model against everything the page
+// actually renders: the base layout (when used) with the page's block overrides and the
+// base's {{block}} defaults for blocks the page doesn't override, plus any templates they
+// invoke. Blocks that are never rendered are left to checkUnusedBlocks.
+func (tm *TemplateRegistry) validateModelFields(modelFields *templateField, tmpl *template.Template, templatePath string) error {
 	rootTemplateField := newTemplateField("Root")
-	for _, name := range blockNames {
-		block := tmpl.Lookup(name)
-		if block != nil && block.Tree != nil {
-			extractFieldsFromTemplate(tmpl, block.Tree.Root, rootTemplateField)
-		}
+	if root := tmpl.Lookup(tm.execName(tmpl, templatePath)); root != nil && root.Tree != nil {
+		extractFieldsFromTemplate(tmpl, root.Tree.Root, rootTemplateField)
 	}
+	return fieldMismatchError("template "+templatePath, rootTemplateField, modelFields)
+}
 
-	rootStructField := extractFieldsFromData(data)
+// fieldMismatchError reports the fields used by a template but absent from the model, and
+// vice versa, naming the template and the model's Go type so the message leads back to
+// both, e.g. "template dashboard.html: data controllers.DashboardViewModel missing fields
+// [Root->Roles]". Fields are sorted, so the message is stable.
+func fieldMismatchError(template string, rootTemplateField, rootStructField *templateField) error {
 	missing, extra := compareTemplateFields(rootTemplateField, rootStructField)
 
 	if len(extra) == 0 && len(missing) == 0 {
 		return nil
 	}
+	slices.Sort(missing)
+	slices.Sort(extra)
 
 	var sb strings.Builder
+	sb.WriteString(template)
+	sb.WriteString(": data ")
+	sb.WriteString(rootStructField.Type)
+	sb.WriteString(" ")
 	if len(extra) > 0 {
 		sb.WriteString("extra fields [")
 		sb.WriteString(strings.Join(extra, ", "))
@@ -305,12 +919,25 @@ func validateViewModelAllBlocks(data interface{}, tmpl *template.Template, templ
 		sb.WriteString(strings.Join(missing, ", "))
 		sb.WriteString("]")
 	}
-	return errors.New(sb.String())
+	return errors.New(strings.TrimSpace(sb.String()))
 }
 
 type templateField struct {
 	Name     string                    // Name of the field
 	Children map[string]*templateField // Nested fields (e.g., for structs or maps)
+	Type     string                    // Go type of the data, on the root of a reflected model only
+
+	// Indirect marks a model field holding a pointer, or a slice, array or map whose
+	// Children are the fields of its elements. Templates often use such a field whole, as
+	// in {{ if .User }} or {{ len .Items }}, so its children are only checked once the
+	// template reaches into it.
+	Indirect bool
+	// Opaque marks a model field whose type repeats an enclosing one (e.g. a tree node's
+	// children), left unexpanded so reflection terminates; it is not checked.
+	Opaque bool
+	// Optional marks a method of the model: templates may call it, but unlike a field it
+	// is not reported when unused, since most types have methods no template needs.
+	Optional bool
 }
 
 func newTemplateField(name string) *templateField {
@@ -329,85 +956,157 @@ func (tf *templateField) addChild(name string) *templateField {
 	return child
 }
 
+// addPath adds the chain of fields idents (e.g. ["User", "Name"]) below tf and returns
+// the last one.
+func (tf *templateField) addPath(idents []string) *templateField {
+	current := tf
+	for _, part := range idents {
+		current = current.addChild(part)
+	}
+	return current
+}
+
+// templateScope is what a template node's fields are relative to: dot, and the variables
+// in scope, "$" included, mapped to the field each was bound to.
+type templateScope struct {
+	dot  *templateField
+	vars map[string]*templateField
+}
+
+// with returns a scope with dot replaced and a copy of the variables, so variables
+// declared inside a control structure go out of scope at its end.
+func (s templateScope) with(dot *templateField) templateScope {
+	vars := make(map[string]*templateField, len(s.vars))
+	for name, field := range s.vars {
+		vars[name] = field
+	}
+	return templateScope{dot: dot, vars: vars}
+}
+
 func extractFieldsFromTemplate(root *template.Template, n parse.Node, parentField *templateField) {
+	extractFields(root, n, templateScope{dot: parentField, vars: map[string]*templateField{"$": parentField}})
+}
+
+func extractFields(root *template.Template, n parse.Node, scope templateScope) {
 	switch node := n.(type) {
 	case *parse.PipeNode:
 		for _, cmd := range node.Cmds {
 			for _, arg := range cmd.Args {
-				if field, ok := arg.(*parse.FieldNode); ok {
-					// Add the field to the parent field's children
-					fieldParts := field.Ident
-					current := parentField
-					for _, part := range fieldParts {
-						current = current.addChild(part)
-					}
-				}
+				argField(arg, scope)
 			}
 		}
-	case *parse.ActionNode:
-		for _, cmd := range node.Pipe.Cmds {
-			for _, arg := range cmd.Args {
-				if field, ok := arg.(*parse.FieldNode); ok {
-					// Add the field to the parent field's children
-					fieldParts := field.Ident
-					current := parentField
-					for _, part := range fieldParts {
-						current = current.addChild(part)
-					}
-				}
+		// {{ $user := .User }} binds $user to the field for later use
+		if len(node.Decl) == 1 {
+			if field := pipeField(node, scope); field != nil {
+				scope.vars[node.Decl[0].Ident[0]] = field
 			}
 		}
+	case *parse.ActionNode:
+		extractFields(root, node.Pipe, scope)
 	case *parse.TemplateNode:
 		// Handle included templates ({{ template "name" .Field }})
+		dot := scope.dot // if no specific argument is passed, inherit from the parent
 		if node.Pipe != nil {
+			dot = nil
 			for _, cmd := range node.Pipe.Cmds {
 				for _, arg := range cmd.Args {
-					if field, ok := arg.(*parse.FieldNode); ok {
-						// Locate the parent for the included template's fields
-						fieldParts := field.Ident
-						current := parentField
-						for _, part := range fieldParts {
-							current = current.addChild(part)
-						}
-						// Recursively extract fields from the included template under this parent
-						if tmpl := root.Lookup(node.Name); tmpl != nil && tmpl.Tree != nil {
-							extractFieldsFromTemplate(root, tmpl.Tree.Root, current)
-						}
-					} else if _, ok := arg.(*parse.DotNode); ok {
-						// Recursively extract fields from the included template under this parent
-						if tmpl := root.Lookup(node.Name); tmpl != nil && tmpl.Tree != nil {
-							extractFieldsFromTemplate(root, tmpl.Tree.Root, parentField)
-						}
+					if field := argField(arg, scope); field != nil {
+						dot = field
 					}
 				}
 			}
-		} else {
-			// If no specific argument is passed, inherit from the parent
-			if tmpl := root.Lookup(node.Name); tmpl != nil && tmpl.Tree != nil {
-				extractFieldsFromTemplate(root, tmpl.Tree.Root, parentField)
-			}
+		}
+		// Recursively extract fields from the included template under its argument
+		if tmpl := root.Lookup(node.Name); dot != nil && tmpl != nil && tmpl.Tree != nil {
+			extractFieldsFromTemplate(root, tmpl.Tree.Root, dot)
 		}
 	case *parse.ListNode:
 		for _, child := range node.Nodes {
-			extractFieldsFromTemplate(root, child, parentField)
+			extractFields(root, child, scope)
 		}
 	case *parse.IfNode:
-		extractFieldsFromTemplate(root, node.List, parentField)
+		extractFields(root, node.Pipe, scope)
+		extractFields(root, node.List, scope.with(scope.dot))
 		if node.ElseList != nil {
-			extractFieldsFromTemplate(root, node.ElseList, parentField)
+			extractFields(root, node.ElseList, scope.with(scope.dot))
 		}
 	case *parse.RangeNode:
-		extractFieldsFromTemplate(root, node.Pipe, parentField)
+		extractFields(root, node.Pipe, scope.with(scope.dot))
+		// inside, dot and the element variable are the ranged collection's elements,
+		// whose fields the model lists under the collection itself
+		if collection := pipeField(node.Pipe, scope); collection != nil {
+			body := scope.with(collection)
+			if decl := node.Pipe.Decl; len(decl) > 0 {
+				body.vars[decl[len(decl)-1].Ident[0]] = collection
+				if len(decl) == 2 {
+					delete(body.vars, decl[0].Ident[0]) // the index or key has no fields
+				}
+			}
+			extractFields(root, node.List, body)
+		}
+		if node.ElseList != nil {
+			extractFields(root, node.ElseList, scope.with(scope.dot))
+		}
 	case *parse.WithNode:
-		extractFieldsFromTemplate(root, node.List, parentField)
+		if readsSharedData(node.Pipe) {
+			// dot is shared data inside, not the view model
+			if node.ElseList != nil {
+				extractFields(root, node.ElseList, scope.with(scope.dot))
+			}
+			return
+		}
+		extractFields(root, node.List, scope.with(scope.dot))
 	}
 }
 
+// argField records the fields a command argument reads and returns the field it
+// evaluates to: .A.B and $x.A.B name a field, dot and $x the field they are bound to.
+// Anything else, e.g. a function call, returns nil.
+func argField(arg parse.Node, scope templateScope) *templateField {
+	switch arg := arg.(type) {
+	case *parse.FieldNode:
+		return scope.dot.addPath(arg.Ident)
+	case *parse.VariableNode:
+		if field := scope.vars[arg.Ident[0]]; field != nil {
+			return field.addPath(arg.Ident[1:])
+		}
+	case *parse.DotNode:
+		return scope.dot
+	case *parse.PipeNode:
+		for _, cmd := range arg.Cmds {
+			for _, a := range cmd.Args {
+				argField(a, scope)
+			}
+		}
+	}
+	return nil
+}
+
+// pipeField returns the field pipe evaluates to when it is a lone field, variable or dot,
+// as in {{ range .Items }}, or nil when its value is not a known field.
+func pipeField(pipe *parse.PipeNode, scope templateScope) *templateField {
+	if pipe == nil || len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return nil
+	}
+	return argField(pipe.Cmds[0].Args[0], scope)
+}
+
+// readsSharedData reports whether pipe's value comes from SharedDataFunc.
+func readsSharedData(pipe *parse.PipeNode) bool {
+	if pipe == nil || len(pipe.Cmds) == 0 || len(pipe.Cmds[0].Args) == 0 {
+		return false
+	}
+	ident, ok := pipe.Cmds[0].Args[0].(*parse.IdentifierNode)
+	return ok && ident.Ident == SharedDataFunc
+}
+
 func extractFieldsFromData(v any) *templateField {
 	root := newTemplateField("Root")
 	if v == nil {
+		root.Type = "nil"
 		return root // empty field set - will report missing fields if template expects data
 	}
+	root.Type = reflect.TypeOf(v).String()
 
 	val := reflect.ValueOf(v)
 	typ := val.Type()
@@ -424,39 +1123,104 @@ func extractFieldsFromData(v any) *templateField {
 			child := root.addChild(name)
 			elem := val.MapIndex(key)
 			if elem.IsValid() && elem.CanInterface() {
-				extractFieldHelper(reflect.TypeOf(elem.Interface()), child)
+				extractFieldHelper(reflect.TypeOf(elem.Interface()), child, nil)
 			}
 		}
 	case reflect.Struct:
-		extractFieldHelper(typ, root)
+		extractFieldHelper(typ, root, nil)
 	}
 
 	return root
 }
 
-func extractFieldHelper(typ reflect.Type, parentField *templateField) {
-	if typ.Kind() == reflect.Ptr {
+// extractFieldHelper adds the exported fields of struct type typ below parentField, and
+// those of the struct elements of slice, array and map fields below the collection.
+// Exported methods, value and pointer receivers alike, are added as optional children.
+// enclosing holds the types being expanded, to stop at recursive types.
+func extractFieldHelper(typ reflect.Type, parentField *templateField, enclosing []reflect.Type) {
+	if typ == nil { // a nil interface value in a map model
+		return
+	}
+	switch typ.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		parentField.Indirect = true
+		typ = elementType(typ)
+	case reflect.Ptr:
+		parentField.Indirect = true
 		typ = typ.Elem()
 	}
 
-	if typ.Kind() != reflect.Struct {
+	if slices.Contains(enclosing, typ) {
+		parentField.Opaque = true
 		return
 	}
+	enclosing = append(enclosing, typ)
 
-	for i := 0; i < typ.NumField(); i++ {
-		field := typ.Field(i)
+	if typ.Kind() == reflect.Struct {
+		extractStructFields(typ, parentField, enclosing)
+	}
+	extractMethods(typ, parentField, enclosing)
+}
+
+// extractStructFields adds the fields of typ as templates resolve them: the fields of
+// embedded structs are promoted, unless a shallower field of the same name shadows them
+// or two at the same depth make the name ambiguous, just as in Go.
+func extractStructFields(typ reflect.Type, parentField *templateField, enclosing []reflect.Type) {
+	for _, field := range reflect.VisibleFields(typ) {
 		if field.PkgPath != "" { // Skip unexported fields
 			continue
 		}
 
 		child := parentField.addChild(field.Name)
-		if field.Type.Kind() == reflect.Struct {
-			extractFieldHelper(field.Type, child)
+		if field.Anonymous {
+			// the embedded value itself is reachable by its type name, but its fields are
+			// normally used through promotion
+			child.Optional = true
+		}
+		extractFieldHelper(field.Type, child, enclosing)
+	}
+}
+
+// extractMethods adds the exported methods of typ that no field shadows. The result of
+// one taking no arguments, like {{ .Author.Name }} for Author() User, is expanded as a
+// field of its type would be; methods taking arguments are leaves.
+func extractMethods(typ reflect.Type, parentField *templateField, enclosing []reflect.Type) {
+	methods, receiver := reflect.PointerTo(typ), 1
+	if typ.Kind() == reflect.Interface {
+		methods, receiver = typ, 0
+	}
+
+	for i := 0; i < methods.NumMethod(); i++ {
+		method := methods.Method(i)
+		if _, shadowed := parentField.Children[method.Name]; shadowed {
+			continue
+		}
+
+		child := parentField.addChild(method.Name)
+		child.Optional = true
+		if method.Type.NumIn() == receiver && method.Type.NumOut() > 0 {
+			extractFieldHelper(method.Type.Out(0), child, enclosing)
+		}
+	}
+}
+
+// elementType returns the type range yields for a collection of typ, through nested
+// collections and pointers, e.g. Item for [][]*Item.
+func elementType(typ reflect.Type) reflect.Type {
+	for {
+		switch typ.Kind() {
+		case reflect.Slice, reflect.Array, reflect.Map, reflect.Ptr:
+			typ = typ.Elem()
+		default:
+			return typ
 		}
 	}
 }
 
 func compareTemplateFields(templateField, structField *templateField) (missing []string, extra []string) {
+	if structField.Opaque || structField.Indirect && len(templateField.Children) == 0 {
+		return nil, nil
+	}
 	for name, child := range templateField.Children {
 		if _, ok := structField.Children[name]; !ok {
 			missing = append(missing, structField.Name+"->"+name)
@@ -466,8 +1230,8 @@ func compareTemplateFields(templateField, structField *templateField) (missing [
 			extra = append(extra, e...)
 		}
 	}
-	for name := range structField.Children {
-		if _, ok := templateField.Children[name]; !ok {
+	for name, child := range structField.Children {
+		if _, ok := templateField.Children[name]; !ok && !child.Optional {
 			extra = append(extra, templateField.Name+"->"+name)
 		}
 	}
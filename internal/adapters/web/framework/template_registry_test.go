@@ -0,0 +1,548 @@
+package framework
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/antonkarounis/stoic/internal/domain/ports"
+)
+
+// testBase is a base layout with a title and a content block for pages to fill.
+const testBase = `<html><title>{{ block "title" . }}stoic{{ end }}</title><main>{{ block "content" . }}{{ end }}</main></html>`
+
+// newTestRegistry returns a registry over files, with pages in "pages" and includes,
+// testBase among them unless files has its own, in "includes". configure adjusts the
+// options first.
+func newTestRegistry(tb testing.TB, files map[string]string, configure func(*TemplateRegistryOptions)) *TemplateRegistry {
+	tb.Helper()
+	fsys := fstest.MapFS{"includes/base.html": {Data: []byte(testBase)}}
+	for name, content := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+	opts := TemplateRegistryOptions{FS: fsys, RootDir: "pages", IncludeDir: "includes"}
+	if configure != nil {
+		configure(&opts)
+	}
+	tm, err := NewTemplateRegistry(opts)
+	if err != nil {
+		tb.Fatalf("NewTemplateRegistry: %v", err)
+	}
+	return tm
+}
+
+type benchAuthor struct {
+	Name  string
+	Email string
+}
+
+type benchComment struct {
+	Author benchAuthor
+	Body   string
+}
+
+type benchPost struct {
+	Title    string
+	Author   benchAuthor
+	Tags     []string
+	Comments []benchComment
+}
+
+type benchPage struct {
+	Heading string
+	Posts   []benchPost
+	Footer  struct {
+		Copyright string
+		Links     []struct{ Href, Text string }
+	}
+}
+
+// BenchmarkRender measures a dev-mode render, where templates are reloaded and checked
+// against the model on every request, for a model with many nested fields.
+func BenchmarkRender(b *testing.B) {
+	tm := newTestRegistry(b, map[string]string{
+		"pages/posts.html": `{{ define "content" }}<h1>{{ .Heading }}</h1>
+{{ range .Posts }}<h2>{{ .Title }} by {{ .Author.Name }} ({{ .Author.Email }})</h2>
+{{ range .Tags }}<span>{{ . }}</span>{{ end }}
+{{ range .Comments }}<p>{{ .Author.Name }} {{ .Author.Email }}: {{ .Body }}</p>{{ end }}{{ end }}
+<footer>{{ .Footer.Copyright }}{{ range .Footer.Links }}<a href="{{ .Href }}">{{ .Text }}</a>{{ end }}</footer>{{ end }}`,
+	}, func(opts *TemplateRegistryOptions) { opts.Reload = true })
+
+	model := benchPage{Heading: "Posts"}
+	for i := range 20 {
+		post := benchPost{Title: fmt.Sprint("post ", i), Author: benchAuthor{"alice", "alice@example.com"}, Tags: []string{"go", "htmx"}}
+		for range 5 {
+			post.Comments = append(post.Comments, benchComment{Author: benchAuthor{"bob", "bob@example.com"}, Body: "nice"})
+		}
+		model.Posts = append(model.Posts, post)
+	}
+	handler := tm.BuildHandler("posts.html", benchPage{}, func(w http.ResponseWriter, r *http.Request, te *TemplateRenderer) error {
+		return te.WriteTo(w, model)
+	})
+	r := httptest.NewRequest(http.MethodGet, "/posts", nil)
+
+	for b.Loop() {
+		rec := httptest.NewRecorder()
+		handler(rec, r)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "post 19") {
+			b.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestPanickingTemplateFuncRendersCleanError(t *testing.T) {
+	tm := newTestRegistry(t, map[string]string{
+		"pages/home.html": `{{ define "content" }}<p>before</p>{{ boom }}<p>after</p>{{ end }}`,
+	}, func(opts *TemplateRegistryOptions) {
+		opts.FuncMap = map[string]any{"boom": func() string { panic("bug in boom") }}
+	})
+	handler := tm.BuildSimpleHandler("home.html", func(w http.ResponseWriter, r *http.Request, te *TemplateRenderer) error {
+		return te.WriteTo(w, nil)
+	})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if body := rec.Body.String(); strings.Contains(body, "before") {
+		t.Errorf("partial page written: %q", body)
+	}
+}
+
+func TestPartialRendering(t *testing.T) {
+	const page = `{{ define "content" }}<p>{{ .Message }}</p>{{ end }}`
+	const full = `<html><title>stoic</title><main><p>hi</p></main></html>`
+	const content = `<p>hi</p>`
+	model := struct{ Message string }{"hi"}
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		partial  func(*http.Request) bool // PartialRequest option; nil uses the default
+		write    func(te *TemplateRenderer, w http.ResponseWriter) error
+		want     string
+		wantVary bool
+	}{
+		{"first load", nil, nil, nil, full, true},
+		{"htmx request", map[string]string{"HX-Request": "true"}, nil, nil, content, true},
+		{"boosted request", map[string]string{"HX-Request": "true", "HX-Boosted": "true"}, nil, nil, content, true},
+		{"history restore", map[string]string{"HX-Request": "true", "HX-History-Restore-Request": "true"}, nil, nil, full, true},
+		{"partials disabled", map[string]string{"HX-Request": "true"}, func(*http.Request) bool { return false }, nil, full, true},
+		{"handler forces the page", map[string]string{"HX-Request": "true"}, nil, func(te *TemplateRenderer, w http.ResponseWriter) error {
+			return te.WritePage(w, model)
+		}, full, false},
+		{"handler forces the content", nil, nil, func(te *TemplateRenderer, w http.ResponseWriter) error {
+			return te.WriteContent(w, model)
+		}, content, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm := newTestRegistry(t, map[string]string{"pages/home.html": page}, func(opts *TemplateRegistryOptions) {
+				opts.PartialRequest = tt.partial
+			})
+			write := tt.write
+			if write == nil {
+				write = func(te *TemplateRenderer, w http.ResponseWriter) error { return te.WriteTo(w, model) }
+			}
+			handler := tm.BuildHandler("home.html", model, func(w http.ResponseWriter, r *http.Request, te *TemplateRenderer) error {
+				return write(te, w)
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, r)
+
+			if got := rec.Body.String(); got != tt.want {
+				t.Errorf("body = %q, want %q", got, tt.want)
+			}
+			if vary := rec.Header().Get("Vary") != ""; vary != tt.wantVary {
+				t.Errorf("Vary set = %v, want %v", vary, tt.wantVary)
+			}
+		})
+	}
+}
+
+func TestStandalonePageIgnoresPartialRequests(t *testing.T) {
+	tm := newTestRegistry(t, map[string]string{"pages/plain.html": `<p>standalone</p>`}, nil)
+	handler := tm.BuildSimpleHandler("plain.html", func(w http.ResponseWriter, r *http.Request, te *TemplateRenderer) error {
+		return te.WriteTo(w, nil)
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("HX-Request", "true")
+	rec := httptest.NewRecorder()
+	handler(rec, r)
+
+	if got := rec.Body.String(); got != `<p>standalone</p>` {
+		t.Errorf("body = %q, want the page itself", got)
+	}
+}
+
+// modelMismatch builds a handler for a page with content as its content block and model
+// as its example, and returns the error the view-model check panics with, or nil.
+func modelMismatch(t *testing.T, content string, model any) (err error) {
+	t.Helper()
+	tm := newTestRegistry(t, map[string]string{"pages/page.html": `{{ define "content" }}` + content + `{{ end }}`}, nil)
+	defer func() {
+		if p := recover(); p != nil {
+			var ok bool
+			if err, ok = p.(error); !ok {
+				t.Fatalf("panicked with %v, want an error", p)
+			}
+		}
+	}()
+	tm.BuildHandler("page.html", model, func(w http.ResponseWriter, r *http.Request, te *TemplateRenderer) error { return nil })
+	return nil
+}
+
+// checkModelMismatch fails t unless err is nil when wantErr is "", or contains wantErr.
+func checkModelMismatch(t *testing.T, err error, wantErr string) {
+	t.Helper()
+	if wantErr == "" {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		return
+	}
+	if err == nil || !strings.Contains(err.Error(), wantErr) {
+		t.Errorf("err = %v, want one with %q", err, wantErr)
+	}
+}
+
+type lineItem struct {
+	Name  string
+	Price int
+}
+
+func TestRangeElementFieldsAreChecked(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		model   any
+		wantErr string // "" expects no error
+	}{
+		{"slice of structs", `{{ range .Items }}{{ .Name }} {{ .Price }}{{ end }}`, struct{ Items []lineItem }{}, ""},
+		{"missing field of a slice element", `{{ range .Items }}{{ .Name }} {{ .Price }} {{ .SKU }}{{ end }}`, struct{ Items []lineItem }{}, "missing fields [Items->SKU]"},
+		{"missing field of a pointer element", `{{ range .Items }}{{ .Name }} {{ .Price }} {{ .SKU }}{{ end }}`, struct{ Items []*lineItem }{}, "missing fields [Items->SKU]"},
+		{"missing field of an array element", `{{ range .Items }}{{ .Name }} {{ .Price }} {{ .SKU }}{{ end }}`, struct{ Items [2]lineItem }{}, "missing fields [Items->SKU]"},
+		{"missing field of a map value", `{{ range $k, $v := .Items }}{{ $k }} {{ $v.Name }} {{ $v.Price }} {{ $v.SKU }}{{ end }}`, struct{ Items map[string]lineItem }{}, "missing fields [Items->SKU]"},
+		{"element field unused", `{{ range .Items }}{{ .Name }}{{ end }}`, struct{ Items []lineItem }{}, "extra fields [Items->Price]"},
+		{"collection used whole", `{{ len .Items }}`, struct{ Items []lineItem }{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkModelMismatch(t, modelMismatch(t, tt.content, tt.model), tt.wantErr)
+		})
+	}
+}
+
+type person struct {
+	First string
+	Last  string
+}
+
+func (p person) FullName() string       { return p.First + " " + p.Last }
+func (p *person) Initials() string      { return p.First[:1] + p.Last[:1] }
+func (p person) Greeting(string) string { return "hi" }
+
+func TestModelMethodsAreAccepted(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		model   any
+		wantErr string // "" expects no error
+	}{
+		{"value receiver", `{{ .First }} {{ .Last }} {{ .FullName }}`, person{}, ""},
+		{"pointer receiver on a pointer model", `{{ .First }} {{ .Last }} {{ .Initials }}`, &person{}, ""},
+		{"method with arguments", `{{ .First }} {{ .Last }} {{ .Greeting "x" }}`, person{}, ""},
+		{"method of a nested field", `{{ .Author.First }} {{ .Author.Last }} {{ .Author.FullName }}`, struct{ Author person }{}, ""},
+		{"unused methods are not extra", `{{ .First }} {{ .Last }}`, person{}, ""},
+		{"unknown name still missing", `{{ .First }} {{ .Last }} {{ .NickName }}`, person{}, "missing fields [Root->NickName]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkModelMismatch(t, modelMismatch(t, tt.content, tt.model), tt.wantErr)
+		})
+	}
+}
+
+const testErrorPage = `{{ define "title" }}{{ .Title }}{{ end }}{{ define "content" }}<h1>{{ .Status }}</h1><p>{{ .Message }}</p>{{ end }}` +
+	`{{ define "error_fragment" }}<p class="error" title="{{ .Status }} {{ .Title }}">{{ .Message }}</p>{{ end }}`
+
+func TestErrorPageStatus(t *testing.T) {
+	tm := newTestRegistry(t, map[string]string{
+		"pages/error.html": testErrorPage,
+		"pages/home.html":  `{{ define "content" }}home{{ end }}`,
+	}, nil)
+
+	tests := []struct {
+		name     string
+		err      error
+		htmx     bool
+		want     int
+		wantBody string
+	}{
+		{"not found", NotFound(), false, http.StatusNotFound, "<h1>404</h1><p>Not Found</p>"},
+		{"forbidden", Forbidden(), false, http.StatusForbidden, "<h1>403</h1>"},
+		{"bad request", BadRequest("name is required"), false, http.StatusBadRequest, "<p>name is required</p>"},
+		{"domain error", fmt.Errorf("loading post: %w", ports.ErrNotFound), false, http.StatusNotFound, "<h1>404</h1>"},
+		{"unexpected error", errors.New("boom"), false, http.StatusInternalServerError, "<h1>500</h1>"},
+		{"htmx request", NotFound(), true, http.StatusNotFound, `<p class="error" title="404 Not Found">Not Found</p>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := tm.BuildSimpleHandler("home.html", func(w http.ResponseWriter, r *http.Request, te *TemplateRenderer) error {
+				return tt.err
+			})
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.htmx {
+				r.Header.Set("HX-Request", "true")
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, r)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if body := rec.Body.String(); !strings.Contains(body, tt.wantBody) {
+				t.Errorf("body = %q, want it to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestWriteStatusTo(t *testing.T) {
+	tm := newTestRegistry(t, map[string]string{
+		"pages/error.html": testErrorPage,
+		"pages/form.html":  `{{ define "content" }}<p>{{ .Problem }}</p>{{ end }}`,
+	}, nil)
+
+	handler := tm.BuildSimpleHandler("form.html", func(w http.ResponseWriter, r *http.Request, te *TemplateRenderer) error {
+		return te.WriteStatusTo(w, http.StatusUnprocessableEntity, struct{ Problem string }{"too short"})
+	})
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "<p>too short</p>") {
+		t.Errorf("got %d %q, want the page with 422", rec.Code, rec.Body)
+	}
+
+	// a page that fails to render writes nothing, leaving the error page to set the status
+	handler = tm.BuildSimpleHandler("form.html", func(w http.ResponseWriter, r *http.Request, te *TemplateRenderer) error {
+		return te.WriteStatusTo(w, http.StatusUnprocessableEntity, 42)
+	})
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "<h1>500</h1>") {
+		t.Errorf("got %d %q, want the 500 error page", rec.Code, rec.Body)
+	}
+}
+
+type timestamps struct {
+	CreatedAt string
+	UpdatedAt string
+}
+
+type auditInfo struct {
+	UpdatedAt string
+	By        string
+}
+
+func TestEmbeddedFieldsArePromoted(t *testing.T) {
+	type article struct {
+		timestamps
+		Title string
+	}
+	type pointerEmbed struct {
+		*timestamps
+		Title string
+	}
+	type shadowed struct {
+		timestamps
+		CreatedAt int // shadows timestamps.CreatedAt
+	}
+	type ambiguous struct {
+		timestamps
+		auditInfo
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		model   any
+		wantErr string // "" expects no error
+	}{
+		{"promoted fields", `{{ .Title }} {{ .CreatedAt }} {{ .UpdatedAt }}`, article{}, ""},
+		{"promoted through a pointer", `{{ .Title }} {{ .CreatedAt }} {{ .UpdatedAt }}`, pointerEmbed{}, ""},
+		{"unused promoted field", `{{ .Title }} {{ .CreatedAt }}`, article{}, "extra fields [Root->UpdatedAt]"},
+		{"shadowing field", `{{ .CreatedAt }} {{ .UpdatedAt }}`, shadowed{}, ""},
+		{"ambiguous name", `{{ .CreatedAt }} {{ .By }} {{ .UpdatedAt }}`, ambiguous{}, "missing fields [Root->UpdatedAt]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkModelMismatch(t, modelMismatch(t, tt.content, tt.model), tt.wantErr)
+		})
+	}
+}
+
+func TestModelMismatchMessage(t *testing.T) {
+	type dashboard struct {
+		Zeta  string
+		Alpha string
+		Title string
+	}
+	tests := []struct {
+		name    string
+		content string
+		model   any
+		want    string
+	}{
+		{"missing and extra, sorted", `{{ .Title }} {{ .Roles }} {{ .Beta }}`, dashboard{},
+			"template page.html: data framework.dashboard extra fields [Root->Alpha, Root->Zeta] missing fields [Root->Beta, Root->Roles]"},
+		{"missing only, pointer model", `{{ .Alpha }} {{ .Title }} {{ .Zeta }} {{ .Roles }}`, &dashboard{},
+			"template page.html: data *framework.dashboard missing fields [Root->Roles]"},
+		{"extra only", `{{ .Alpha }} {{ .Zeta }}`, dashboard{},
+			"template page.html: data framework.dashboard extra fields [Root->Title]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := modelMismatch(t, tt.content, tt.model)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("err = %v\nwant %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBaseBlockDefaults(t *testing.T) {
+	const base = `<html><title>{{ block "title" . }}{{ .SiteName }}{{ end }}</title><main>{{ block "content" . }}{{ end }}</main></html>`
+	type site struct {
+		SiteName string
+		Body     string
+	}
+
+	tests := []struct {
+		name    string
+		page    string
+		model   any
+		want    string // rendered with site{"stoic", "hi"} unless wantErr is set
+		wantErr string
+	}{
+		{"default renders", `{{ define "content" }}{{ .Body }}{{ end }}`, site{},
+			`<html><title>stoic</title><main>hi</main></html>`, ""},
+		{"default is validated", `{{ define "content" }}{{ .Body }}{{ end }}`, struct{ Body string }{},
+			"", "missing fields [Root->SiteName]"},
+		{"override replaces the default", `{{ define "title" }}Home{{ end }}{{ define "content" }}{{ .Body }}{{ end }}`, struct{ Body string }{},
+			`<html><title>Home</title><main>hi</main></html>`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm := newTestRegistry(t, map[string]string{"includes/base.html": base, "pages/page.html": tt.page}, nil)
+			var handler http.HandlerFunc
+			err := func() (err error) {
+				defer func() {
+					if p := recover(); p != nil {
+						err = fmt.Errorf("%v", p)
+					}
+				}()
+				handler = tm.BuildHandler("page.html", tt.model, func(w http.ResponseWriter, r *http.Request, te *TemplateRenderer) error {
+					return te.WriteTo(w, site{"stoic", "hi"})
+				})
+				return nil
+			}()
+			checkModelMismatch(t, err, tt.wantErr)
+			if err != nil || tt.wantErr != "" {
+				return
+			}
+
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			if got := rec.Body.String(); got != tt.want {
+				t.Errorf("body = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnusedBlocks(t *testing.T) {
+	tests := []struct {
+		name     string
+		page     string
+		policy   string
+		wantErr  bool
+		wantWarn bool
+	}{
+		{"block the base never renders, warn", `{{ define "content" }}hi{{ end }}{{ define "sidebar" }}nav{{ end }}`, "", false, true},
+		{"block the base never renders, error", `{{ define "content" }}hi{{ end }}{{ define "sidebar" }}nav{{ end }}`, "error", true, false},
+		{"block the base never renders, ignore", `{{ define "content" }}hi{{ end }}{{ define "sidebar" }}nav{{ end }}`, "ignore", false, false},
+		{"block invoked by a rendered one", `{{ define "content" }}{{ template "item" . }}{{ end }}{{ define "item" }}hi{{ end }}`, "error", false, false},
+		{"block of a standalone page", `<p>{{ template "item" . }}</p>{{ define "item" }}hi{{ end }}{{ define "unused" }}{{ end }}`, "error", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			prev := slog.Default()
+			slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+			t.Cleanup(func() { slog.SetDefault(prev) })
+
+			tm := newTestRegistry(t, map[string]string{"pages/page.html": tt.page}, func(opts *TemplateRegistryOptions) {
+				opts.UnusedBlocks = tt.policy
+			})
+			var err error
+			func() {
+				defer func() {
+					if p := recover(); p != nil {
+						err = fmt.Errorf("%v", p)
+					}
+				}()
+				tm.BuildSimpleHandler("page.html", func(w http.ResponseWriter, r *http.Request, te *TemplateRenderer) error { return nil })
+			}()
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "never rendered") {
+				t.Errorf("err = %v, want the unused blocks named", err)
+			}
+			if warned := strings.Contains(logs.String(), "never rendered"); warned != tt.wantWarn {
+				t.Errorf("warned = %v, want %v: %s", warned, tt.wantWarn, logs.String())
+			}
+		})
+	}
+}
+
+func TestUsesBaseLayout(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+		want bool
+	}{
+		{"blocks only", `{{ define "title" }}Home{{ end }}{{ define "content" }}hi{{ end }}`, true},
+		{"blocks between whitespace and comments", "\n{{/* home */}}\n  {{ define \"content\" }}hi{{ end }}\n", true},
+		{"top-level markup", `<!DOCTYPE html><html>{{ define "content" }}hi{{ end }}</html>`, false},
+		{"top-level action", `{{ template "content" . }}{{ define "content" }}hi{{ end }}`, false},
+		{"no blocks at all", `<p>standalone</p>`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := template.New("page.html").Parse(tt.page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := usesBaseLayout(tmpl, "page.html"); got != tt.want {
+				t.Errorf("usesBaseLayout = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
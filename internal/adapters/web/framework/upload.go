@@ -0,0 +1,250 @@
+package framework
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/antonkarounis/stoic/internal/domain/ports"
+)
+
+const (
+	defaultUploadMaxBytes  = 10 << 20
+	defaultUploadMaxMemory = 1 << 20
+	defaultUploadMaxFiles  = 1
+	maxUploadNameBytes     = 255
+)
+
+// UploadOptions configures ParseUpload.
+type UploadOptions struct {
+	Field     string // form field holding the files; empty accepts files from any field
+	MaxBytes  int64  // limit on the whole request body; defaults to 10 MiB
+	MaxMemory int64  // file data above this is buffered in temporary files; defaults to 1 MiB
+	MaxFiles  int    // defaults to 1
+	// AllowedTypes lists the accepted media types, e.g. "image/png" or "application/pdf".
+	// They are matched against the type sniffed from each file's content, never the
+	// client-supplied Content-Type or extension. Empty accepts any type.
+	AllowedTypes []string
+}
+
+// UploadedFile is a file received by ParseUpload.
+type UploadedFile struct {
+	Field       string
+	Name        string // client filename reduced to a safe base name; never use it as a path as is
+	ContentType string // sniffed from the content
+	Size        int64
+
+	header *multipart.FileHeader
+}
+
+// Open returns the file's content. The caller must close it.
+func (f *UploadedFile) Open() (multipart.File, error) {
+	return f.header.Open()
+}
+
+// ParseUpload reads a multipart/form-data request and returns its files after enforcing
+// opts. The body is capped with MaxBytesReader before parsing, so an oversized upload
+// fails once the limit is read rather than after it has been buffered in full; the
+// request's form values remain available through r.FormValue. Content-Encoded bodies
+// are refused, so nothing is ever decompressed past the limit.
+//
+// Errors are *HTTPError values (400, 413 or 415) suitable for returning from a Handler.
+// Temporary files are removed by the server when the handler returns.
+func ParseUpload(w http.ResponseWriter, r *http.Request, opts UploadOptions) ([]*UploadedFile, error) {
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = defaultUploadMaxBytes
+	}
+	if opts.MaxMemory <= 0 {
+		opts.MaxMemory = defaultUploadMaxMemory
+	}
+	if opts.MaxFiles <= 0 {
+		opts.MaxFiles = defaultUploadMaxFiles
+	}
+
+	if enc := r.Header.Get("Content-Encoding"); enc != "" && enc != "identity" {
+		return nil, &HTTPError{Status: http.StatusUnsupportedMediaType, Message: "compressed uploads are not accepted"}
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		return nil, &HTTPError{Status: http.StatusUnsupportedMediaType, Message: "Content-Type must be multipart/form-data"}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, opts.MaxBytes)
+	if err := r.ParseMultipartForm(opts.MaxMemory); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return nil, NewHTTPError(http.StatusRequestEntityTooLarge, err)
+		}
+		return nil, &HTTPError{Status: http.StatusBadRequest, Message: "malformed upload", Err: err}
+	}
+
+	var files []*UploadedFile
+	for field, headers := range r.MultipartForm.File {
+		if opts.Field != "" && field != opts.Field {
+			continue
+		}
+		for _, header := range headers {
+			if len(files) == opts.MaxFiles {
+				return nil, BadRequest(fmt.Sprintf("at most %d file(s) may be uploaded", opts.MaxFiles))
+			}
+			contentType, err := sniffUpload(header)
+			if err != nil {
+				return nil, InternalError(err)
+			}
+			if len(opts.AllowedTypes) > 0 && !slices.Contains(opts.AllowedTypes, contentType) {
+				return nil, &HTTPError{Status: http.StatusUnsupportedMediaType, Message: "file type " + contentType + " is not allowed"}
+			}
+			files = append(files, &UploadedFile{
+				Field:       field,
+				Name:        SanitizeFilename(header.Filename),
+				ContentType: contentType,
+				Size:        header.Size,
+				header:      header,
+			})
+		}
+	}
+	if len(files) == 0 {
+		return nil, BadRequest("no file uploaded")
+	}
+	return files, nil
+}
+
+// sniffUpload detects the media type of header's content, without parameters.
+func sniffUpload(header *multipart.FileHeader) (string, error) {
+	f, err := header.Open()
+	if err != nil {
+		return "", fmt.Errorf("opening upload: %w", err)
+	}
+	defer f.Close()
+
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("reading upload: %w", err)
+	}
+	mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(buf[:n]))
+	return mediaType, nil
+}
+
+// SanitizeFilename reduces a client-supplied filename to a base name that is safe to
+// display and to use as a single path element: directories (with either separator),
+// control characters and leading dots are dropped and the length is capped. Returns
+// "upload" when nothing usable remains.
+func SanitizeFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == unicode.ReplacementChar {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimLeft(strings.TrimSpace(name), ".")
+	for len(name) > maxUploadNameBytes {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || name == "/" {
+		return "upload"
+	}
+	return name
+}
+
+// UploadStore persists uploaded files, e.g. to a local directory or a blob store.
+type UploadStore interface {
+	// Save stores f and returns the key it can be retrieved by.
+	Save(ctx context.Context, f *UploadedFile) (string, error)
+}
+
+// DirStore is an UploadStore that writes files into a local directory. Each file is stored
+// under a random prefix plus its sanitized name, so uploads never overwrite each other and
+// the client cannot choose the path.
+type DirStore struct {
+	Dir string
+}
+
+var _ UploadStore = DirStore{}
+
+// Save implements [UploadStore].
+func (s DirStore) Save(ctx context.Context, f *UploadedFile) (string, error) {
+	key, err := uploadKey(f)
+	if err != nil {
+		return "", err
+	}
+
+	// os.Root refuses to resolve outside Dir, even through symlinks
+	root, err := os.OpenRoot(s.Dir)
+	if err != nil {
+		return "", fmt.Errorf("opening upload dir: %w", err)
+	}
+	defer root.Close()
+
+	src, err := f.Open()
+	if err != nil {
+		return "", fmt.Errorf("opening upload: %w", err)
+	}
+	defer src.Close()
+
+	dst, err := root.OpenFile(key, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", fmt.Errorf("creating %s: %w", key, err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		root.Remove(key) //nolint:errcheck
+		return "", fmt.Errorf("writing %s: %w", key, err)
+	}
+	if err := dst.Close(); err != nil {
+		return "", fmt.Errorf("writing %s: %w", key, err)
+	}
+	return key, nil
+}
+
+// BlobUploadStore is an UploadStore that puts files into a [ports.BlobStore], keyed like
+// DirStore's files below Prefix (e.g. "uploads/").
+type BlobUploadStore struct {
+	Blobs  ports.BlobStore
+	Prefix string
+}
+
+var _ UploadStore = BlobUploadStore{}
+
+// Save implements [UploadStore].
+func (s BlobUploadStore) Save(ctx context.Context, f *UploadedFile) (string, error) {
+	key, err := uploadKey(f)
+	if err != nil {
+		return "", err
+	}
+	key = s.Prefix + key
+
+	src, err := f.Open()
+	if err != nil {
+		return "", fmt.Errorf("opening upload: %w", err)
+	}
+	defer src.Close()
+
+	if err := s.Blobs.Put(ctx, key, src, f.ContentType); err != nil {
+		return "", fmt.Errorf("storing upload: %w", err)
+	}
+	return key, nil
+}
+
+// uploadKey returns a unique name for f: a random prefix plus its sanitized name.
+func uploadKey(f *UploadedFile) (string, error) {
+	prefix := make([]byte, 8)
+	if _, err := rand.Read(prefix); err != nil {
+		return "", fmt.Errorf("generating upload key: %w", err)
+	}
+	return hex.EncodeToString(prefix) + "-" + SanitizeFilename(f.Name), nil
+}
@@ -0,0 +1,123 @@
+package framework
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultWebhookSignatureHeader = "X-Signature"
+	defaultWebhookTimestampHeader = "X-Timestamp"
+	defaultWebhookTolerance       = 5 * time.Minute
+	defaultWebhookMaxBodyBytes    = 1 << 20
+)
+
+// WebhookOptions configures signature verification for Webhook.
+//
+// The expected signature is the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with Secret,
+// optionally prefixed with "sha256=". With SkipTimestamp the HMAC covers the body alone;
+// use it only for senders that do not sign a timestamp, as it disables replay protection.
+type WebhookOptions struct {
+	Secret          []byte        // required: shared secret
+	SignatureHeader string        // defaults to "X-Signature"
+	TimestampHeader string        // unix seconds; defaults to "X-Timestamp"
+	Tolerance       time.Duration // max age (and clock skew) of a delivery; defaults to 5m
+	MaxBodyBytes    int64         // defaults to 1 MiB
+	SkipTimestamp   bool
+}
+
+// WebhookHandlerFunc receives a verified webhook payload. A returned error is reported to
+// the sender with the status derived by AsHTTPError, so senders that retry on 5xx will retry.
+type WebhookHandlerFunc func(ctx context.Context, payload []byte) error
+
+// Webhook returns a handler that reads the request body, verifies its HMAC signature and
+// timestamp, and passes the payload to fn. Responds 204 on success.
+//
+// Webhook senders are servers, not browsers, so they carry no CSRF token and no session.
+// The signature is their authentication: list the path among the public routes, or
+// RegisterRoutes fails at startup with the route neither public nor behind RequireAuth,
+// and exempt it from CSRF and cross-origin checks, or every delivery is refused with 403:
+//
+//	routeOpts.PublicPaths = append(routeOpts.PublicPaths, "/webhooks/")
+//	routeOpts.CSRFExempt = append(routeOpts.CSRFExempt, "/webhooks/")
+//	mux.Handle("/webhooks/billing", framework.Webhook(opts, handleBilling)).Methods("POST")
+func Webhook(opts WebhookOptions, fn WebhookHandlerFunc) http.HandlerFunc {
+	if len(opts.Secret) == 0 {
+		panic(errors.New("webhook secret is required"))
+	}
+	if opts.SignatureHeader == "" {
+		opts.SignatureHeader = defaultWebhookSignatureHeader
+	}
+	if opts.TimestampHeader == "" {
+		opts.TimestampHeader = defaultWebhookTimestampHeader
+	}
+	if opts.Tolerance <= 0 {
+		opts.Tolerance = defaultWebhookTolerance
+	}
+	if opts.MaxBodyBytes <= 0 {
+		opts.MaxBodyBytes = defaultWebhookMaxBodyBytes
+	}
+
+	return Handler(func(w http.ResponseWriter, r *http.Request) error {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, opts.MaxBodyBytes))
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				return NewHTTPError(http.StatusRequestEntityTooLarge, err)
+			}
+			return BadRequest("unreadable body")
+		}
+
+		signed := body
+		if !opts.SkipTimestamp {
+			timestamp := r.Header.Get(opts.TimestampHeader)
+			if err := checkWebhookTimestamp(timestamp, opts.Tolerance); err != nil {
+				return &HTTPError{Status: http.StatusUnauthorized, Message: "invalid timestamp", Err: err}
+			}
+			signed = append([]byte(timestamp+"."), body...)
+		}
+
+		if !validWebhookSignature(opts.Secret, signed, r.Header.Get(opts.SignatureHeader)) {
+			return &HTTPError{Status: http.StatusUnauthorized, Message: "invalid signature"}
+		}
+
+		if err := fn(r.Context(), body); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
+
+// checkWebhookTimestamp rejects missing timestamps and those outside tolerance of now.
+func checkWebhookTimestamp(value string, tolerance time.Duration) error {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("parsing timestamp %q: %w", value, err)
+	}
+	age := time.Since(time.Unix(seconds, 0))
+	if age > tolerance || age < -tolerance {
+		return fmt.Errorf("timestamp outside tolerance: age %s", age)
+	}
+	return nil
+}
+
+// validWebhookSignature compares the header signature with the expected HMAC in constant time.
+func validWebhookSignature(secret, signed []byte, header string) bool {
+	got, err := hex.DecodeString(strings.TrimPrefix(header, "sha256="))
+	if err != nil || len(got) == 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(signed)
+	return hmac.Equal(got, mac.Sum(nil))
+}
@@ -0,0 +1,203 @@
+package web
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/antonkarounis/stoic/internal/domain/ports"
+)
+
+// loginLimiter locks an account out of login after repeated failed callbacks; see
+// AuthConfig.LoginMaxFailures. Accounts are tracked under one or more keys, e.g. the
+// subject and the email, and an account is locked once any of its keys is. Failures are
+// counted over a window sliding back from each new one. A nil loginLimiter never locks
+// anyone out.
+type loginLimiter struct {
+	store       ports.RateLimitRepository
+	maxFailures int
+	window      time.Duration
+	lockout     time.Duration
+	now         func() time.Time
+}
+
+func newLoginLimiter(store ports.RateLimitRepository, maxFailures int, window, lockout time.Duration) *loginLimiter {
+	if maxFailures <= 0 {
+		return nil
+	}
+	if store == nil {
+		store = newMemoryRateLimits()
+	}
+	return &loginLimiter{store: store, maxFailures: maxFailures, window: window, lockout: lockout, now: time.Now}
+}
+
+// lockedUntil returns when the lockout on any of keys ends, and whether one is in force.
+func (l *loginLimiter) lockedUntil(ctx context.Context, keys ...string) (time.Time, bool, error) {
+	if l == nil {
+		return time.Time{}, false, nil
+	}
+	until, err := l.store.LockedUntil(ctx, keys)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return until, !until.IsZero(), nil
+}
+
+// fail records a failed login for keys and returns when the lockout it starts ends, or the
+// zero time if it starts none.
+func (l *loginLimiter) fail(ctx context.Context, keys ...string) (time.Time, error) {
+	if l == nil {
+		return time.Time{}, nil
+	}
+	var locked time.Time
+	for _, key := range keys {
+		failures, err := l.store.Hit(ctx, key, l.window)
+		if err != nil {
+			return locked, err
+		}
+		if failures < l.maxFailures {
+			continue
+		}
+		until := l.now().Add(l.lockout)
+		if err := l.store.Lock(ctx, key, until); err != nil {
+			return locked, err
+		}
+		locked = until
+	}
+	return locked, nil
+}
+
+// reset forgets the failures recorded for keys, after a successful login.
+func (l *loginLimiter) reset(ctx context.Context, keys ...string) error {
+	if l == nil {
+		return nil
+	}
+	return l.store.Reset(ctx, keys)
+}
+
+// loginLimiterKeys returns the keys the limiter tracks an account under: its subject and,
+// when the provider supplies one, its email, so one person cannot dodge the lockout
+// through a second identity with the same address.
+func loginLimiterKeys(claims *oidcClaims) []string {
+	keys := []string{"sub:" + claims.Sub}
+	if claims.Email != "" {
+		keys = append(keys, "email:"+strings.ToLower(claims.Email))
+	}
+	return keys
+}
+
+// memoryRateLimitsSweepSize is how many tracked keys trigger a sweep of expired entries,
+// bounding memory when many accounts fail once and never again.
+const memoryRateLimitsSweepSize = 10000
+
+// memoryRateLimits is the default ports.RateLimitRepository, kept in process memory. Each
+// instance counts only what it sees, so use a shared store such as db.RateLimitRepository
+// when running several.
+type memoryRateLimits struct {
+	now func() time.Time
+
+	mu       sync.Mutex
+	hits     map[string][]time.Time // per key, when each hit leaves its window, oldest first
+	lockouts map[string]time.Time
+}
+
+var _ ports.RateLimitRepository = (*memoryRateLimits)(nil)
+
+func newMemoryRateLimits() *memoryRateLimits {
+	return &memoryRateLimits{
+		now:      time.Now,
+		hits:     make(map[string][]time.Time),
+		lockouts: make(map[string]time.Time),
+	}
+}
+
+// Hit implements [ports.RateLimitRepository].
+func (m *memoryRateLimits) Hit(_ context.Context, key string, window time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if len(m.hits)+len(m.lockouts) >= memoryRateLimitsSweepSize {
+		m.sweep(now)
+	}
+	hits := append(unexpired(m.hits[key], now), now.Add(window))
+	m.hits[key] = hits
+	return len(hits), nil
+}
+
+// Lock implements [ports.RateLimitRepository].
+func (m *memoryRateLimits) Lock(_ context.Context, key string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if until.After(m.lockouts[key]) {
+		m.lockouts[key] = until
+	}
+	delete(m.hits, key)
+	return nil
+}
+
+// LockedUntil implements [ports.RateLimitRepository].
+func (m *memoryRateLimits) LockedUntil(_ context.Context, keys []string) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	var until time.Time
+	for _, key := range keys {
+		if locked := m.lockouts[key]; locked.After(now) && locked.After(until) {
+			until = locked
+		}
+	}
+	return until, nil
+}
+
+// Reset implements [ports.RateLimitRepository].
+func (m *memoryRateLimits) Reset(_ context.Context, keys []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		delete(m.hits, key)
+		delete(m.lockouts, key)
+	}
+	return nil
+}
+
+// DeleteExpired implements [ports.RateLimitRepository].
+func (m *memoryRateLimits) DeleteExpired(context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sweep(m.now()), nil
+}
+
+// sweep drops the hits and lockouts that have run out. m.mu must be held.
+func (m *memoryRateLimits) sweep(now time.Time) int64 {
+	var deleted int64
+	for key, hits := range m.hits {
+		kept := unexpired(hits, now)
+		deleted += int64(len(hits) - len(kept))
+		if len(kept) == 0 {
+			delete(m.hits, key)
+		} else {
+			m.hits[key] = kept
+		}
+	}
+	for key, until := range m.lockouts {
+		if !until.After(now) {
+			delete(m.lockouts, key)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// unexpired returns the hits, given as the times they leave their window in ascending
+// order, that are still in it at now.
+func unexpired(hits []time.Time, now time.Time) []time.Time {
+	for i, expires := range hits {
+		if expires.After(now) {
+			return hits[i:]
+		}
+	}
+	return hits[:0]
+}
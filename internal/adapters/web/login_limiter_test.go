@@ -0,0 +1,103 @@
+package web
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable time source for the limiter and its memory store.
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+// newTestLimiter returns a limiter over a memory store, both reading the time from clock,
+// that locks an account out for an hour after three failures within ten minutes.
+func newTestLimiter(clock *fakeClock) *loginLimiter {
+	store := newMemoryRateLimits()
+	store.now = clock.Now
+	l := newLoginLimiter(store, 3, 10*time.Minute, time.Hour)
+	l.now = clock.Now
+	return l
+}
+
+func TestLoginLimiterLocksOutAfterMaxFailures(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	l := newTestLimiter(clock)
+
+	for i := range 2 {
+		if until, err := l.fail(ctx, "sub:alice"); err != nil || !until.IsZero() {
+			t.Fatalf("failure %d: locked until %v (%v), want no lockout", i+1, until, err)
+		}
+		clock.Advance(time.Minute)
+	}
+	until, err := l.fail(ctx, "sub:alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := clock.Now().Add(time.Hour); !until.Equal(want) {
+		t.Fatalf("third failure locked until %v, want %v", until, want)
+	}
+
+	clock.Advance(59 * time.Minute)
+	if got, locked, err := l.lockedUntil(ctx, "email:alice@example.com", "sub:alice"); err != nil || !locked || !got.Equal(until) {
+		t.Errorf("before the lockout ends: locked = %v until %v (%v), want until %v", locked, got, err, until)
+	}
+	clock.Advance(time.Minute)
+	if _, locked, err := l.lockedUntil(ctx, "sub:alice"); err != nil || locked {
+		t.Errorf("when the lockout ends: locked = %v (%v), want not", locked, err)
+	}
+
+	// the lockout cleared the count, so one more failure does not lock again
+	if until, err := l.fail(ctx, "sub:alice"); err != nil || !until.IsZero() {
+		t.Errorf("first failure after the lockout: locked until %v (%v), want no lockout", until, err)
+	}
+}
+
+func TestLoginLimiterForgetsFailuresOutsideTheWindow(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	l := newTestLimiter(clock)
+
+	l.fail(ctx, "sub:alice")
+	clock.Advance(6 * time.Minute)
+	l.fail(ctx, "sub:alice")
+	clock.Advance(5 * time.Minute) // the first failure has left the window
+
+	if until, err := l.fail(ctx, "sub:alice"); err != nil || !until.IsZero() {
+		t.Fatalf("locked until %v (%v) with two failures in the window, want no lockout", until, err)
+	}
+	if until, err := l.fail(ctx, "sub:alice"); err != nil || until.IsZero() {
+		t.Errorf("not locked (%v) with three failures in the window", err)
+	}
+}
+
+func TestLoginLimiterReset(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	l := newTestLimiter(clock)
+
+	l.fail(ctx, "sub:alice")
+	l.fail(ctx, "sub:alice")
+	if err := l.reset(ctx, "sub:alice"); err != nil {
+		t.Fatal(err)
+	}
+	if until, err := l.fail(ctx, "sub:alice"); err != nil || !until.IsZero() {
+		t.Errorf("locked until %v (%v) after a reset, want no lockout", until, err)
+	}
+}
+
+func TestNilLoginLimiterNeverLocks(t *testing.T) {
+	l := newLoginLimiter(nil, 0, time.Minute, time.Hour)
+	if l != nil {
+		t.Fatal("limiter created with no maximum")
+	}
+	if until, err := l.fail(context.Background(), "sub:alice"); err != nil || !until.IsZero() {
+		t.Errorf("locked until %v (%v)", until, err)
+	}
+	if _, locked, _ := l.lockedUntil(context.Background(), "sub:alice"); locked {
+		t.Error("locked")
+	}
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import "net/http"
+
+// Chain composes middleware into a single middleware. The first argument is the outermost
+// layer: Chain(a, b, c)(h) serves a request through a, then b, then c, then h. A chain can
+// be passed to mux.Use or wrapped around a single handler, and chains nest.
+//
+// Recommended ordering, outermost first:
+//
+//  1. RequestID — every later layer (and its logs) can see the id
+//  2. AccessLog — observes the final status and duration of everything below it, and
+//     provides the request logger (framework.GetLogger)
+//  3. metrics / compression — response-level concerns
+//  4. security headers, NoCache, CORS — headers applied even to error responses
+//  5. CSRF / cross-origin protection — reject forged requests before any work is done
+//  6. panic recovery — as close to the handlers as possible so outer layers still log
+//  7. CheckAuth, then ResolveUser — load the session before the user it refers to
+//  8. route-group guards (RequireAuth, RequireTenant, ...) on subrouters
+func Chain(mw ...func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		for i := len(mw) - 1; i >= 0; i-- {
+			next = mw[i](next)
+		}
+		return next
+	}
+}
@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/antonkarounis/stoic/internal/adapters/web/framework"
+)
+
+const (
+	// CSRFHeader and CSRFField carry the token on unsafe requests; see framework.GetCSRFToken.
+	CSRFHeader = "X-CSRF-Token"
+	CSRFField  = "csrf_token"
+
+	// csrfSeedCookie binds tokens for visitors without a session, e.g. the theme toggle.
+	csrfSeedCookie = "csrf_seed"
+	sessionCookie  = "session_id"
+)
+
+// CSRF returns middleware that rejects POST, PUT, PATCH and DELETE requests with 403 unless
+// they carry a valid CSRF token, complementing the Origin checks of cross-origin protection.
+//
+// Tokens are an HMAC, keyed by secret (framework.Keys.CSRF), over the session cookie, so
+// a token stays valid for the whole session and htmx pages keep working without refreshing
+// it. Requests with a Bearer Authorization header are exempt, since only scripts can set
+// it. Visitors without a session get a random seed cookie to bind to instead. The token is
+// read from the X-CSRF-Token header, then from the csrf_token field of url-encoded forms;
+// multipart requests must use the header so the body is left for framework.ParseUpload to
+// limit. cookies names the session cookie to bind to and the seed cookie.
+//
+// exempt lists paths whose requests are never checked, for callers that are servers
+// rather than browsers, such as framework.Webhook senders. A path ending in "/" matches as
+// a prefix; any other must match exactly. Exempt routes must authenticate requests
+// themselves, e.g. with a signature.
+func CSRF(secret []byte, cookies *framework.Cookies, exempt ...string) func(http.Handler) http.Handler {
+	sign := func(binding string) string {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(binding))
+		return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var bindings []string
+			if c, err := cookies.Get(r, sessionCookie); err == nil && c.Value != "" {
+				bindings = append(bindings, "session:"+c.Value)
+			}
+			if c, err := cookies.Get(r, csrfSeedCookie); err == nil && c.Value != "" {
+				bindings = append(bindings, "seed:"+c.Value)
+			}
+
+			switch r.Method {
+			case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+				if hasBearerToken(r) {
+					break // browsers never attach Authorization on their own, so it cannot be forged
+				}
+				if csrfExempt(r.URL.Path, exempt) {
+					break
+				}
+				if !validCSRFToken(csrfTokenFromRequest(r), bindings, sign) {
+					framework.GetLogger(r).Warn("rejected request without a valid CSRF token")
+					http.Error(w, "Forbidden - invalid CSRF token", http.StatusForbidden)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, framework.SetCSRFToken(r, func() string {
+				if len(bindings) > 0 {
+					return sign(bindings[0])
+				}
+				// first token for a visitor without a session: issue the seed it binds to
+				seed := rand.Text()
+				http.SetCookie(w, cookies.New(r, csrfSeedCookie, seed, 0))
+				return sign("seed:" + seed)
+			}))
+		})
+	}
+}
+
+func hasBearerToken(r *http.Request) bool {
+	scheme, _, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	return strings.EqualFold(scheme, "Bearer")
+}
+
+// csrfExempt reports whether path is one of exempt, or below one ending in "/".
+func csrfExempt(path string, exempt []string) bool {
+	for _, p := range exempt {
+		if path == p || strings.HasSuffix(p, "/") && strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func csrfTokenFromRequest(r *http.Request) string {
+	if token := r.Header.Get(CSRFHeader); token != "" {
+		return token
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/x-www-form-urlencoded" {
+		return r.PostFormValue(CSRFField)
+	}
+	return ""
+}
+
+// validCSRFToken accepts a token signed over any binding the request carries, so forms
+// rendered before login, bound to the seed, still submit once a session exists.
+func validCSRFToken(token string, bindings []string, sign func(string) string) bool {
+	if token == "" {
+		return false
+	}
+	for _, binding := range bindings {
+		if hmac.Equal([]byte(token), []byte(sign(binding))) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/antonkarounis/stoic/internal/adapters/web/framework"
+	"github.com/antonkarounis/stoic/internal/domain/ports"
+)
+
+func newTestCSRF(t *testing.T) func(http.Handler) http.Handler {
+	t.Helper()
+	cookies, err := framework.NewCookies(ports.CookieConfig{}, "http://localhost:8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return CSRF([]byte("0123456789abcdef0123456789abcdef"), cookies)
+}
+
+// csrfToken returns the token a page rendered for the session would embed.
+func csrfToken(t *testing.T, csrf func(http.Handler) http.Handler, sessionID string) string {
+	t.Helper()
+	var token string
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: sessionCookie, Value: sessionID})
+	csrf(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = framework.GetCSRFToken(r)
+	})).ServeHTTP(httptest.NewRecorder(), r)
+	if token == "" {
+		t.Fatal("no CSRF token issued")
+	}
+	return token
+}
+
+func TestCSRF(t *testing.T) {
+	csrf := newTestCSRF(t)
+	token := csrfToken(t, csrf, "session-1")
+
+	tests := []struct {
+		name   string
+		method string
+		header string // X-CSRF-Token
+		form   string // csrf_token field of a url-encoded body
+		bearer bool
+		want   int
+	}{
+		{"valid header", http.MethodPost, token, "", false, http.StatusOK},
+		{"valid form field", http.MethodPost, "", token, false, http.StatusOK},
+		{"valid on delete", http.MethodDelete, token, "", false, http.StatusOK},
+		{"forged token", http.MethodPost, "forged", "", false, http.StatusForbidden},
+		{"token of another session", http.MethodPost, csrfToken(t, csrf, "session-2"), "", false, http.StatusForbidden},
+		{"missing token", http.MethodPost, "", "", false, http.StatusForbidden},
+		{"missing token on patch", http.MethodPatch, "", "", false, http.StatusForbidden},
+		{"safe method needs no token", http.MethodGet, "", "", false, http.StatusOK},
+		{"bearer requests are exempt", http.MethodPost, "", "", true, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/logout", nil)
+			if tt.form != "" {
+				r = httptest.NewRequest(tt.method, "/logout", strings.NewReader(url.Values{CSRFField: {tt.form}}.Encode()))
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			r.AddCookie(&http.Cookie{Name: sessionCookie, Value: "session-1"})
+			if tt.header != "" {
+				r.Header.Set(CSRFHeader, tt.header)
+			}
+			if tt.bearer {
+				r.Header.Set("Authorization", "Bearer abc")
+			}
+			rec := httptest.NewRecorder()
+			csrf(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rec, r)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSRFTokenIsStableForASession(t *testing.T) {
+	csrf := newTestCSRF(t)
+	if a, b := csrfToken(t, csrf, "session-1"), csrfToken(t, csrf, "session-1"); a != b {
+		t.Errorf("tokens differ across requests: %q, %q", a, b)
+	}
+}
+
+func TestCSRFSeedsVisitorsWithoutASession(t *testing.T) {
+	csrf := newTestCSRF(t)
+
+	var token string
+	rec := httptest.NewRecorder()
+	csrf(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = framework.GetCSRFToken(r)
+	})).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	var seed *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == csrfSeedCookie {
+			seed = c
+		}
+	}
+	if seed == nil {
+		t.Fatal("no seed cookie issued")
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/theme", nil)
+	r.AddCookie(&http.Cookie{Name: csrfSeedCookie, Value: seed.Value})
+	r.Header.Set(CSRFHeader, token)
+	rec = httptest.NewRecorder()
+	csrf(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want the seed-bound token accepted", rec.Code)
+	}
+}
+
+func TestCSRFExemptPaths(t *testing.T) {
+	cookies, err := framework.NewCookies(ports.CookieConfig{}, "http://localhost:8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrf := CSRF([]byte("0123456789abcdef0123456789abcdef"), cookies, "/webhooks/", "/hooks")
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/webhooks/billing", http.StatusOK},
+		{"/webhooks/", http.StatusOK},
+		{"/hooks", http.StatusOK},
+		{"/hooks/billing", http.StatusForbidden},
+		{"/webhooksx", http.StatusForbidden},
+		{"/logout", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			// a webhook delivery: no cookies, no token
+			r := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(`{"event":"paid"}`))
+			rec := httptest.NewRecorder()
+			csrf(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rec, r)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
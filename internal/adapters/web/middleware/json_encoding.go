@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/antonkarounis/stoic/internal/adapters/web/framework"
+)
+
+// JSONEncoding returns middleware that formats the JSON responses of the routes it wraps
+// with enc; see framework.SetJSONEncoding. Handlers with their own
+// framework.JSONOptions.Encoding keep it. Use it on a router or subrouter, e.g. to indent
+// output in development:
+//
+//	api.Use(middleware.JSONEncoding(framework.JSONEncoding{Indent: "  "}))
+func JSONEncoding(enc framework.JSONEncoding) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, framework.SetJSONEncoding(r, enc))
+		})
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"log/slog"
 	"net/http"
 	"time"
+
+	"github.com/antonkarounis/stoic/internal/adapters/web/framework"
 )
 
 type statusRecorder struct {
@@ -16,15 +18,25 @@ func (r *statusRecorder) WriteHeader(status int) {
 	r.ResponseWriter.WriteHeader(status)
 }
 
+// Unwrap lets http.ResponseController reach the underlying writer, so SSE handlers can flush.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
 // AccessLog is middleware that emits a structured slog access log entry for each request.
+// It also stores a logger carrying request_id, method and path in the request context, so
+// handlers can log with request correlation via framework.GetLogger. Must run after RequestID.
 func AccessLog(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
-		next.ServeHTTP(rec, r)
-		slog.Info("access",
+		logger := slog.Default().With(
+			"request_id", framework.GetRequestID(r),
 			"method", r.Method,
 			"path", r.URL.Path,
+		)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, framework.SetLogger(r, logger))
+		logger.Info("access",
 			"status", rec.status,
 			"duration_ms", time.Since(start).Milliseconds(),
 		)
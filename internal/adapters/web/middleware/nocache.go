@@ -3,17 +3,33 @@ package middleware
 import (
 	"net/http"
 	"strings"
+	"time"
+
+	"github.com/antonkarounis/stoic/internal/adapters/web/framework"
 )
 
 // B5: noCache sets cache-busting headers for dynamic routes only.
 // Static file routes (if added later) should be excluded.
+// Routes opt into browser caching with PrivateCache or framework.SetPrivateCache.
 func NoCache(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !strings.HasPrefix(r.URL.Path, "/static/") {
-			w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
-			w.Header().Set("Pragma", "no-cache")
-			w.Header().Set("Expires", "0")
+			framework.SetNoStore(w)
 		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+// PrivateCache returns middleware that lets browsers cache the routes it wraps for maxAge,
+// overriding NoCache; see framework.SetPrivateCache for when that is safe. Use it on a
+// route or subrouter:
+//
+//	app.Handle("/docs", middleware.PrivateCache(5*time.Minute)(docsHandler))
+func PrivateCache(maxAge time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			framework.SetPrivateCache(w, maxAge)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
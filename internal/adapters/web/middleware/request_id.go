@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/antonkarounis/stoic/internal/adapters/web/framework"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// RequestID assigns each request an id, reusing an incoming X-Request-ID from a proxy
+// when present, echoes it on the response, and stores it in the request context.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, framework.SetRequestID(r, id))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic("crypto/rand is unavailable: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
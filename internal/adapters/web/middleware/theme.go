@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/antonkarounis/stoic/internal/adapters/web/framework"
+)
+
+// ThemeCookie holds the light/dark choice of visitors, logged in or not.
+const ThemeCookie = "theme"
+
+// Theme resolves the color theme for the request and stores it for framework.GetTheme.
+// A logged-in user's stored preference wins over the theme cookie, read under the name
+// cookies gives it. Must run after ResolvePreferences.
+func Theme(cookies *framework.Cookies) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			theme := ""
+			if framework.GetLoggedInUser(r) != nil {
+				theme = framework.GetPreferences(r).Theme
+			} else if cookie, err := cookies.Get(r, ThemeCookie); err == nil {
+				theme = cookie.Value
+			}
+			next.ServeHTTP(w, framework.SetTheme(r, theme))
+		})
+	}
+}
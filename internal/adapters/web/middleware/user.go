@@ -4,11 +4,13 @@ import (
 	"net/http"
 
 	"github.com/antonkarounis/stoic/internal/adapters/web/framework"
+	"github.com/antonkarounis/stoic/internal/domain/models"
 	"github.com/antonkarounis/stoic/internal/domain/ports"
 )
 
-// ResolveUser loads the domain User into context if the session has a linked UserID.
-// Silent no-op when there is no session or the identity is not yet linked to a user.
+// ResolveUser loads the domain User into context if the session has a linked UserID, and
+// adds user_id to the request logger. Silent no-op when there is no session or the identity
+// is not yet linked to a user.
 func ResolveUser(userRepo ports.UserRepository) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -16,6 +18,44 @@ func ResolveUser(userRepo ports.UserRepository) func(http.Handler) http.Handler
 			if session != nil && session.UserID != nil {
 				if user, err := userRepo.FindByID(r.Context(), *session.UserID); err == nil {
 					r = framework.SetUserInContext(r, &user)
+					r = framework.SetLogger(r, framework.GetLogger(r).With("user_id", user.ID))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ResolveFlags evaluates the feature flags for the logged-in user, or for an anonymous
+// visitor, and stores them in context; see framework.FlagEnabled. Must run after
+// ResolveUser so per-user overrides apply. Load failures fall back to the last known flags.
+func ResolveFlags(flags ports.FlagService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var userID *models.UserID
+			if user := framework.GetLoggedInUser(r); user != nil {
+				userID = &user.ID
+			}
+			evaluated, err := flags.Evaluate(r.Context(), userID)
+			if err != nil {
+				framework.GetLogger(r).Warn("failed to load feature flags", "error", err)
+			}
+			next.ServeHTTP(w, framework.SetFlags(r, evaluated))
+		})
+	}
+}
+
+// ResolvePreferences loads the logged-in user's preferences into context; see
+// framework.GetPreferences. Must run after ResolveUser. Load failures fall back to defaults.
+func ResolvePreferences(users ports.UserService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user := framework.GetLoggedInUser(r); user != nil {
+				prefs, err := users.GetPreferences(r.Context(), user.ID)
+				if err != nil {
+					framework.GetLogger(r).Warn("failed to load preferences", "error", err)
+				} else {
+					r = framework.SetPreferences(r, prefs)
 				}
 			}
 			next.ServeHTTP(w, r)
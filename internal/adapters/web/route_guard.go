@@ -0,0 +1,90 @@
+package web
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// defaultPublicPaths are the routes served without authentication. A path ending in "/"
+// (other than "/" itself) matches as a prefix; any other path must match the route
+// template exactly. Add a route here only if it is meant to be reachable while logged out.
+var defaultPublicPaths = []string{
+	"/healthz",
+	"/readyz",
+	"/static/",
+	"/",
+	"/theme",
+	"/register",
+	"/callback",
+	"/logout",
+	"/logout-all",
+	"/access-denied",
+}
+
+// routeGuard records the subrouters protected by RequireAuth so that RegisterRoutes can
+// verify every route is either declared public or requires authentication. Forgetting to
+// register a page on a protected subrouter then fails at startup instead of exposing it.
+type routeGuard struct {
+	public    []string
+	protected map[*mux.Router]bool
+}
+
+func newRouteGuard(public []string) *routeGuard {
+	return &routeGuard{public: public, protected: map[*mux.Router]bool{}}
+}
+
+// protect applies requireAuth to r and marks its routes, including those of nested
+// subrouters, as authenticated.
+func (g *routeGuard) protect(r *mux.Router, requireAuth mux.MiddlewareFunc) *mux.Router {
+	r.Use(requireAuth)
+	g.protected[r] = true
+	return r
+}
+
+func (g *routeGuard) isPublic(path string) bool {
+	for _, p := range g.public {
+		if path == p || (strings.HasSuffix(p, "/") && p != "/" && strings.HasPrefix(path, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// check walks router and returns an error listing the routes that are neither public nor
+// registered on a protected subrouter.
+func (g *routeGuard) check(router *mux.Router) error {
+	protectedRoutes := map[*mux.Route]bool{}
+	var exposed []string
+
+	err := router.Walk(func(route *mux.Route, r *mux.Router, ancestors []*mux.Route) error {
+		isProtected := g.protected[r]
+		for _, a := range ancestors {
+			isProtected = isProtected || protectedRoutes[a]
+		}
+		if isProtected {
+			protectedRoutes[route] = true
+			return nil
+		}
+		// routes without a handler only dispatch to a subrouter, which is walked next
+		if route.GetHandler() == nil {
+			return nil
+		}
+
+		path, err := route.GetPathTemplate()
+		if err == nil && g.isPublic(path) {
+			return nil
+		}
+		methods, _ := route.GetMethods()
+		exposed = append(exposed, strings.TrimSpace(strings.Join(methods, ",")+" "+path))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("walking routes: %w", err)
+	}
+	if len(exposed) > 0 {
+		return fmt.Errorf("routes are neither public nor behind RequireAuth: %s", strings.Join(exposed, ", "))
+	}
+	return nil
+}
@@ -1,9 +1,16 @@
 package web
 
 import (
+	"fmt"
+	"math"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/antonkarounis/stoic/internal/adapters/web/controllers"
+	"github.com/antonkarounis/stoic/internal/adapters/web/framework"
 	"github.com/antonkarounis/stoic/internal/adapters/web/middleware"
 	"github.com/antonkarounis/stoic/internal/adapters/web/views"
 	"github.com/antonkarounis/stoic/internal/domain/ports"
@@ -12,57 +19,233 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// RouteOptions contains the configuration used by routes and their controllers.
+type RouteOptions struct {
+	IsDev bool
+	// Pagination bounds ?per_page on list endpoints; pass it to framework.Paginate.
+	Pagination framework.PaginationOptions
+	// PublicPaths extends defaultPublicPaths with further routes served without
+	// authentication; see defaultPublicPaths for the matching rules.
+	PublicPaths []string
+	// Blobs stores uploads and generated artifacts; see framework.BlobUploadStore.
+	Blobs ports.BlobStore
+	// CSRFKey signs the CSRF tokens checked on unsafe requests; see middleware.CSRF. Pass
+	// framework.Keys.CSRF rather than the secret key itself.
+	CSRFKey []byte
+	// CSRFExempt lists paths served to non-browser callers, such as framework.Webhook
+	// routes, that are exempt from CSRF tokens and cross-origin checks. A path ending in
+	// "/" matches as a prefix. They usually belong in PublicPaths as well.
+	CSRFExempt []string
+	// RetryAfter is sent as Retry-After on 503 responses, telling clients and load
+	// balancers when to try again. Defaults to 5s.
+	RetryAfter time.Duration
+	// Flags evaluates feature flags for each request; see framework.FlagEnabled and the
+	// feature template func. Nil leaves every flag off.
+	Flags ports.FlagService
+	// OpenAPI serves /openapi.json describing the routes registered with
+	// framework.DocumentedJSONHandler. Off by default.
+	OpenAPI bool
+	// Paths moves the authenticated area and the login flow; see RoutePaths.
+	Paths RoutePaths
+	// WarmTemplates renders every page once before RegisterRoutes returns (see
+	// framework.TemplateRegistry.Warm), failing registration if any page fails to render.
+	WarmTemplates bool
+	// Cookies names the CSRF and theme cookies and sets their attributes; pass the same
+	// value as AuthConfig.Cookies. Nil uses the defaults of framework.NewCookies.
+	Cookies *framework.Cookies
+	// SharedData contributes values every page can read with the shared template func; see
+	// framework.TemplateRegistry.AddSharedData.
+	SharedData []framework.SharedDataProvider
+	// Shutdown ends open SSE streams once closed; see framework.SSEOptions.Shutdown. Nil
+	// leaves them open until the client disconnects.
+	Shutdown <-chan struct{}
+	// Hub broadcasts server-sent events to every page connected to the events route; call
+	// its Shutdown before the server's so clients reconnect to another instance. Nil mounts
+	// no events route.
+	Hub *framework.Hub
+}
+
+// RoutePaths are the URLs of the authenticated area and the login flow, configured
+// together so they stay consistent.
+type RoutePaths struct {
+	AppPrefix  string // authenticated area behind RequireAuth; defaults to "/app"
+	Login      string // starts the OIDC login and is where RequireAuth sends visitors; defaults to "/login"
+	AfterLogin string // where Callback sends users with no page to return to; defaults to the dashboard
+}
+
+// resolve fills in the defaults and checks that the paths are local and that the login
+// path is reachable, i.e. not inside the protected area, which would loop.
+func (p *RoutePaths) resolve() error {
+	if p.AppPrefix == "" {
+		p.AppPrefix = "/app"
+	}
+	if p.Login == "" {
+		p.Login = "/login"
+	}
+	p.AppPrefix = strings.TrimSuffix(p.AppPrefix, "/")
+
+	if !isLocalPath(p.AppPrefix) {
+		return fmt.Errorf("app prefix %q must be a path below /", p.AppPrefix)
+	}
+	if !isLocalPath(p.Login) {
+		return fmt.Errorf("login path %q must be a local path", p.Login)
+	}
+	if p.AfterLogin != "" && !isLocalPath(p.AfterLogin) {
+		return fmt.Errorf("after-login path %q must be a local path", p.AfterLogin)
+	}
+	if p.Login == p.AppPrefix || strings.HasPrefix(p.Login, p.AppPrefix+"/") {
+		return fmt.Errorf("login path %q is inside the protected prefix %q", p.Login, p.AppPrefix)
+	}
+	return nil
+}
+
 // RegisterRoutes sets up all application routes.
 // Edit this file to add your pages and API endpoints.
-func RegisterRoutes(mux *mux.Router, authService AuthService, userRepo ports.UserRepository, pool *pgxpool.Pool, isDev bool) {
+//
+// Every route must either be listed in defaultPublicPaths (or opts.PublicPaths) or be
+// registered on a subrouter protected with guard.protect; RegisterRoutes returns an error
+// naming any route that is neither.
+func RegisterRoutes(mux *mux.Router, authService *AuthService, userRepo ports.UserRepository, userService ports.UserService, pool *pgxpool.Pool, opts RouteOptions) error {
+	paths := opts.Paths
+	if err := paths.resolve(); err != nil {
+		return err
+	}
+
+	publicPaths := slices.Concat(defaultPublicPaths, []string{paths.Login}, opts.PublicPaths)
+	if opts.OpenAPI {
+		publicPaths = append(publicPaths, "/openapi.json")
+	}
+	guard := newRouteGuard(publicPaths)
+
+	cookies := opts.Cookies
+	if cookies == nil {
+		var err error
+		if cookies, err = framework.NewCookies(ports.CookieConfig{}, ""); err != nil {
+			return err
+		}
+	}
 
 	// Health endpoints — registered before any middleware so they are always reachable
 	mux.HandleFunc("/healthz", healthz).Methods("GET")
-	mux.HandleFunc("/readyz", readyz(pool)).Methods("GET")
+	mux.HandleFunc("/readyz", readyz(pool, opts.RetryAfter)).Methods("GET")
 
-	// general always-on middleware
-	mux.Use(middleware.AccessLog)
-	mux.Use(middleware.NoCache)
-	mux.Use(middleware.SecurityHeadersMiddleware(isDev))
+	// general always-on middleware, outermost first (see middleware.Chain for ordering)
 	cop := http.NewCrossOriginProtection()
-	mux.Use(func(next http.Handler) http.Handler { return cop.Handler(next) })
-	mux.Use(gorillaHandlers.RecoveryHandler(gorillaHandlers.PrintRecoveryStack(true)))
-	mux.Use(middleware.UrlForMiddleware(mux))
+	for _, path := range opts.CSRFExempt {
+		cop.AddInsecureBypassPattern(path)
+	}
+	mux.Use(middleware.Chain(
+		middleware.RequestID,
+		middleware.AccessLog,
+		middleware.NoCache,
+		middleware.SecurityHeadersMiddleware(opts.IsDev),
+		cop.Handler,
+		middleware.CSRF(opts.CSRFKey, cookies, opts.CSRFExempt...),
+		gorillaHandlers.RecoveryHandler(gorillaHandlers.PrintRecoveryStack(true)),
+		middleware.UrlForMiddleware(mux),
+	))
 
-	// auth and user loading
-	mux.Use(authService.CheckAuth)
-	mux.Use(middleware.ResolveUser(userRepo))
+	// auth, user and preference loading
+	mux.Use(middleware.Chain(
+		authService.CheckAuth,
+		middleware.ResolveUser(userRepo),
+		middleware.ResolvePreferences(userService),
+		middleware.Theme(cookies),
+	))
+	if opts.Flags != nil {
+		mux.Use(middleware.ResolveFlags(opts.Flags))
+	}
 
-	registry := initTemplates()
+	registry := initTemplates(opts.IsDev)
+	registry.AddSharedData(opts.SharedData...)
+	if opts.IsDev {
+		mux.Use(middleware.JSONEncoding(framework.JSONEncoding{Indent: "  "}))
+	}
 
 	// Public routes
 	mux.PathPrefix("/static/").Handler(StaticHandler(views.StaticFS)).Name("static")
 	mux.HandleFunc("/", controllers.Home(registry)).Methods("GET").Name("index")
+	mux.HandleFunc("/theme", controllers.SetTheme(registry, userService, cookies)).Methods("POST").Name("theme")
+	if opts.OpenAPI {
+		mux.Handle("/openapi.json", framework.OpenAPIHandler(mux, framework.OpenAPIInfo{Title: "stoic", Version: "1.0.0"})).Methods("GET").Name("openapi")
+	}
 
 	// Auth routes
-	mux.HandleFunc("/login", authService.Login).Methods("GET").Name("login")
+	mux.HandleFunc(paths.Login, authService.Login).Methods("GET").Name("login")
 	mux.HandleFunc("/register", authService.Register).Methods("GET").Name("register")
 	mux.HandleFunc("/callback", authService.Callback).Methods("GET")
 	mux.HandleFunc("/logout", authService.Logout).Methods("POST").Name("logout")
+	mux.HandleFunc("/logout-all", authService.LogoutAll).Methods("POST").Name("logout_all")
+	mux.HandleFunc("/access-denied", controllers.AccessDenied(registry)).Methods("GET").Name("access_denied")
 
-	// Authenticated routes
-	app := mux.PathPrefix("/app").Subrouter()
-	app.Use(authService.RequireAuth)
+	// Authenticated routes. Role-restricted pages go on a nested subrouter, which stays
+	// covered by the route guard:
+	//
+	//	admin := app.PathPrefix("/admin").Subrouter()
+	//	admin.Use(authService.RequireRole("admin", "support"))   // any of the listed roles
+	//	admin.Use(authService.RequireAllRoles("admin", "billing")) // every listed role
+	app := guard.protect(mux.PathPrefix(paths.AppPrefix).Subrouter(), authService.RequireAuth)
 	app.HandleFunc("/dashboard", controllers.Dashboard(registry)).Methods("GET").Name("dashboard")
 	app.HandleFunc("/profile", controllers.Profile(registry)).Methods("GET").Name("profile")
-	app.HandleFunc("/time", controllers.Time()).Methods("GET").Name("time")
+	app.HandleFunc("/settings", controllers.Settings(registry)).Methods("GET").Name("settings")
+	app.HandleFunc("/settings", controllers.UpdateSettings(registry, userService)).Methods("POST")
+	app.HandleFunc("/settings/preferences", controllers.UpdatePreferences(registry, userService)).Methods("POST").Name("preferences")
+	app.HandleFunc("/time", controllers.Time(opts.Shutdown)).Methods("GET").Name("time")
+	if opts.Hub != nil {
+		app.HandleFunc("/events", framework.HubSSEHandler(opts.Hub)).Methods("GET").Name("events")
+	}
 
-	authService.SetLoginRedirect("dashboard")
+	// JSON APIs registered with framework.DocumentedJSONHandler appear in /openapi.json:
+	//
+	//	app.Handle("/api/notes", framework.DocumentedJSONHandler(framework.APIDoc{
+	//		Summary: "Create a note",
+	//	}, controllers.CreateNote(noteService))).Methods("POST").Name("create_note")
+
+	if paths.AfterLogin != "" {
+		authService.SetLoginRedirect(paths.AfterLogin)
+	} else {
+		authService.SetLoginRedirect("dashboard")
+	}
 	authService.SetLoginFailureRedirect("login")
+	authService.SetAccessDeniedRedirect("access_denied")
+	authService.SetForbiddenHandler(func(w http.ResponseWriter, r *http.Request) {
+		registry.RenderError(w, r, framework.Forbidden())
+	})
+	unavailableRetryAfter := retryAfterSeconds(opts.RetryAfter)
+	authService.SetUnavailableHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", unavailableRetryAfter)
+		registry.RenderError(w, r, framework.Unavailable(nil))
+	})
+
+	if opts.WarmTemplates {
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		if err := registry.Warm(framework.SetUrlFuncInContext(req, mux)); err != nil {
+			return fmt.Errorf("warming templates: %w", err)
+		}
+	}
+
+	return guard.check(mux)
 }
 
 func healthz(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-func readyz(pool *pgxpool.Pool) func(w http.ResponseWriter, r *http.Request) {
+// retryAfterSeconds formats d as a Retry-After value, defaulting to 5s.
+func retryAfterSeconds(d time.Duration) string {
+	if d <= 0 {
+		d = 5 * time.Second
+	}
+	// Retry-After is in whole seconds; round up so clients never retry early
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+func readyz(pool *pgxpool.Pool, retryAfter time.Duration) func(w http.ResponseWriter, r *http.Request) {
+	retryAfterValue := retryAfterSeconds(retryAfter)
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		if err := pool.Ping(r.Context()); err != nil {
+			w.Header().Set("Retry-After", retryAfterValue)
 			http.Error(w, "db not ready", http.StatusServiceUnavailable)
 			return
 		}
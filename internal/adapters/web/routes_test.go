@@ -0,0 +1,125 @@
+package web
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/antonkarounis/stoic/internal/adapters/web/framework"
+	"github.com/gorilla/mux"
+)
+
+func TestRoutePathsResolve(t *testing.T) {
+	tests := []struct {
+		name    string
+		paths   RoutePaths
+		want    RoutePaths
+		wantErr bool
+	}{
+		{"defaults", RoutePaths{}, RoutePaths{AppPrefix: "/app", Login: "/login"}, false},
+		{"custom prefix", RoutePaths{AppPrefix: "/admin/", Login: "/signin", AfterLogin: "/admin/home"},
+			RoutePaths{AppPrefix: "/admin", Login: "/signin", AfterLogin: "/admin/home"}, false},
+		{"login inside the prefix", RoutePaths{AppPrefix: "/admin", Login: "/admin/login"}, RoutePaths{}, true},
+		{"login equal to the prefix", RoutePaths{AppPrefix: "/admin", Login: "/admin"}, RoutePaths{}, true},
+		{"login sharing only a name prefix", RoutePaths{AppPrefix: "/admin", Login: "/administrator-login"},
+			RoutePaths{AppPrefix: "/admin", Login: "/administrator-login"}, false},
+		{"root prefix", RoutePaths{AppPrefix: "/"}, RoutePaths{}, true},
+		{"absolute after-login URL", RoutePaths{AfterLogin: "https://evil.example/"}, RoutePaths{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths := tt.paths
+			err := paths.resolve()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && paths != tt.want {
+				t.Errorf("resolved to %+v, want %+v", paths, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterRoutesWithCustomPaths(t *testing.T) {
+	a := newTestAuth(t, nil)
+	router := mux.NewRouter()
+	err := RegisterRoutes(router, a.AuthService, nil, nil, nil, RouteOptions{
+		CSRFKey: []byte("0123456789abcdef0123456789abcdef"),
+		Paths:   RoutePaths{AppPrefix: "/admin", Login: "/signin", AfterLogin: "/admin/profile"},
+	})
+	if err != nil {
+		t.Fatalf("RegisterRoutes: %v", err)
+	}
+
+	// anonymous visitors to the protected area are sent to the custom login path
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/dashboard", nil))
+	if rec.Code != http.StatusTemporaryRedirect || rec.Header().Get("Location") != "/signin" {
+		t.Errorf("got %d to %q, want redirect to /signin", rec.Code, rec.Header().Get("Location"))
+	}
+
+	// the login flow starts there
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/signin", nil))
+	if rec.Code != http.StatusTemporaryRedirect {
+		t.Errorf("/signin status = %d, want a redirect to the provider", rec.Code)
+	}
+
+	// the old prefix is gone
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/app/dashboard", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("/app/dashboard status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	// and a completed login lands on the custom after-login page
+	if got := a.login(t, map[string]any{"sub": "alice"}, nil).Header().Get("Location"); got != "/admin/profile" {
+		t.Errorf("after login redirected to %q, want /admin/profile", got)
+	}
+}
+
+func TestRegisterRoutesServesExemptWebhooks(t *testing.T) {
+	a := newTestAuth(t, nil)
+	router := mux.NewRouter()
+	err := RegisterRoutes(router, a.AuthService, nil, nil, nil, RouteOptions{
+		CSRFKey:     []byte("0123456789abcdef0123456789abcdef"),
+		PublicPaths: []string{"/webhooks/"},
+		CSRFExempt:  []string{"/webhooks/"},
+	})
+	if err != nil {
+		t.Fatalf("RegisterRoutes: %v", err)
+	}
+	secret := []byte("webhook secret")
+	router.Handle("/webhooks/billing", framework.Webhook(framework.WebhookOptions{Secret: secret},
+		func(ctx context.Context, payload []byte) error { return nil })).Methods("POST")
+
+	body := `{"event":"paid"}`
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "." + body))
+
+	// a delivery has no cookies and no CSRF token, and may come from anywhere
+	r := httptest.NewRequest(http.MethodPost, "/webhooks/billing", strings.NewReader(body))
+	r.Header.Set("X-Timestamp", timestamp)
+	r.Header.Set("X-Signature", hex.EncodeToString(mac.Sum(nil)))
+	r.Header.Set("Sec-Fetch-Site", "cross-site")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, r)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("webhook status = %d, want %d: %s", rec.Code, http.StatusNoContent, rec.Body)
+	}
+
+	// routes that are not exempt still need a token
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/logout", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("/logout without a token: status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
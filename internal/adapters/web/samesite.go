@@ -0,0 +1,56 @@
+package web
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// User agents that reject or misread SameSite, after the Chromium project's list of
+// incompatible clients (https://www.chromium.org/updates/same-site/incompatible-clients).
+// Keep in sync with that page when it changes; the affected versions are old enough that
+// it rarely does.
+var (
+	// iOS 12 and macOS 10.14 WebKit treat SameSite=None as Strict
+	ios12UA         = regexp.MustCompile(`\(iP.+; CPU .*OS 12[_\d]*.*\) AppleWebKit/`)
+	macOS1014UA     = regexp.MustCompile(`\(Macintosh;.*Mac OS X 10_14[_\d]*.*\) AppleWebKit/`)
+	safariUA        = regexp.MustCompile(`Version/.* Safari/`)
+	macEmbeddedUA   = regexp.MustCompile(`^Mozilla/[.\d]+ \(Macintosh;.*Mac OS X [_\d]+\) AppleWebKit/[.\d]+ \(KHTML, like Gecko\)$`)
+	chromiumBasedUA = regexp.MustCompile(`Chrom(e|ium)`)
+
+	// Chrome 51 to 66 reject cookies with SameSite=None
+	chromiumVersionUA = regexp.MustCompile(`Chrom[^ /]+/(\d+)[.\d]* `)
+
+	// UC Browser before 12.13.2 rejects cookies with SameSite=None
+	ucBrowserVersionUA = regexp.MustCompile(`UCBrowser/(\d+)\.(\d+)\.(\d+)[.\d]* `)
+)
+
+// sameSiteIncompatible reports whether the browser sending userAgent is known to mishandle
+// the SameSite attribute, so auth cookies for it are better sent without one.
+func sameSiteIncompatible(userAgent string) bool {
+	if ios12UA.MatchString(userAgent) {
+		return true
+	}
+	if macOS1014UA.MatchString(userAgent) &&
+		(safariUA.MatchString(userAgent) && !chromiumBasedUA.MatchString(userAgent) || macEmbeddedUA.MatchString(userAgent)) {
+		return true
+	}
+	if m := chromiumVersionUA.FindStringSubmatch(userAgent); m != nil {
+		major, _ := strconv.Atoi(m[1])
+		if major >= 51 && major <= 66 {
+			return true
+		}
+	}
+	if m := ucBrowserVersionUA.FindStringSubmatch(userAgent); m != nil {
+		major, _ := strconv.Atoi(m[1])
+		minor, _ := strconv.Atoi(m[2])
+		patch, _ := strconv.Atoi(m[3])
+		if major != 12 {
+			return major < 12
+		}
+		if minor != 13 {
+			return minor < 13
+		}
+		return patch < 2
+	}
+	return false
+}
@@ -10,9 +10,16 @@ import (
 
 func loadTemplateFuncs(r *http.Request) template.FuncMap {
 	return template.FuncMap{
-		"urlFor":      urlFor(r),
-		"isLoggedIn":  loggedIn(r),
-		"currentUser": currentUser(r),
+		"urlFor":       urlFor(r),
+		"isLoggedIn":   loggedIn(r),
+		"currentUser":  currentUser(r),
+		"prefs":        prefs(r),
+		"theme":        theme(r),
+		"hasRole":      hasRole(r),
+		"hasGroup":     hasGroup(r),
+		"csrf":         csrf(r),
+		"feature":      feature(r),
+		"featureValue": featureValue(r),
 	}
 }
 
@@ -22,6 +29,27 @@ func urlFor(r *http.Request) func(string) string {
 	}
 }
 
+// csrf returns the token forms submit as the csrf_token field (see middleware.CSRF).
+func csrf(r *http.Request) func() string {
+	return func() string {
+		return framework.GetCSRFToken(r)
+	}
+}
+
+// feature reports whether a feature flag is on: {{ if feature "new_nav" }}.
+func feature(r *http.Request) func(string) bool {
+	return func(name string) bool {
+		return framework.FlagEnabled(r.Context(), name)
+	}
+}
+
+// featureValue returns a flag's variant, e.g. the arm of an A/B test.
+func featureValue(r *http.Request) func(string) string {
+	return func(name string) string {
+		return framework.FlagValue(r.Context(), name)
+	}
+}
+
 func loggedIn(r *http.Request) func() bool {
 	return func() bool {
 		return framework.GetLoggedInUser(r) != nil
@@ -36,3 +64,31 @@ func currentUser(r *http.Request) func() models.User {
 		return models.User{}
 	}
 }
+
+func prefs(r *http.Request) func() models.Preferences {
+	return func() models.Preferences {
+		return framework.GetPreferences(r)
+	}
+}
+
+func theme(r *http.Request) func() string {
+	return func() string {
+		return framework.GetTheme(r)
+	}
+}
+
+// hasRole and hasGroup are funcs rather than view model fields, so templates can gate UI
+// on the session without every view model carrying authorization flags.
+func hasRole(r *http.Request) func(string) bool {
+	return func(role string) bool {
+		session := framework.GetAuthSession(r)
+		return session != nil && session.HasRole(role)
+	}
+}
+
+func hasGroup(r *http.Request) func(string) bool {
+	return func(group string) bool {
+		session := framework.GetAuthSession(r)
+		return session != nil && session.HasGroup(group)
+	}
+}
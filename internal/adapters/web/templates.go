@@ -12,14 +12,15 @@ import (
 //go:embed views/www/*
 var templateFS embed.FS
 
-func initTemplates() *framework.TemplateRegistry {
+func initTemplates(isDev bool) *framework.TemplateRegistry {
 	registry, err := framework.NewTemplateRegistry(framework.TemplateRegistryOptions{
 		FS:                   templateFS,
 		RootDir:              "views/www",
 		IncludeDir:           "views/include",
-		Reload:               false,
+		Reload:               isDev,
 		FuncMap:              template.FuncMap{},
 		RequestFuncsProvider: loadTemplateFuncs,
+		DevHeaders:           isDev,
 	})
 	if err != nil {
 		panic(fmt.Errorf("error when loading templates: %w", err))
@@ -0,0 +1,106 @@
+// Package webtest provides helpers for testing web templates and handlers.
+package webtest
+
+import (
+	"bytes"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/antonkarounis/stoic/internal/adapters/web/framework"
+)
+
+// update regenerates golden files instead of comparing against them:
+//
+//	go test ./... -update
+var update = flag.Bool("update", false, "rewrite golden files with the current render output")
+
+// GoldenOptions configures RenderGoldenWithOptions.
+type GoldenOptions struct {
+	// Request is served to the page; defaults to a GET of "/". Set it when the template
+	// depends on request state such as the logged-in user or urlFor.
+	Request *http.Request
+	// NormalizeWhitespace trims every line and drops blank ones before comparing, so
+	// indentation-only template edits don't churn the golden files.
+	NormalizeWhitespace bool
+}
+
+// RenderGolden renders the page at name with model and compares the HTML with the golden
+// file at goldenPath. See RenderGoldenWithOptions.
+func RenderGolden(t testing.TB, registry *framework.TemplateRegistry, name string, model any, goldenPath string) {
+	t.Helper()
+	RenderGoldenWithOptions(t, registry, name, model, goldenPath, GoldenOptions{})
+}
+
+// RenderGoldenWithOptions renders the page at name with model through the same path as a
+// BuildHandler route, including view model validation and the base layout, and compares
+// the HTML with the golden file at goldenPath. Run the tests with -update to write the
+// current output to the golden files instead.
+func RenderGoldenWithOptions(t testing.TB, registry *framework.TemplateRegistry, name string, model any, goldenPath string, opts GoldenOptions) {
+	t.Helper()
+
+	got := render(t, registry, name, model, opts.Request)
+	if opts.NormalizeWhitespace {
+		got = normalizeWhitespace(got)
+	}
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(goldenPath), 0o755); err != nil {
+			t.Fatalf("creating golden dir: %v", err)
+		}
+		if err := os.WriteFile(goldenPath, got, 0o644); err != nil {
+			t.Fatalf("writing golden file: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("reading golden file (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s does not match golden file %s (run with -update to accept)\n--- got\n%s\n--- want\n%s", name, goldenPath, got, want)
+	}
+}
+
+func render(t testing.TB, registry *framework.TemplateRegistry, name string, model any, r *http.Request) []byte {
+	t.Helper()
+
+	// BuildHandler reports template and view model mismatches by panicking
+	var handler http.HandlerFunc
+	func() {
+		defer func() {
+			if p := recover(); p != nil {
+				t.Fatalf("building handler for %s: %v", name, p)
+			}
+		}()
+		handler = registry.BuildHandler(name, model, func(w http.ResponseWriter, r *http.Request, te *framework.TemplateRenderer) error {
+			return te.WriteTo(w, model)
+		})
+	}()
+
+	if r == nil {
+		r = httptest.NewRequest(http.MethodGet, "/", nil)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("rendering %s: status %d: %s", name, rec.Code, rec.Body.String())
+	}
+	return rec.Body.Bytes()
+}
+
+func normalizeWhitespace(b []byte) []byte {
+	var out bytes.Buffer
+	for _, line := range strings.Split(string(b), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			out.WriteString(line)
+			out.WriteByte('\n')
+		}
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,79 @@
+package webtest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/antonkarounis/stoic/internal/adapters/web/framework"
+)
+
+type greeting struct {
+	Name  string
+	Items []string
+}
+
+var testGreeting = greeting{Name: "Ada", Items: []string{"engines", "notes"}}
+
+func newTestRegistry(t *testing.T) *framework.TemplateRegistry {
+	t.Helper()
+	registry, err := framework.NewTemplateRegistry(framework.TemplateRegistryOptions{
+		FS:         os.DirFS("testdata"),
+		RootDir:    "pages",
+		IncludeDir: "includes",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return registry
+}
+
+func TestRenderGolden(t *testing.T) {
+	RenderGolden(t, newTestRegistry(t), "greeting.html", testGreeting, "testdata/greeting.golden.html")
+}
+
+func TestRenderGoldenNormalizesWhitespace(t *testing.T) {
+	RenderGoldenWithOptions(t, newTestRegistry(t), "greeting.html", testGreeting, "testdata/greeting.normalized.golden.html",
+		GoldenOptions{NormalizeWhitespace: true})
+}
+
+// failureRecorder is a testing.TB that records Errorf instead of failing the test.
+type failureRecorder struct {
+	testing.TB
+	failed bool
+}
+
+func (r *failureRecorder) Errorf(format string, args ...any) { r.failed = true }
+
+func TestRenderGoldenReportsMismatch(t *testing.T) {
+	golden := filepath.Join(t.TempDir(), "greeting.golden.html")
+	if err := os.WriteFile(golden, []byte("<p>stale</p>\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := &failureRecorder{TB: t}
+	RenderGolden(recorder, newTestRegistry(t), "greeting.html", testGreeting, golden)
+	if !recorder.failed {
+		t.Error("a stale golden file was accepted")
+	}
+}
+
+func TestRenderGoldenUpdate(t *testing.T) {
+	*update = true
+	t.Cleanup(func() { *update = false })
+	golden := filepath.Join(t.TempDir(), "new", "greeting.golden.html")
+
+	RenderGoldenWithOptions(t, newTestRegistry(t), "greeting.html", testGreeting, golden, GoldenOptions{NormalizeWhitespace: true})
+
+	got, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("golden file not written: %v", err)
+	}
+	want, err := os.ReadFile("testdata/greeting.normalized.golden.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("wrote %q, want %q", got, want)
+	}
+}
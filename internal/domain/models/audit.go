@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// AuditEvent is a queryable record of a security-relevant action: who did what, to what, when.
+type AuditEvent struct {
+	ID          int64
+	ActorUserID *UserID // nil when the actor is unknown (e.g. a failed or anonymous request)
+	Action      string  // e.g. "login", "logout", "session_revoke"
+	Target      string  // what the action applied to, e.g. an identity or session reference
+	IP          string
+	Details     map[string]any
+	CreatedAt   time.Time
+}
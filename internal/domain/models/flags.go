@@ -0,0 +1,34 @@
+package models
+
+// Flag is a feature flag. Enabled switches the feature on or off; Value optionally selects
+// a variant, e.g. the arm of an A/B test.
+type Flag struct {
+	Name    string
+	Enabled bool
+	Value   string
+}
+
+// FlagOverride replaces a flag's state for a single user, e.g. to roll a feature out to a
+// few users before enabling it for everyone.
+type FlagOverride struct {
+	Name    string
+	UserID  UserID
+	Enabled bool
+	Value   string
+}
+
+// Flags is the set of flags evaluated for one user, by name.
+type Flags map[string]Flag
+
+// Enabled reports whether flag name is on. Unknown flags are off.
+func (f Flags) Enabled(name string) bool {
+	return f[name].Enabled
+}
+
+// Value returns the variant of flag name, or "" if it is unknown or off.
+func (f Flags) Value(name string) string {
+	if flag := f[name]; flag.Enabled {
+		return flag.Value
+	}
+	return ""
+}
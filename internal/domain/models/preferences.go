@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// Defaults applied to preferences a user has not set.
+const (
+	DefaultTheme    = "auto"
+	DefaultLocale   = "en"
+	DefaultTimezone = "UTC"
+)
+
+// Preferences are per-user display settings. Theme, Locale and Timezone are typed; Extra
+// holds arbitrary app-specific keys. Empty fields mean "unset" and read as the defaults.
+type Preferences struct {
+	Theme    string // "auto", "light" or "dark"
+	Locale   string // BCP 47 language tag, e.g. "en" or "pt-BR"
+	Timezone string // IANA zone name, e.g. "Europe/Athens"
+	Extra    map[string]any
+}
+
+// WithDefaults returns p with unset fields replaced by the defaults.
+func (p Preferences) WithDefaults() Preferences {
+	if p.Theme == "" {
+		p.Theme = DefaultTheme
+	}
+	if p.Locale == "" {
+		p.Locale = DefaultLocale
+	}
+	if p.Timezone == "" {
+		p.Timezone = DefaultTimezone
+	}
+	return p
+}
+
+// Location returns the preferred time zone, falling back to UTC if it is unset or unknown.
+func (p Preferences) Location() *time.Location {
+	if p.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Get returns an app-specific preference from Extra.
+func (p Preferences) Get(key string) (any, bool) {
+	v, ok := p.Extra[key]
+	return v, ok
+}
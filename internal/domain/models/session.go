@@ -1,18 +1,76 @@
 package models
 
 import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"golang.org/x/oauth2"
 )
 
 type SessionData struct {
-	Token      *oauth2.Token
-	TokenData  []byte    // encrypted token bytes from the database
-	IDToken    string
-	SubjectID  string    // auth provider subject ID
-	IdentityID int64     // identities.id in the database
-	UserID     *UserID   // nil if identity not yet linked to a domain user
-	Roles      []string
-	Expires    time.Time
+	Token         *oauth2.Token
+	TokenData     []byte // encrypted token bytes from the database
+	IDToken       string
+	SubjectID     string  // auth provider subject ID
+	IdentityID    int64   // identities.id in the database
+	UserID        *UserID // nil if identity not yet linked to a domain user
+	Roles         []string
+	Groups        []string        // group memberships from the ID token; empty if not configured
+	TenantID      string          // tenant extracted from the ID token; empty if not configured
+	Claims        json.RawMessage // verified ID token claims captured at login
+	GrantedScopes []string        // OAuth2 scopes the provider actually granted to the access token
+	VerifiedAt    time.Time       // when Roles, Groups and Claims were last read from the provider
+	Expires       time.Time
+}
+
+// HasRole reports whether the session carries role.
+func (s *SessionData) HasRole(role string) bool {
+	return slices.Contains(s.Roles, role)
+}
+
+// HasGroup reports whether the session belongs to group.
+func (s *SessionData) HasGroup(group string) bool {
+	return slices.Contains(s.Groups, group)
+}
+
+// HasScope reports whether the provider granted scope to the session's access token.
+func (s *SessionData) HasScope(scope string) bool {
+	return slices.Contains(s.GrantedScopes, scope)
+}
+
+// Claim looks up a custom claim by dot-separated path (e.g. "org.department").
+// Returns false if the claim is absent or the path does not resolve.
+func (s *SessionData) Claim(path string) (any, bool) {
+	if len(s.Claims) == 0 {
+		return nil, false
+	}
+	var current any
+	if err := json.Unmarshal(s.Claims, &current); err != nil {
+		return nil, false
+	}
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if current, ok = obj[key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// ClaimString returns the claim at path formatted as a string, or "" if absent.
+func (s *SessionData) ClaimString(path string) string {
+	v, ok := s.Claim(path)
+	if !ok || v == nil {
+		return ""
+	}
+	if str, ok := v.(string); ok {
+		return str
+	}
+	return fmt.Sprint(v)
 }
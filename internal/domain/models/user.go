@@ -12,11 +12,16 @@ const (
 )
 
 type User struct {
-	ID          UserID
-	Name        string
-	Email       string
-	Role        Role
-	CreatedAt   time.Time
+	ID             UserID
+	Name           string
+	Email          string
+	Role           Role
+	TenantID       string // empty for single-tenant deployments
+	NameCustomized bool   // set once the user edits Name; Save then keeps the stored name
+	// Attributes holds org-specific values copied from ID token claims (e.g. employee_id,
+	// department) on each login. Values keep their JSON types.
+	Attributes map[string]any
+	CreatedAt  time.Time
 }
 
 // Identity represents a linked OIDC account. It holds only the OIDC-specific
@@ -5,4 +5,8 @@ import "errors"
 var (
 	ErrNotFound     = errors.New("not found")
 	ErrForbidden    = errors.New("forbidden")
+	ErrInvalidInput = errors.New("invalid input")
+	// ErrUnavailable reports that a backing store could not be reached. The operation may
+	// succeed if retried later.
+	ErrUnavailable = errors.New("temporarily unavailable")
 )
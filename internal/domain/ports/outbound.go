@@ -2,6 +2,8 @@ package ports
 
 import (
 	"context"
+	"io"
+	"time"
 
 	"github.com/antonkarounis/stoic/internal/domain/models"
 )
@@ -9,18 +11,86 @@ import (
 type SessionRepository interface {
 	CreateSession(ctx context.Context, sessionID string, session models.SessionData) error
 	DeleteSession(ctx context.Context, sessionID string) error
+	// DeleteSessionsByUser removes every session of every identity linked to the user and
+	// returns how many were removed.
+	DeleteSessionsByUser(ctx context.Context, userID models.UserID) (int64, error)
 	GetSession(ctx context.Context, sessionID string) (*models.SessionData, error)
 	UpdateSessionToken(ctx context.Context, sessionID string, session models.SessionData) error
+	// UpdateSessionExpiry moves the session's expiry to expires, e.g. to extend an active
+	// session.
+	UpdateSessionExpiry(ctx context.Context, sessionID string, expires time.Time) error
+	// DeleteExpiredSessions removes up to limit sessions whose expiry has passed and returns
+	// how many were removed.
+	DeleteExpiredSessions(ctx context.Context, limit int) (int64, error)
 }
 
 type IdentityRepository interface {
 	GetIdentityByID(ctx context.Context, identityID int64) (models.Identity, error)
+	// GetIdentityBySub looks up an identity without creating it, unlike UpsertIdentity.
+	GetIdentityBySub(ctx context.Context, authSub string) (models.Identity, error)
 	UpsertIdentity(ctx context.Context, authSub string) (models.Identity, error)
 	LinkUser(ctx context.Context, identityID int64, userID models.UserID) error
 }
 
 type UserRepository interface {
+	// Save inserts or updates the user. It never overwrites a name the user customized.
 	Save(ctx context.Context, user models.User) error
+	// UpdateDisplayName sets a user-chosen name and marks it as customized.
+	UpdateDisplayName(ctx context.Context, id models.UserID, name string) error
 	FindByID(ctx context.Context, id models.UserID) (models.User, error)
 	FindByEmail(ctx context.Context, email string) (models.User, error)
+	// FindByAttributes lists users whose attributes contain every key/value in attrs,
+	// oldest first.
+	FindByAttributes(ctx context.Context, attrs map[string]any, limit, offset int) ([]models.User, error)
+}
+
+type FlagRepository interface {
+	ListFlags(ctx context.Context) ([]models.Flag, error)
+	// ListFlagOverrides returns every per-user override, of any flag.
+	ListFlagOverrides(ctx context.Context) ([]models.FlagOverride, error)
+}
+
+type PreferencesRepository interface {
+	// Get returns the stored preferences, or zero Preferences if the user has none.
+	Get(ctx context.Context, userID models.UserID) (models.Preferences, error)
+	Save(ctx context.Context, userID models.UserID, prefs models.Preferences) error
+}
+
+type AuditRepository interface {
+	Record(ctx context.Context, event models.AuditEvent) error
+	ListRecent(ctx context.Context, limit int) ([]models.AuditEvent, error)
+}
+
+// RateLimitRepository keeps rate limit counters and lockouts, e.g. for failed logins. The
+// in-memory implementation is per instance; a shared one enforces limits across all of them.
+type RateLimitRepository interface {
+	// Hit records a hit on key and returns how many hits key had within the last window,
+	// this one included. The window slides with each hit rather than resetting at fixed
+	// boundaries, so a burst straddling a boundary is counted in full.
+	Hit(ctx context.Context, key string, window time.Duration) (int, error)
+	// Lock locks key out until the given time, unless it already is for longer, and clears
+	// its counters so counting starts afresh once the lockout ends.
+	Lock(ctx context.Context, key string, until time.Time) error
+	// LockedUntil returns when the latest lockout in force on any of keys ends, or the zero
+	// time if none is.
+	LockedUntil(ctx context.Context, keys []string) (time.Time, error)
+	// Reset clears the counters and lockouts of keys.
+	Reset(ctx context.Context, keys []string) error
+	// DeleteExpired removes counters and lockouts that have run out and returns how many
+	// were removed.
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+// BlobStore stores binary artifacts such as uploads and generated reports under
+// slash-separated keys (e.g. "reports/2024/q1.pdf").
+type BlobStore interface {
+	// Put writes the content of r under key, replacing any existing blob.
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	// Get opens the blob at key; it returns ErrNotFound if there is none. The caller
+	// must close the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob at key. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+	// URL returns a URL clients can fetch the blob from.
+	URL(ctx context.Context, key string) (string, error)
 }
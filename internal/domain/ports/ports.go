@@ -1,16 +1,85 @@
 package ports
 
+import "time"
+
 type Config struct {
-	Environment string // "dev" or "prod"
-	AppURL      string // e.g. "http://localhost:8080"
-	Addr        string // e.g. ":8080"
+	Environment  string   // "dev" or "prod"
+	AppURL       string   // e.g. "http://localhost:8080"
+	TrustedHosts []string // further hosts, reached through the proxy, that absolute URLs may use
+	Addr         string   // e.g. ":8080"
+
+	DatabaseURL        string
+	DBStatementTimeout time.Duration // server-side statement_timeout for pooled connections; 0 disables
+	DBSchema           string        // schema for tables and schema_migrations; empty uses public
+	DBDenySchemaCreate bool          // refuse to start if the runtime user can create objects in the schema
 
-	DatabaseURL string
+	MigrationLockRetries       int           // 0 retries until MigrationLockTimeout
+	MigrationLockRetryInterval time.Duration // delay between migration lock attempts
+	MigrationLockTimeout       time.Duration // give up waiting for the migration lock after this
+	MigrationTable             string        // migration version table; empty uses schema_migrations
+	MigrateOnStart             bool          // apply migrations at startup; disable when they run separately
 
 	OIDCIssuerURL    string
 	OIDCClientID     string
 	OIDCClientSecret string
 	OIDCLogoutURL    string // optional: omit to skip provider-side logout
 
+	OIDCDiscoveryFile string // optional: local discovery document (with optional inline jwks) used instead of fetching it
+
+	OIDCScopes              []string      // requested OAuth2 scopes; openid is always added
+	OIDCRequestRefreshToken bool          // request offline access so sessions can refresh tokens
+	OIDCBearerAuth          bool          // accept "Authorization: Bearer" tokens from non-browser clients
+	OIDCSessionClaims       []string      // ID token claims kept on the session; empty keeps all
+	OIDCUserAttributeClaims []string      // ID token claims stored as user attributes on each login
+	OIDCTenantClaim         string        // claim holding the tenant id (e.g. "org_id"); empty disables multi-tenancy
+	OIDCGroupsClaim         string        // claim listing group memberships (e.g. "groups"); empty disables groups
+	OIDCRoleAllowlist       []string      // roles kept on the session; empty keeps all
+	OIDCMaxRoles            int           // cap on roles stored per session; 0 means no cap
+	OIDCRoleRefreshInterval time.Duration // how often a token refresh re-reads roles and groups; negative disables
+
+	AllowedEmailDomains []string // email domains admitted at login ("*.example.com" for subdomains); empty admits all
+	DeniedEmailDomains  []string // email domains rejected at login; checked before AllowedEmailDomains
+
+	LoginMaxFailures   int           // failed callbacks per account that trigger a lockout; 0 disables
+	LoginFailureWindow time.Duration // period over which failed callbacks are counted
+	LoginLockout       time.Duration // how long a locked-out account cannot log in
+	RateLimitStore     string        // where rate limits are kept: "memory" (per instance) or "postgres" (shared)
+
+	SessionTTL              time.Duration // lifetime of both the session row and the session cookie
+	SessionCleanupBatchSize int           // expired sessions deleted per statement by the cleanup routine
+	SessionSliding          bool          // extend active sessions to a full SessionTTL instead of expiring them at a fixed time
+	SessionSlidingInterval  time.Duration // minimum time between two extensions of a session
+
+	PaginationDefaultPerPage int // page size when ?per_page is absent
+	PaginationMaxPerPage     int // upper bound on ?per_page for list endpoints
+
+	PublicPaths   []string      // extra routes served without auth; a trailing "/" matches as a prefix
+	RetryAfter    time.Duration // Retry-After sent with 503 responses such as a failing /readyz
+	OpenAPI       bool          // serve /openapi.json for documented JSON API routes
+	WarmTemplates bool          // render every page once at startup, failing on render errors
+
+	AppPrefix      string // URL prefix of the authenticated area
+	LoginPath      string // route starting the login; must be outside AppPrefix
+	AfterLoginPath string // landing page after login; empty uses the dashboard
+
+	FeatureFlags         []string      // default flags: "name" turns a flag on, "name=value" also sets its variant
+	FeatureFlagsCacheTTL time.Duration // how long flags from the database are cached
+
+	BlobDriver   string // blob storage backend; "local" is built in
+	BlobLocalDir string // root directory for the local backend
+	BlobBaseURL  string // URL prefix blobs are served under; empty disables blob URLs
+
 	SecretKey []byte // 32-byte key for token encryption and CSRF protection
+
+	Cookies CookieConfig
+}
+
+// CookieConfig sets the names and attributes of every cookie the app sets. Give apps
+// sharing a parent domain distinct prefixes so they don't overwrite each other's cookies.
+type CookieConfig struct {
+	Prefix         string // prepended to every cookie name, e.g. "billing_" for "billing_session_id"
+	Domain         string // Domain attribute; empty keeps cookies to the exact host
+	SameSite       string // "lax", "strict" or "none" (requires secure cookies)
+	Secure         string // "true", "false" or "auto" (derive from APP_URL and request scheme)
+	SameSiteCompat bool   // omit SameSite on auth cookies for browsers that mishandle it
 }
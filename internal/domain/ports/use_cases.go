@@ -7,13 +7,15 @@ import (
 )
 
 type RegisterInput struct {
-	Name  string
-	Email string
+	Name       string
+	Email      string
+	TenantID   string
+	Attributes map[string]any
 }
 
 type LinkUserInput struct {
-	UserID      models.UserID
-	Role        models.Role
+	UserID models.UserID
+	Role   models.Role
 }
 
 type UnlinkUserInput struct {
@@ -25,8 +27,37 @@ type UpdateProfileInput struct {
 	Name   string
 }
 
+// SyncProfileInput carries the provider's current profile for an existing user.
+type SyncProfileInput struct {
+	UserID     models.UserID
+	Name       string
+	Email      string
+	Attributes map[string]any
+}
+
+type UpdatePreferencesInput struct {
+	UserID   models.UserID
+	Theme    string
+	Locale   string
+	Timezone string
+}
+
 type UserService interface {
 	Register(ctx context.Context, input RegisterInput) (models.User, error)
 	GetProfile(ctx context.Context, userID models.UserID) (models.User, error)
+	// UpdateProfile sets a user-chosen display name that later logins won't overwrite.
 	UpdateProfile(ctx context.Context, input UpdateProfileInput) (models.User, error)
+	// SyncProfile refreshes name, email and attributes from the provider, keeping a
+	// customized name.
+	SyncProfile(ctx context.Context, input SyncProfileInput) error
+	// GetPreferences returns the user's preferences with defaults applied to unset fields.
+	GetPreferences(ctx context.Context, userID models.UserID) (models.Preferences, error)
+	// UpdatePreferences validates and stores the typed preferences, keeping Extra as is.
+	UpdatePreferences(ctx context.Context, input UpdatePreferencesInput) (models.Preferences, error)
+}
+
+type FlagService interface {
+	// Evaluate returns the flags in effect for userID, or for anonymous visitors when it is
+	// nil. On error it still returns the best flags available, at worst the defaults.
+	Evaluate(ctx context.Context, userID *models.UserID) (models.Flags, error)
 }
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/antonkarounis/stoic/internal/domain/models"
+	"github.com/antonkarounis/stoic/internal/domain/ports"
+)
+
+// defaultFlagCacheTTL is how long flags are served from memory when no TTL is configured.
+const defaultFlagCacheTTL = 30 * time.Second
+
+type flagService struct {
+	flags    ports.FlagRepository
+	defaults models.Flags
+	cacheTTL time.Duration
+
+	loadMu  sync.Mutex // serializes reloads so an expired cache triggers one query, not one per request
+	current atomic.Pointer[flagSnapshot]
+}
+
+// flagSnapshot is the cached state of every flag and override.
+type flagSnapshot struct {
+	flags     models.Flags
+	overrides map[models.UserID][]models.FlagOverride
+	loadedAt  time.Time
+}
+
+// NewFlagService returns a FlagService that starts from defaults, applies the stored flags
+// over them and then each user's overrides. Stored flags are cached for cacheTTL, so
+// changes in the database take up to that long to apply; a cacheTTL of zero or less uses
+// 30s.
+func NewFlagService(flags ports.FlagRepository, defaults []models.Flag, cacheTTL time.Duration) ports.FlagService {
+	if cacheTTL <= 0 {
+		cacheTTL = defaultFlagCacheTTL
+	}
+	s := &flagService{flags: flags, defaults: make(models.Flags, len(defaults)), cacheTTL: cacheTTL}
+	for _, flag := range defaults {
+		s.defaults[flag.Name] = flag
+	}
+	return s
+}
+
+func (s *flagService) Evaluate(ctx context.Context, userID *models.UserID) (models.Flags, error) {
+	snap, err := s.snapshot(ctx)
+
+	flags := maps.Clone(snap.flags)
+	if userID != nil {
+		for _, override := range snap.overrides[*userID] {
+			flags[override.Name] = models.Flag{Name: override.Name, Enabled: override.Enabled, Value: override.Value}
+		}
+	}
+	return flags, err
+}
+
+// snapshot returns the cached flags, reloading them once they are older than cacheTTL.
+// When a reload fails the previous snapshot, or the defaults, are kept for another
+// cacheTTL rather than retried on every request.
+func (s *flagService) snapshot(ctx context.Context) (*flagSnapshot, error) {
+	if snap := s.current.Load(); snap != nil && time.Since(snap.loadedAt) < s.cacheTTL {
+		return snap, nil
+	}
+
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+	previous := s.current.Load()
+	if previous != nil && time.Since(previous.loadedAt) < s.cacheTTL {
+		return previous, nil // reloaded while we waited
+	}
+
+	snap, err := s.load(ctx)
+	if err != nil {
+		snap = &flagSnapshot{flags: s.defaults, loadedAt: time.Now()}
+		if previous != nil {
+			snap.flags, snap.overrides = previous.flags, previous.overrides
+		}
+	}
+	s.current.Store(snap)
+	return snap, err
+}
+
+func (s *flagService) load(ctx context.Context) (*flagSnapshot, error) {
+	stored, err := s.flags.ListFlags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	overrides, err := s.flags.ListFlagOverrides(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &flagSnapshot{
+		flags:     maps.Clone(s.defaults),
+		overrides: make(map[models.UserID][]models.FlagOverride),
+		loadedAt:  time.Now(),
+	}
+	for _, flag := range stored {
+		snap.flags[flag.Name] = flag
+	}
+	for _, override := range overrides {
+		snap.overrides[override.UserID] = append(snap.overrides[override.UserID], override)
+	}
+	return snap, nil
+}
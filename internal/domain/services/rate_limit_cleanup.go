@@ -0,0 +1,34 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/antonkarounis/stoic/internal/domain/ports"
+)
+
+const rateLimitCleanupInterval = 5 * time.Minute
+
+// StartRateLimitCleanup periodically removes expired counters and lockouts from
+// rateLimits until ctx is done. Expired entries no longer affect any limit, so this only
+// keeps the store from growing with every key ever limited.
+func StartRateLimitCleanup(ctx context.Context, rateLimits ports.RateLimitRepository) {
+	go func() {
+		ticker := time.NewTicker(rateLimitCleanupInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				deleted, err := rateLimits.DeleteExpired(ctx)
+				if err != nil {
+					slog.Warn("failed to clean up expired rate limits", "error", err)
+				} else if deleted > 0 {
+					slog.Debug("cleaned up expired rate limits", "deleted", deleted)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/antonkarounis/stoic/internal/domain/ports"
+)
+
+const (
+	sessionCleanupInterval = 5 * time.Minute
+
+	// defaultCleanupBatchSize bounds each cleanup DELETE when no batch size is configured.
+	defaultCleanupBatchSize = 1000
+)
+
+// StartSessionCleanup periodically removes expired sessions from sessions until ctx is
+// done. Each run deletes batchSize sessions at a time until none are left, so a large
+// backlog never runs as one statement that holds row locks for long or hits the statement
+// timeout. A batchSize of zero or less uses 1000.
+func StartSessionCleanup(ctx context.Context, sessions ports.SessionRepository, batchSize int) {
+	if batchSize <= 0 {
+		batchSize = defaultCleanupBatchSize
+	}
+	go func() {
+		ticker := time.NewTicker(sessionCleanupInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				deleteExpiredSessions(ctx, sessions, batchSize)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// deleteExpiredSessions removes expired sessions in batches of batchSize until a batch
+// comes back short, logging progress so a long-running backlog cleanup is visible.
+func deleteExpiredSessions(ctx context.Context, sessions ports.SessionRepository, batchSize int) {
+	var total int64
+	for batch := 1; ; batch++ {
+		deleted, err := sessions.DeleteExpiredSessions(ctx, batchSize)
+		if err != nil {
+			slog.Warn("failed to clean up expired sessions", "error", err, "deleted", total)
+			return
+		}
+		total += deleted
+		if deleted < int64(batchSize) || ctx.Err() != nil {
+			break
+		}
+		slog.Debug("expired session cleanup in progress", "batch", batch, "deleted", total)
+	}
+	if total > 0 {
+		slog.Info("cleaned up expired sessions", "deleted", total)
+	}
+}
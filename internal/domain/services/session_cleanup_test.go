@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/antonkarounis/stoic/internal/domain/ports"
+)
+
+// expiredSessions is a ports.SessionRepository holding a number of expired sessions and
+// recording each DeleteExpiredSessions call. Its other methods are not implemented.
+type expiredSessions struct {
+	ports.SessionRepository
+	expired int
+	failAt  int // the call, from 1, that fails; 0 never fails
+	limits  []int
+}
+
+func (s *expiredSessions) DeleteExpiredSessions(ctx context.Context, limit int) (int64, error) {
+	s.limits = append(s.limits, limit)
+	if len(s.limits) == s.failAt {
+		return 0, errors.New("statement timeout")
+	}
+	deleted := min(limit, s.expired)
+	s.expired -= deleted
+	return int64(deleted), nil
+}
+
+func TestDeleteExpiredSessionsInBatches(t *testing.T) {
+	tests := []struct {
+		name        string
+		expired     int
+		failAt      int
+		wantLimits  []int
+		wantExpired int
+	}{
+		{"no expired sessions", 0, 0, []int{1000}, 0},
+		{"backlog of many batches", 2500, 0, []int{1000, 1000, 1000}, 0},
+		{"exact multiple of the batch size", 2000, 0, []int{1000, 1000, 1000}, 0},
+		{"failed batch stops the run", 2500, 2, []int{1000, 1000}, 1500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions := &expiredSessions{expired: tt.expired, failAt: tt.failAt}
+
+			deleteExpiredSessions(context.Background(), sessions, 1000)
+
+			if !slices.Equal(sessions.limits, tt.wantLimits) {
+				t.Errorf("batches = %v, want %v", sessions.limits, tt.wantLimits)
+			}
+			if sessions.expired != tt.wantExpired {
+				t.Errorf("%d expired sessions left, want %d", sessions.expired, tt.wantExpired)
+			}
+		})
+	}
+}
+
+func TestDeleteExpiredSessionsStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	sessions := &expiredSessions{expired: 5000}
+
+	deleteExpiredSessions(ctx, sessions, 1000)
+
+	if len(sessions.limits) != 1 {
+		t.Errorf("ran %d batches after cancellation, want 1", len(sessions.limits))
+	}
+}
@@ -2,27 +2,35 @@ package services
 
 import (
 	"context"
+	"reflect"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/antonkarounis/stoic/internal/domain/models"
 	"github.com/antonkarounis/stoic/internal/domain/ports"
 )
 
+const maxDisplayNameLength = 100
+
 type userService struct {
 	users ports.UserRepository
+	prefs ports.PreferencesRepository
 }
 
-func NewUserService(users ports.UserRepository) ports.UserService {
-	return &userService{users: users}
+func NewUserService(users ports.UserRepository, prefs ports.PreferencesRepository) ports.UserService {
+	return &userService{users: users, prefs: prefs}
 }
 
 func (s *userService) Register(ctx context.Context, input ports.RegisterInput) (models.User, error) {
 	u := models.User{
-		ID:        models.UserID(newID()),
-		Name:      input.Name,
-		Email:     input.Email,
-		Role:      models.RoleMember,
-		CreatedAt: time.Now(),
+		ID:         models.UserID(newID()),
+		Name:       input.Name,
+		Email:      input.Email,
+		Role:       models.RoleMember,
+		TenantID:   input.TenantID,
+		Attributes: input.Attributes,
+		CreatedAt:  time.Now(),
 	}
 	if err := s.users.Save(ctx, u); err != nil {
 		return models.User{}, err
@@ -35,13 +43,94 @@ func (s *userService) GetProfile(ctx context.Context, userID models.UserID) (mod
 }
 
 func (s *userService) UpdateProfile(ctx context.Context, input ports.UpdateProfileInput) (models.User, error) {
+	name := strings.TrimSpace(input.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxDisplayNameLength {
+		return models.User{}, ports.ErrInvalidInput
+	}
+	if err := s.users.UpdateDisplayName(ctx, input.UserID, name); err != nil {
+		return models.User{}, err
+	}
+	return s.users.FindByID(ctx, input.UserID)
+}
+
+func (s *userService) SyncProfile(ctx context.Context, input ports.SyncProfileInput) error {
 	u, err := s.users.FindByID(ctx, input.UserID)
 	if err != nil {
-		return models.User{}, err
+		return err
+	}
+	if u.Name == input.Name && u.Email == input.Email && sameAttributes(u.Attributes, input.Attributes) {
+		return nil
 	}
+	// Save keeps a customized name, so only provider-managed names are refreshed here
 	u.Name = input.Name
-	if err := s.users.Save(ctx, u); err != nil {
-		return models.User{}, err
+	u.Email = input.Email
+	u.Attributes = input.Attributes
+	return s.users.Save(ctx, u)
+}
+
+// sameAttributes compares attribute maps, treating nil and empty as equal.
+func sameAttributes(a, b map[string]any) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
 	}
-	return u, nil
+	return reflect.DeepEqual(a, b)
+}
+
+func (s *userService) GetPreferences(ctx context.Context, userID models.UserID) (models.Preferences, error) {
+	p, err := s.prefs.Get(ctx, userID)
+	if err != nil {
+		return models.Preferences{}, err
+	}
+	return p.WithDefaults(), nil
+}
+
+func (s *userService) UpdatePreferences(ctx context.Context, input ports.UpdatePreferencesInput) (models.Preferences, error) {
+	switch input.Theme {
+	case "", "auto", "light", "dark":
+	default:
+		return models.Preferences{}, ports.ErrInvalidInput
+	}
+	if input.Timezone != "" {
+		if _, err := time.LoadLocation(input.Timezone); err != nil {
+			return models.Preferences{}, ports.ErrInvalidInput
+		}
+	}
+	if !validLocale(input.Locale) {
+		return models.Preferences{}, ports.ErrInvalidInput
+	}
+
+	p, err := s.prefs.Get(ctx, input.UserID)
+	if err != nil {
+		return models.Preferences{}, err
+	}
+	p.Theme = input.Theme
+	p.Locale = input.Locale
+	p.Timezone = input.Timezone
+	if err := s.prefs.Save(ctx, input.UserID, p); err != nil {
+		return models.Preferences{}, err
+	}
+	return p.WithDefaults(), nil
+}
+
+// validLocale accepts "" (unset) or a BCP 47-shaped tag: alphanumeric subtags of 1-8
+// characters separated by hyphens, starting with a 2-3 letter language.
+func validLocale(locale string) bool {
+	if locale == "" {
+		return true
+	}
+	subtags := strings.Split(locale, "-")
+	if len(subtags[0]) < 2 || len(subtags[0]) > 3 {
+		return false
+	}
+	for _, subtag := range subtags {
+		if len(subtag) == 0 || len(subtag) > 8 {
+			return false
+		}
+		for _, c := range subtag {
+			if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9') {
+				return false
+			}
+		}
+	}
+	return true
 }